@@ -0,0 +1,316 @@
+// Licensed under BSD 2-Clause License.
+
+// Package cleanup removes ads, navigation links and other junk from
+// the chapters of a book with the rules in config.Rule, and tidies up
+// their typography, see Typography.
+//
+// The selectors of the rules are a subset of those of CSS: a comma
+// separated list of a tag name or *, followed by any of
+//
+//	.CLASS          the class attribute has CLASS
+//	#ID             the id attribute is ID
+//	[ATTR]          the attribute ATTR is set
+//	[ATTR=VALUE]    the attribute ATTR is VALUE
+//	[ATTR^=VALUE]   ... starts with VALUE
+//	[ATTR$=VALUE]   ... ends with VALUE
+//	[ATTR*=VALUE]   ... contains VALUE
+//	[ATTR~=VALUE]   ... has the word VALUE
+//	:has(SELECTOR)  an element inside matches SELECTOR
+//
+// e.g., div.sharedaddy or p:has(span[style^="color:#4c4c48"]).  The
+// child combinator, as in body > p, is the only one supported.
+//
+// The chapters are rewritten token by token so that the markup the
+// rules do not touch is left as-is.
+package cleanup
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// Rule is a compiled config.Rule.
+type Rule struct {
+	drop     Selector
+	text     *regexp.Regexp
+	truncate Selector
+	strip    []string
+
+	// Sel is the selector of the elements text and strip apply
+	// to, nil for all.
+	sel Selector
+}
+
+// Return the compiled rule R.
+func Compile(r config.Rule) (Rule, error) {
+	if err := config.CheckRule(r); err != nil {
+		return Rule{}, err
+	}
+	var c Rule
+	var err error
+	if r.Drop != "" {
+		if c.drop, err = ParseSelector(r.Drop); err != nil {
+			return Rule{}, err
+		}
+	}
+	if r.Truncate != "" {
+		if c.truncate, err = ParseSelector(r.Truncate); err != nil {
+			return Rule{}, err
+		}
+	}
+	sel := r.Select
+	if sel == "" && r.DropText != "" {
+		sel = "p"
+	}
+	if sel != "" {
+		if c.sel, err = ParseSelector(sel); err != nil {
+			return Rule{}, err
+		}
+	}
+	if r.DropText != "" {
+		c.text = regexp.MustCompile(r.DropText)
+	}
+	for _, a := range r.Strip {
+		c.strip = append(c.strip, strings.ToLower(a))
+	}
+	return c, nil
+}
+
+// Return the compiled RULES.
+func CompileAll(rules []config.Rule) ([]Rule, error) {
+	var out []Rule
+	for i, r := range rules {
+		c, err := Compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// Return an error if the rule sets or the rules of the series in
+// config.Config do not compile.  config.Load checks all but their
+// selectors.
+func Check() error {
+	for _, name := range config.RuleSetNames() {
+		rules, _ := config.RuleSetFor(name)
+		if _, err := CompileAll(rules); err != nil {
+			return fmt.Errorf("rule set %s: %v", name, err)
+		}
+	}
+	for u, s := range config.Config.Series {
+		if _, err := CompileAll(s.Rules); err != nil {
+			return fmt.Errorf("series %s: %v", u, err)
+		}
+	}
+	return nil
+}
+
+// Elements without an end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// A document split into tokens.
+type document struct {
+	raw  [][]byte
+	toks []html.Token
+
+	// End is the index of the last token of the element starting
+	// at each token, and start that of the first token of the
+	// element ending at each end tag.  Both are the index of the
+	// token itself for the other tokens.
+	end, start []int
+
+	// Parent is the index of the start tag of the element each
+	// token is in, -1 for none.
+	parent []int
+
+	// Drop is true for the tokens to leave out.
+	drop []bool
+
+	// First and last are the indexes of the first and last tokens
+	// in the body.
+	first, last int
+}
+
+// Return the document CONTENT.
+func parse(content []byte) *document {
+	d := &document{}
+	z := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		d.raw = append(d.raw, append([]byte(nil), z.Raw()...))
+		d.toks = append(d.toks, z.Token())
+	}
+	n := len(d.toks)
+	d.end, d.start, d.drop = make([]int, n), make([]int, n), make([]bool, n)
+	d.parent = make([]int, n)
+	var stack []int
+	for i, t := range d.toks {
+		d.end[i], d.start[i], d.parent[i] = i, i, -1
+		if len(stack) > 0 {
+			d.parent[i] = stack[len(stack)-1]
+		}
+		switch t.Type {
+		case html.StartTagToken:
+			if !voidElements[t.Data] {
+				stack = append(stack, i)
+			}
+		case html.EndTagToken:
+			j := len(stack) - 1
+			for j >= 0 && d.toks[stack[j]].Data != t.Data {
+				j--
+			}
+			if j < 0 {
+				// A stray end tag.
+				continue
+			}
+			// The elements left open end before it.
+			for _, k := range stack[j+1:] {
+				d.end[k] = i - 1
+			}
+			d.end[stack[j]] = i
+			d.start[i] = stack[j]
+			stack = stack[:j]
+		}
+	}
+	for _, k := range stack {
+		d.end[k] = n - 1
+	}
+
+	d.first, d.last = 0, n-1
+	for i, t := range d.toks {
+		if t.Type == html.StartTagToken && t.Data == "body" {
+			d.first, d.last = i+1, d.end[i]
+			if d.toks[d.last].Type == html.EndTagToken && d.start[d.last] == i {
+				d.last--
+			}
+			break
+		}
+	}
+	return d
+}
+
+// Return true if token I of D starts an element.
+func (d *document) isStart(i int) bool {
+	t := d.toks[i].Type
+	return t == html.StartTagToken || t == html.SelfClosingTagToken
+}
+
+// Return the text of the element starting at token I of D.
+func (d *document) text(i int) string {
+	var b strings.Builder
+	for k := i; k <= d.end[i]; k++ {
+		if !d.drop[k] && d.toks[k].Type == html.TextToken {
+			b.WriteString(d.toks[k].Data)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Leave out the element starting at token I of D.
+func (d *document) remove(i int) {
+	for k := i; k <= d.end[i]; k++ {
+		d.drop[k] = true
+	}
+}
+
+// Leave out the element starting at token I of D and everything after
+// it in the body, but the end tags of the elements it is in.
+func (d *document) truncate(i int) {
+	for k := i; k <= d.last; k++ {
+		if d.toks[k].Type != html.EndTagToken || d.start[k] >= i {
+			d.drop[k] = true
+		}
+	}
+}
+
+// Remove the attributes KEYS from the start tag I of D.
+func (d *document) strip(i int, keys []string) bool {
+	t := &d.toks[i]
+	var attrs []html.Attribute
+	for _, a := range t.Attr {
+		keep := true
+		for _, k := range keys {
+			keep = keep && a.Key != k
+		}
+		if keep {
+			attrs = append(attrs, a)
+		}
+	}
+	if len(attrs) == len(t.Attr) {
+		return false
+	}
+	t.Attr = attrs
+	d.raw[i] = []byte(t.String())
+	return true
+}
+
+// Apply rule R to the body of D.  Return true if it changed anything.
+func (d *document) apply(r Rule) bool {
+	changed := false
+	for i := d.first; i <= d.last; i++ {
+		if d.drop[i] || !d.isStart(i) {
+			continue
+		}
+		switch {
+		case r.drop != nil:
+			if r.drop.match(d, i) {
+				d.remove(i)
+				changed = true
+			}
+		case r.truncate != nil:
+			if r.truncate.match(d, i) {
+				d.truncate(i)
+				return true
+			}
+		case r.sel != nil && !r.sel.match(d, i):
+		case r.text != nil:
+			if r.text.MatchString(d.text(i)) {
+				d.remove(i)
+				changed = true
+			}
+		case r.strip != nil:
+			if d.strip(i, r.strip) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// Return CONTENT, an XHTML file, with RULES applied to the elements in
+// its body in turn.  CONTENT is returned as-is if no rule changes it.
+func Clean(content []byte, rules []Rule) []byte {
+	if len(rules) == 0 {
+		return content
+	}
+	d := parse(content)
+	changed := false
+	for _, r := range rules {
+		if d.apply(r) {
+			changed = true
+		}
+	}
+	if !changed {
+		return content
+	}
+	var b bytes.Buffer
+	for i, raw := range d.raw {
+		if !d.drop[i] {
+			b.Write(raw)
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,236 @@
+package cleanup
+
+import (
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"strings"
+	"testing"
+)
+
+// Return the chapter with BODY.
+func testChapter(body string) []byte {
+	return []byte(epub.ContentPreamble("Chapter 1") + body + epub.ContentEnd())
+}
+
+func TestParseSelector(t *testing.T) {
+	for _, s := range []string{
+		"div", "*", "div.sharedaddy", "#jp-post-flair", "div[id^=atatags-]",
+		`span[style^="color:#4c4c48;"]`, "p:has(a[href*='patreon.com'])",
+		"div.a.b, p , span#x[data-y]", "body > p", "div.a>p:has(body > a)",
+	} {
+		if _, err := ParseSelector(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{
+		"", "div p", "div >", "> p", "div > > p", "div[id", "p:has(a", "div:first-child",
+		"div,", ".", "[^=x]", "div[id!=x]",
+	} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		rules []config.Rule
+		body  string
+		want  string
+	}{{
+		"drop",
+		[]config.Rule{{Drop: "div.code-block, div[id^=waldo-tag]"}},
+		"\n<p>A</p>\n<div class='code-block code-block-3'><ins>ad</ins></div>\n<p>B</p><div id=\"waldo-tag-1\"></div>",
+		"\n<p>A</p>\n\n<p>B</p>",
+	}, {
+		"drop text",
+		[]config.Rule{{DropText: `^Translator: `}},
+		"<p>Translator: Foo</p><div><p>Not a <b>Translator: </b>credit.</p></div>",
+		"<div><p>Not a <b>Translator: </b>credit.</p></div>",
+	}, {
+		"drop has",
+		[]config.Rule{{Drop: `p:has(span[style^="color:#4c4c48;"])`}},
+		`<p><span style="color:#4c4c48;">TL: Foo</span></p><p><span>Bar</span></p>`,
+		`<p><span>Bar</span></p>`,
+	}, {
+		"truncate",
+		[]config.Rule{{Truncate: "div[id^=atatags-]"}},
+		"<div class='entry'><p>A</p><div><div id='atatags-1'></div><p>Related</p></div><p>B</p></div>\n",
+		"<div class='entry'><p>A</p><div></div></div>",
+	}, {
+		"truncate first",
+		[]config.Rule{{Truncate: "span#end, hr"}},
+		"<p>A</p><hr/><p>B</p><span id='end'></span>",
+		"<p>A</p>",
+	}, {
+		"truncate child",
+		[]config.Rule{{Truncate: "body > span#end"}},
+		"<p>A<span id='end'></span></p><p>B</p><span id='end'></span><p>C</p>",
+		"<p>A<span id='end'></span></p><p>B</p>",
+	}, {
+		"drop child",
+		[]config.Rule{{Drop: "div.a > div > p"}},
+		"<div class='a'><div><p>A</p><b><p>B</p></b></div><p>C</p></div>",
+		"<div class='a'><div><b><p>B</p></b></div><p>C</p></div>",
+	}, {
+		"strip",
+		[]config.Rule{{Strip: []string{"style", "class"}, Select: "span"}},
+		`<p style="x"><span style="color:red" class="c" id="s">A &amp; B</span></p>`,
+		`<p style="x"><span id="s">A &amp; B</span></p>`,
+	}, {
+		"rules in turn",
+		[]config.Rule{{Drop: "span"}, {DropText: `^$`}},
+		"<p><span>Ad</span></p><p>A</p>",
+		"<p>A</p>",
+	}, {
+		"implied end tags",
+		[]config.Rule{{Drop: "div.ad"}},
+		"<div class='ad'><p>Ad<p>Ad</div><p>A",
+		"<p>A",
+	}} {
+		rules, err := CompileAll(c.rules)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got := string(Clean(testChapter(c.body), rules))
+		if want := string(testChapter(c.want)); got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, want)
+		}
+	}
+}
+
+func TestCleanUnchanged(t *testing.T) {
+	// Markup the tokenizer would write differently.
+	content := testChapter("<p class=a>A<br>B</p><img src='x' / >")
+	rules, err := CompileAll([]config.Rule{{Drop: "div"}, {Strip: []string{"style"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Clean(content, rules); string(got) != string(content) {
+		t.Errorf("got\n%s", got)
+	}
+	// The head is left alone.
+	rules, _ = CompileAll([]config.Rule{{Drop: "title, meta"}})
+	if got := Clean(content, rules); string(got) != string(content) {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestRuleSets(t *testing.T) {
+	for name, rules := range config.RuleSets {
+		if _, err := CompileAll(rules); err != nil {
+			t.Errorf("rule set %s: %v", name, err)
+		}
+	}
+
+	for _, c := range []struct {
+		set, body, want string
+	}{
+		{"navigation", "<p>A</p><p><a href='/'>Index</a> | <a href='/2'>Next Chapter</a></p>", "<p>A</p>"},
+		{"navigation", "<p>« Previous Chapter | ToC | Next Chapter »</p><p>Next, she went home.</p>",
+			"<p>Next, she went home.</p>"},
+		{"patreon", "<p>A</p><p>Please support us on Patreon!</p>", "<p>A</p>"},
+		{"patreon", "<p><a href='https://www.patreon.com/foo'><img src='x'/></a></p><p>A</p>", "<p>A</p>"},
+		{"wordpress", "<p>A</p><div class='sharedaddy sd-sharing-enabled'><h3>Share this:</h3></div>", "<p>A</p>"},
+		{"jetpack", "<p>A</p><div id='jp-post-flair'><div class='sd-like'></div></div>", "<p>A</p>"},
+	} {
+		rules, _ := CompileAll(config.RuleSets[c.set])
+		got := string(Clean(testChapter(c.body), rules))
+		if want := string(testChapter(c.want)); got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.set, got, want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, r := range []config.Rule{
+		{},
+		{Drop: "div", Truncate: "hr"},
+		{Drop: "div p"},
+		{DropText: "("},
+		{Strip: []string{"style"}, Select: "span >"},
+		{Drop: "div", Select: "p"},
+		{Truncate: "hr", Select: "div"},
+	} {
+		if _, err := Compile(r); err == nil {
+			t.Errorf("%+v: no error", r)
+		} else if strings.Contains(err.Error(), "%!") {
+			t.Errorf("%+v: %v", r, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	if err := Check(); err != nil {
+		t.Fatal(err)
+	}
+	config.Config.RuleSets = map[string][]config.Rule{"mine": {{Drop: "div"}, {Drop: "div p"}}}
+	if err := Check(); err == nil || !strings.HasPrefix(err.Error(), "rule set mine: rule 2: ") {
+		t.Errorf("got %v", err)
+	}
+	config.Config.RuleSets = nil
+	config.Config.Series = map[string]config.Series{"https://example.com/": {Rules: []config.Rule{{Truncate: "hr:first"}}}}
+	if err := Check(); err == nil || !strings.HasPrefix(err.Error(), "series https://example.com/: rule 1: ") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestIsSceneBreak(t *testing.T) {
+	for text, want := range map[string]bool{
+		"***":     true,
+		"* * *":   true,
+		"◇◇◇":     true,
+		" ◆ ◆ ◆ ": true,
+		"-x-x-":   true,
+		"x-x-x":   true,
+		"#":       false,
+		"……":      false,
+		"...":     false,
+		"——":      false,
+		"Fin.":    false,
+		"":        false,
+	} {
+		if got := IsSceneBreak(text); got != want {
+			t.Errorf("got %v for %q", got, text)
+		}
+	}
+}
+
+func TestTypography(t *testing.T) {
+	for _, c := range []struct {
+		lang, body, want string
+	}{
+		{"en", `<p>"Don't," she said -- 'it's the '90s.'</p>`,
+			`<p>“Don’t,” she said — ‘it’s the ’90s.’</p>`},
+		{"en", `<p>"I... I --"</p><p>Wait . . . what? It's 5 - 6 p.m.</p>`,
+			`<p>“I… I —”</p><p>Wait … what? It’s 5 – 6 p.m.</p>`},
+		{"en", `<p>"<i>Hello</i>," he said.</p><p>"Hi."</p>`,
+			`<p>“<i>Hello</i>,” he said.</p><p>“Hi.”</p>`},
+		{"de", `<p>"Hallo", sagte sie.</p>`, `<p>„Hallo“, sagte sie.</p>`},
+		{"fr-CA", `<p>" Bonjour ", dit-il.</p>`, "<p>«\u202fBonjour\u202f», dit-il.</p>"},
+		{"ja", `<p>"Yes."</p>`, `<p>「Yes.」</p>`},
+		{"", "<p>A&nbsp;&nbsp; B and Mr.&nbsp;Smith</p>", "<p>A B and Mr.\u00a0Smith</p>"},
+		{"en", `<p>A &amp; B</p><pre>"--"</pre><code>x...</code>`,
+			`<p>A &amp; B</p><pre>"--"</pre><code>x...</code>`},
+		{"en", "<p>A</p>\n<p>&nbsp;</p>\n<p><span><br/></span></p> <p></p><p id='n1'></p><p></p><p>B</p>",
+			"<p>A</p>\n<p>&nbsp;</p>\n <p id='n1'></p><p></p><p>B</p>"},
+		{"en", "<p>A</p><p>&nbsp;</p><p>B</p><div><p> </p></div><p><br/></p>",
+			"<p>A</p><p>&nbsp;</p><p>B</p><div><p> </p></div><p><br/></p>"},
+		{"en", "<p>A</p><p style='text-align:center'>* * *</p><center>◇◇◇</center><p><b>-x-x-</b></p><p>***<img src='x'/></p>",
+			`<p>A</p><hr class="scene-break"/><hr class="scene-break"/><hr class="scene-break"/><p>***<img src='x'/></p>`},
+	} {
+		got := string(Typography(testChapter(c.body), c.lang))
+		if want := string(testChapter(c.want)); got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.lang, got, want)
+		}
+	}
+
+	// The markup is left as-is.
+	content := testChapter("<p class=a>A<br>B</p><img src='x' / >")
+	if got := Typography(content, "en"); string(got) != string(content) {
+		t.Errorf("got\n%s", got)
+	}
+}
@@ -0,0 +1,275 @@
+package cleanup
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"strings"
+)
+
+// An attribute test of a compound selector: the attribute KEY exists
+// if OP is empty, otherwise its value compares to VAL with OP.
+type attrTest struct {
+	key, op, val string
+}
+
+// A compound selector, e.g., div.sharedaddy or p:has(a).
+type compound struct {
+	// Tag is the tag name, "" for any.
+	tag   string
+	tests []attrTest
+
+	// Has are the selectors a descendant should match.
+	has []Selector
+
+	// Parent is the compound selector the parent should match, nil
+	// for any.
+	parent *compound
+}
+
+// Selector is a comma separated list of compound selectors, see the
+// package documentation.
+type Selector []compound
+
+// Return the index of the first C in S outside of brackets, parentheses
+// and quotes, or -1.
+func indexTop(s string, c byte) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth--
+		case ch == c && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// Return true if C may be part of a name in a selector.
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '_'
+}
+
+// Return the name at the start of S and the rest of S.
+func cutName(s string) (string, string) {
+	i := 0
+	for i < len(s) && isNameChar(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// Return the attribute test in S, the inside of [...].
+func parseAttr(s string) (attrTest, error) {
+	key, rest := cutName(strings.TrimSpace(s))
+	if key == "" {
+		return attrTest{}, fmt.Errorf("no attribute name in [%s]", s)
+	}
+	t := attrTest{key: strings.ToLower(key)}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return t, nil
+	}
+	for _, op := range []string{"=", "^=", "$=", "*=", "~="} {
+		if strings.HasPrefix(rest, op) {
+			t.op = op
+			break
+		}
+	}
+	if t.op == "" {
+		return attrTest{}, fmt.Errorf("unsupported attribute test [%s]", s)
+	}
+	val := strings.TrimSpace(rest[len(t.op):])
+	if n := len(val); n >= 2 && (val[0] == '"' || val[0] == '\'') && val[n-1] == val[0] {
+		val = val[1 : n-1]
+	}
+	t.val = val
+	return t, nil
+}
+
+// Return the compound selector S.
+func parseCompound(s string) (compound, error) {
+	var c compound
+	if s == "" {
+		return c, fmt.Errorf("empty selector")
+	}
+	if s[0] == '*' {
+		s = s[1:]
+	} else {
+		c.tag, s = cutName(s)
+		c.tag = strings.ToLower(c.tag)
+	}
+	for s != "" {
+		switch {
+		case s[0] == '.' || s[0] == '#':
+			key, op := "class", "~="
+			if s[0] == '#' {
+				key, op = "id", "="
+			}
+			var name string
+			name, s = cutName(s[1:])
+			if name == "" {
+				return c, fmt.Errorf("no name after %s", key)
+			}
+			c.tests = append(c.tests, attrTest{key, op, name})
+		case s[0] == '[':
+			j := strings.IndexByte(s, ']')
+			if j < 0 {
+				return c, fmt.Errorf("unclosed [")
+			}
+			t, err := parseAttr(s[1:j])
+			if err != nil {
+				return c, err
+			}
+			c.tests = append(c.tests, t)
+			s = s[j+1:]
+		case strings.HasPrefix(s, ":has("):
+			depth, j := 0, -1
+			for k := 4; k < len(s) && j < 0; k++ {
+				switch s[k] {
+				case '(':
+					depth++
+				case ')':
+					depth--
+					if depth == 0 {
+						j = k
+					}
+				}
+			}
+			if j < 0 {
+				return c, fmt.Errorf("unclosed :has(")
+			}
+			sel, err := ParseSelector(s[5:j])
+			if err != nil {
+				return c, err
+			}
+			c.has = append(c.has, sel)
+			s = s[j+1:]
+		default:
+			return c, fmt.Errorf("unsupported %q", s)
+		}
+	}
+	return c, nil
+}
+
+// Return the compound selector S, with the selectors of its ancestors
+// before it separated by >.
+func parseChild(s string) (compound, error) {
+	var parent *compound
+	for {
+		i := indexTop(s, '>')
+		part := s
+		if i >= 0 {
+			part = s[:i]
+		}
+		c, err := parseCompound(strings.TrimSpace(part))
+		if err != nil {
+			return c, err
+		}
+		c.parent = parent
+		if i < 0 {
+			return c, nil
+		}
+		parent = &c
+		s = s[i+1:]
+	}
+}
+
+// Return the selector S.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for {
+		i := indexTop(s, ',')
+		part := s
+		if i >= 0 {
+			part = s[:i]
+		}
+		c, err := parseChild(part)
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %v", s, err)
+		}
+		sel = append(sel, c)
+		if i < 0 {
+			return sel, nil
+		}
+		s = s[i+1:]
+	}
+}
+
+// Return true if the value V of an attribute passes test T.
+func (t attrTest) pass(v string) bool {
+	switch t.op {
+	case "=":
+		return v == t.val
+	case "^=":
+		return strings.HasPrefix(v, t.val)
+	case "$=":
+		return strings.HasSuffix(v, t.val)
+	case "*=":
+		return strings.Contains(v, t.val)
+	case "~=":
+		for _, f := range strings.Fields(v) {
+			if f == t.val {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Return the value of attribute KEY of token T, and whether it is set.
+func attr(t html.Token, key string) (string, bool) {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// Return true if the element starting at token I of D matches C.
+func (c compound) match(d *document, i int) bool {
+	t := d.toks[i]
+	if c.tag != "" && t.Data != c.tag {
+		return false
+	}
+	for _, at := range c.tests {
+		if v, ok := attr(t, at.key); !ok || !at.pass(v) {
+			return false
+		}
+	}
+	if c.parent != nil && (d.parent[i] < 0 || !c.parent.match(d, d.parent[i])) {
+		return false
+	}
+	for _, sel := range c.has {
+		found := false
+		for k := i + 1; k <= d.end[i] && !found; k++ {
+			found = !d.drop[k] && d.isStart(k) && sel.match(d, k)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Return true if the element starting at token I of D matches S.
+func (s Selector) match(d *document, i int) bool {
+	for _, c := range s {
+		if c.match(d, i) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,324 @@
+package cleanup
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SceneBreakStylesheet styles the scene breaks made by Typography.
+var SceneBreakStylesheet = "hr.scene-break { border: 0; border-top: 1px solid; width: 25%; margin: 1.5em auto; }\n"
+
+// Scene breaks written as text without spaces, like "***", "◇◇◇" or
+// "-x-x-".  Ellipses and dashes are left alone, they are often a
+// paragraph of their own.
+var sceneBreakRe = regexp.MustCompile(`^(?:[*◇◆#~=•·♦☆★○●※+_×]{3,}|-?(?:[xo]-)+[xo]?)$`)
+
+// Return true if TEXT, the text of a paragraph, is a scene break.
+func IsSceneBreak(text string) bool {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, text)
+	return text != "" && sceneBreakRe.MatchString(text)
+}
+
+// The scene break that replaces the paragraphs of IsSceneBreak.
+var sceneBreak = []byte(`<hr class="scene-break"/>`)
+
+// A narrow no-break space, which French puts inside quotation marks.
+const nnbsp = "\u202f"
+
+// Quotes are the quotation marks of a language: the opening and
+// closing double quotes, then the single ones.
+type quotes struct {
+	open, close, open1, close1 string
+}
+
+// The quotation marks of each language, keyed by the language code in
+// lowercase, or its primary subtag.
+var languageQuotes = map[string]quotes{
+	"en":    {"“", "”", "‘", "’"},
+	"de":    {"„", "“", "‚", "‘"},
+	"fr":    {"«" + nnbsp, nnbsp + "»", "‹" + nnbsp, nnbsp + "›"},
+	"es":    {"«", "»", "“", "”"},
+	"it":    {"«", "»", "“", "”"},
+	"pt":    {"«", "»", "“", "”"},
+	"pt-br": {"“", "”", "‘", "’"},
+	"ru":    {"«", "»", "„", "“"},
+	"pl":    {"„", "”", "‚", "’"},
+	"ja":    {"「", "」", "『", "』"},
+	"zh":    {"“", "”", "‘", "’"},
+}
+
+// Return the quotation marks of language LANG, those of English if it
+// is unknown.
+func quotesFor(lang string) quotes {
+	lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+	if q, ok := languageQuotes[lang]; ok {
+		return q
+	}
+	primary, _, _ := strings.Cut(lang, "-")
+	if q, ok := languageQuotes[primary]; ok {
+		return q
+	}
+	return languageQuotes["en"]
+}
+
+// Elements whose text is left alone.
+var typographySkip = map[string]bool{
+	"code": true, "kbd": true, "pre": true, "samp": true, "script": true,
+	"style": true, "svg": true, "math": true, "tt": true,
+}
+
+// Elements that start and end a run of text, the quotes of a paragraph
+// do not carry over to the next one.
+var typographyBlocks = map[string]bool{
+	"blockquote": true, "body": true, "br": true, "dd": true, "div": true,
+	"dt": true, "figcaption": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "hr": true, "li": true, "p": true,
+	"td": true, "th": true,
+}
+
+// Elements a spacer paragraph or a scene break may have, anything
+// else is content.
+var spacerInline = map[string]bool{
+	"b": true, "br": true, "em": true, "font": true, "i": true, "s": true,
+	"small": true, "span": true, "strong": true, "sub": true, "sup": true,
+	"u": true,
+}
+
+var (
+	// Three or more dots, maybe with a space between them.
+	ellipsisRe = regexp.MustCompile(`\.(?:[ \x{a0}]?\.){2,}`)
+
+	// Runs of spaces with a no-break space in them.
+	nbspRunRe = regexp.MustCompile(`[ \x{a0}]*\x{a0}[ \x{a0}]*`)
+
+	// Runs of hyphens.
+	hyphensRe = regexp.MustCompile(`-{2,}`)
+)
+
+// The state of the quotes in a run of text.
+type quoteState struct {
+	// Prev is the last character written, 0 at the start of a run.
+	prev rune
+
+	// Double and single are the number of double and single
+	// quotes left open.
+	double, single int
+}
+
+// Return true if R may come before an opening quote.
+func isOpener(r rune) bool {
+	return r == 0 || unicode.IsSpace(r) || strings.ContainsRune("([{</“‘„‚«‹「『", r)
+}
+
+// Return TEXT with straight quotes made the quotation marks Q, and
+// update the state S.
+func smartQuotes(text string, q quotes, s *quoteState) string {
+	var b strings.Builder
+	i := 0
+	// Write MARK, and drop the spaces next to it if it comes with
+	// its own.
+	emit := func(mark string) {
+		if strings.HasPrefix(mark, nnbsp) {
+			trimmed := strings.TrimRight(b.String(), " ")
+			b.Reset()
+			b.WriteString(trimmed)
+		}
+		b.WriteString(mark)
+		if strings.HasSuffix(mark, nnbsp) {
+			for i < len(text) && text[i] == ' ' {
+				i++
+			}
+		}
+	}
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		var next rune
+		if i < len(text) {
+			next, _ = utf8.DecodeRuneInString(text[i:])
+		}
+		word := unicode.IsLetter(s.prev) || unicode.IsDigit(s.prev)
+		// A quote after a space closes, as in " Bonjour ", if one
+		// is open and no word follows.
+		closing := s.double > 0 && unicode.IsSpace(s.prev) &&
+			!unicode.IsLetter(next) && !unicode.IsDigit(next)
+		switch {
+		case r == '"' && isOpener(s.prev) && !closing:
+			s.double++
+			emit(q.open)
+		case r == '"':
+			if s.double > 0 {
+				s.double--
+			}
+			emit(q.close)
+		case r == '\'' && word && unicode.IsLetter(next):
+			// An apostrophe, as in don't.
+			b.WriteString("’")
+		case r == '\'' && !isOpener(s.prev):
+			if s.single > 0 {
+				s.single--
+				emit(q.close1)
+			} else {
+				b.WriteString("’")
+			}
+		case r == '\'' && unicode.IsDigit(next):
+			// An apostrophe, as in '90s.
+			b.WriteString("’")
+		case r == '\'':
+			s.single++
+			emit(q.open1)
+		default:
+			b.WriteRune(r)
+		}
+		if b.Len() > 0 {
+			s.prev, _ = utf8.DecodeLastRuneInString(b.String())
+		}
+	}
+	return b.String()
+}
+
+// Return TEXT with proper dashes and ellipses, and without runs of
+// no-break spaces.
+func punctuation(text string) string {
+	text = ellipsisRe.ReplaceAllString(text, "…")
+	text = hyphensRe.ReplaceAllStringFunc(text, func(h string) string {
+		// Longer runs are rules, not dashes.
+		if len(h) <= 3 {
+			return "—"
+		}
+		return h
+	})
+	text = strings.ReplaceAll(text, " - ", " – ")
+	return nbspRunRe.ReplaceAllStringFunc(text, func(s string) string {
+		// A single one is likely on purpose, as in Mr.&nbsp;Smith.
+		if s == "\u00a0" {
+			return s
+		}
+		return " "
+	})
+}
+
+// Return true if the element starting at token I of D has no elements
+// but those in spacerInline.
+func (d *document) onlyInline(i int) bool {
+	for k := i + 1; k <= d.end[i]; k++ {
+		if !d.drop[k] && d.isStart(k) && !spacerInline[d.toks[k].Data] {
+			return false
+		}
+	}
+	return true
+}
+
+// Return true if the element starting at token I of D is a spacer
+// paragraph: a p element with nothing but spaces and line breaks in
+// it, and no id an anchor might refer to.
+func (d *document) isSpacer(i int) bool {
+	if d.toks[i].Data != "p" || d.text(i) != "" || !d.onlyInline(i) {
+		return false
+	}
+	for k := i; k <= d.end[i]; k++ {
+		if _, ok := attr(d.toks[k], "id"); ok && !d.drop[k] && d.isStart(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return true if only spaces and left out tokens come between tokens
+// I and J of D.
+func (d *document) adjacent(i, j int) bool {
+	for k := i + 1; k < j; k++ {
+		if !d.drop[k] && (d.toks[k].Type != html.TextToken || strings.TrimSpace(d.toks[k].Data) != "") {
+			return false
+		}
+	}
+	return true
+}
+
+// Return true if the element starting at token I of D is a scene break
+// written as text, see IsSceneBreak.
+func (d *document) isSceneBreak(i int) bool {
+	if t := d.toks[i].Data; t != "p" && t != "div" && t != "center" {
+		return false
+	}
+	return d.onlyInline(i) && IsSceneBreak(d.text(i))
+}
+
+// Return CONTENT, an XHTML file in language LANG, with typographic
+// quotes, dashes and ellipses.  Runs of spacer paragraphs, like
+// <p>&nbsp;</p>, are collapsed to their first paragraph, and scene
+// breaks written as text, like ***, are made <hr class="scene-break"/>
+// elements, see SceneBreakStylesheet.  Only the text in the body is
+// changed, the rest of the markup is left as-is.
+func Typography(content []byte, lang string) []byte {
+	d := parse(content)
+	changed := false
+	// The end of the last spacer paragraph kept, -1 if none.
+	spacer := -1
+	for i := d.first; i <= d.last; i++ {
+		if d.drop[i] || d.toks[i].Type != html.StartTagToken {
+			continue
+		}
+		switch {
+		case d.isSpacer(i) && spacer >= 0 && d.adjacent(spacer, i):
+			d.remove(i)
+			spacer = d.end[i]
+			changed = true
+		case d.isSpacer(i):
+			spacer = d.end[i]
+		case d.isSceneBreak(i):
+			d.remove(i)
+			d.drop[i] = false
+			d.raw[i] = sceneBreak
+			changed = true
+		}
+	}
+
+	q := quotesFor(lang)
+	var s quoteState
+	skip := 0
+	for i := d.first; i <= d.last; i++ {
+		if d.drop[i] {
+			continue
+		}
+		t := d.toks[i]
+		switch t.Type {
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			if typographySkip[t.Data] && t.Type == html.StartTagToken {
+				skip++
+			} else if typographySkip[t.Data] && t.Type == html.EndTagToken && skip > 0 {
+				skip--
+			}
+			if typographyBlocks[t.Data] {
+				s = quoteState{}
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			if text := smartQuotes(punctuation(t.Data), q, &s); text != t.Data {
+				d.raw[i] = []byte(html.EscapeString(text))
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return content
+	}
+	var b bytes.Buffer
+	for i, raw := range d.raw {
+		if !d.drop[i] {
+			b.Write(raw)
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/email"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/sites"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Return the addresses in config.Config.Email.
+func mailAddresses() []string {
+	var to []string
+	for _, a := range strings.Split(config.Config.Email, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			to = append(to, a)
+		}
+	}
+	return to
+}
+
+// Extensions of the image files for each mimetype.
+var imageExtensions = map[string]string{
+	"image/gif":  ".gif",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// Return FILES with the images processed again according to
+// config.Config.Images.  An image whose mimetype changes is renamed to
+// have the extension of the new one, if it has an extension, and the
+// chapters are changed to refer to the new name.
+func shrinkImages(files []epub.File) []epub.File {
+	out := make([]epub.File, len(files))
+	renamed := make(map[string]string)
+	for i, f := range files {
+		if strings.HasPrefix(f.Mimetype, "image/") {
+			mimetype := f.Mimetype
+			f.Content, f.Mimetype = fetch.ImageProcess(f.Content, f.Mimetype)
+			ext, ok := imageExtensions[f.Mimetype]
+			if old := path.Ext(f.Filename); f.Mimetype != mimetype && old != "" && ok {
+				name := strings.TrimSuffix(f.Filename, old) + ext
+				renamed[path.Base(f.Filename)] = path.Base(name)
+				f.Filename = name
+			}
+		}
+		out[i] = f
+	}
+	if len(renamed) == 0 {
+		return out
+	}
+	var pairs []string
+	for old, name := range renamed {
+		pairs = append(pairs, "/"+old+`"`, "/"+name+`"`, `"`+old+`"`, `"`+name+`"`)
+	}
+	r := strings.NewReplacer(pairs...)
+	for i, f := range out {
+		if f.Mimetype == "application/xhtml+xml" || f.Mimetype == "text/css" {
+			out[i].Content = []byte(r.Replace(string(f.Content)))
+		}
+	}
+	return out
+}
+
+// Mail the file F of book B built on DATE to config.Config.Email.
+// If F is too large to mail, a copy of B with the images made smaller
+// by the profile in config.Config.Smtp.Shrink is mailed instead.
+func MailBook(f string, b sites.Book, date time.Time) error {
+	conf := config.Config.Smtp
+	info, err := os.Stat(f)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot mail %s, it is a directory", f)
+	}
+	mailed := f
+	if email.Size(info.Size()) > email.MaxSize(conf) {
+		if conf.Shrink == "" {
+			return fmt.Errorf("%s is too large to mail, set smtp.shrink to a profile making it smaller", f)
+		}
+		p, err := config.ProfileFor(conf.Shrink)
+		if err != nil {
+			return err
+		}
+		progress.Logf("%s is too large to mail, shrinking its images with profile %s", f, conf.Shrink)
+		dir, err := os.MkdirTemp("", "ln2epub")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		saved := config.Config.Images
+		config.Config.Images = p.Images
+		b.Files = shrinkImages(b.Files)
+		config.Config.Images = saved
+		mailed = filepath.Join(dir, filepath.Base(f))
+		if err := writeBookFile(mailed, b, date); err != nil {
+			return err
+		}
+		info, err := os.Stat(mailed)
+		if err != nil {
+			return err
+		}
+		if n, max := email.Size(info.Size()), email.MaxSize(conf); n > max {
+			return fmt.Errorf("%s is still too large to mail after shrinking its images with profile %s, %d bytes with at most %d",
+				f, conf.Shrink, n, max)
+		}
+	}
+	to := mailAddresses()
+	if err := email.Send(conf, to, b.Title(), mailed); err != nil {
+		return fmt.Errorf("mailing %s: %v", f, err)
+	}
+	progress.Mailed(f, b.Title(), strings.Join(to, ", "))
+	return nil
+}
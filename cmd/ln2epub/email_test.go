@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/email/emailtest"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/sites"
+	"image"
+	"image/png"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Return a PNG image of W x H pixels of noise, which compresses badly.
+func testNoise(w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestMailBookShrink(t *testing.T) {
+	saved, savedProgress := config.Config, progress.Default
+	defer func() { config.Config, progress.Default = saved, savedProgress }()
+	progress.Default = &progress.Reporter{Level: progress.Quiet, Out: io.Discard, Result: io.Discard}
+	s := emailtest.NewServer()
+	defer s.Close()
+	conf := s.Conf()
+	conf.From = "me@example.com"
+	conf.Shrink = "tiny"
+	config.Config.Smtp = conf
+	config.Config.Email = "me@kindle.com"
+	config.Config.Profiles = map[string]config.Profile{
+		"tiny": {Images: config.Images{MaxWidth: 40, MaxHeight: 40}},
+	}
+
+	date := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	b := sites.Book{Series: "Foo", Files: []epub.File{{
+		Title:    "Chapter 1",
+		Id:       "Chapter1",
+		Filename: "OEBPS/Text/Chapter1.xhtml",
+		Mimetype: "application/xhtml+xml",
+		Content: []byte(epub.ContentPreamble("Chapter 1") +
+			`<p><img src="../Images/Img1_Ch1" alt=""/></p>` + epub.ContentEnd()),
+	}, {
+		Id:       "Img1_Ch1",
+		Filename: "OEBPS/Images/Img1_Ch1",
+		Mimetype: "image/png",
+		Content:  testNoise(400, 400),
+	}}}
+	f := filepath.Join(t.TempDir(), "Foo.epub")
+	if err := writeBookFile(f, b, date); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Too large as it is, small enough after shrinking.
+	config.Config.Smtp.MaxSize = float64(info.Size()) / 2 / (1 << 20)
+	if err := MailBook(f, b, date); err != nil {
+		t.Fatal(err)
+	}
+	msgs := s.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages", len(msgs))
+	}
+	if n := int64(len(msgs[0].Data)); n > info.Size()/2 {
+		t.Errorf("got a message of %d bytes for a book of %d", n, info.Size())
+	}
+	// The book file is left as-is.
+	if after, err := os.Stat(f); err != nil || after.Size() != info.Size() {
+		t.Errorf("the book file changed, %v", err)
+	}
+
+	// Too large even after shrinking.
+	config.Config.Smtp.MaxSize = 0.001
+	err = MailBook(f, b, date)
+	if err == nil || !strings.Contains(err.Error(), "still too large") {
+		t.Errorf("got error %v", err)
+	}
+	if len(s.Messages()) != 1 {
+		t.Error("the book was mailed")
+	}
+
+	// Nothing to shrink with.
+	config.Config.Smtp.Shrink = ""
+	if err := MailBook(f, b, date); err == nil || !strings.Contains(err.Error(), "smtp.shrink") {
+		t.Errorf("got error %v", err)
+	}
+}
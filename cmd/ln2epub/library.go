@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/9viz/ln2epub/cleanup"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/export"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/hook"
+	"github.com/9viz/ln2epub/library"
+	"github.com/9viz/ln2epub/notify"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/sites"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Return the library in FILENAME, or the default library file if
+// empty.  Exit if it cannot be read.
+func loadLibrary(filename string) *library.Library {
+	if filename == "" {
+		filename = library.DefaultFile()
+	}
+	l, err := library.Load(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return l
+}
+
+// Write the series in library L to W.
+func listLibrary(w io.Writer, l *library.Library) {
+	for _, s := range l.Series {
+		n := 0
+		for _, v := range s.Toc.Volumes {
+			n += len(v.Chapters)
+		}
+		fmt.Fprintf(w, "%s (%s)\n  %s\n  %d chapters, synced %s\n",
+			s.Title, s.Site, s.Url, n, s.Synced.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+// Run the subscribe command with arguments ARGS.
+func SubscribeMain(args []string) {
+	flags := flag.NewFlagSet("subscribe", flag.ExitOnError)
+	libraryFile := flags.String("library", "", "library `file` (default "+library.DefaultFile()+")")
+	configFile := flags.String("config", "", "configuration `file` (default "+config.Path()+")")
+	outputDir := flags.String("output-dir", "", "directory to write the epub files of the series to")
+	nameTemplate := flags.String("name-template", "", "template for the epub filenames of the series")
+	epubVersion := flags.Int("epub-version", 0, "epub version of the series, 2 or 3")
+	format := flags.String("format", "", "output `format` of the series: "+strings.Join(export.Formats, ", "))
+	profile := flags.String("profile", "", "device `profile` of the series: "+strings.Join(config.ProfileNames(), ", "))
+	fromStart := flags.Bool("from-start", false, "count every chapter as new so that the next sync builds the whole series")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), `usage: ln2epub subscribe [flags] URL...
+       ln2epub subscribe            (list the subscribed series)`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	l := loadLibrary(*libraryFile)
+	if flags.NArg() == 0 {
+		listLibrary(os.Stdout, l)
+		return
+	}
+
+	if err := config.Load(*configFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *epubVersion != 0 && *epubVersion != 2 && *epubVersion != 3 {
+		fmt.Fprintln(os.Stderr, "epub version should be 2 or 3")
+		os.Exit(1)
+	}
+	if *format != "" {
+		if err := export.Check(*format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *nameTemplate != "" {
+		if _, err := sites.BookFileName(*nameTemplate, sites.Book{Series: "x"}, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *profile != "" {
+		if _, err := config.ProfileFor(*profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	opts := library.Options{
+		OutputDir:    *outputDir,
+		NameTemplate: *nameTemplate,
+		EpubVersion:  *epubVersion,
+		Format:       *format,
+		Profile:      *profile,
+	}
+
+	failed := false
+	for _, u := range flags.Args() {
+		if l.Find(u) >= 0 {
+			progress.Error(fmt.Errorf("already subscribed to %s", u))
+			failed = true
+			continue
+		}
+		toc, err := sites.TableOfContents(u)
+		if err != nil {
+			progress.Error(err)
+			failed = true
+			continue
+		}
+		s := library.Series{Url: u, Site: toc.Site, Title: toc.Series, Options: opts, Toc: toc}
+		if *fromStart {
+			s.Toc.Volumes = nil
+		}
+		if err := l.Subscribe(s); err != nil {
+			progress.Error(err)
+			failed = true
+			continue
+		}
+		progress.Logf("Subscribed to %s", toc.Series)
+	}
+	if err := l.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Run the unsubscribe command with arguments ARGS.
+func UnsubscribeMain(args []string) {
+	flags := flag.NewFlagSet("unsubscribe", flag.ExitOnError)
+	libraryFile := flags.String("library", "", "library `file` (default "+library.DefaultFile()+")")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: ln2epub unsubscribe [-library FILE] URL...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	l := loadLibrary(*libraryFile)
+	failed := false
+	for _, u := range flags.Args() {
+		if err := l.Unsubscribe(u); err != nil {
+			progress.Error(err)
+			failed = true
+		}
+	}
+	if err := l.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Set config.Config from the options OPTS of a series.
+// Return a function restoring the previous configuration.
+func applyOptions(opts library.Options) (func(), error) {
+	saved := config.Config
+	restore := func() { config.Config = saved }
+	// Before the other options so that they override the profile.
+	if err := config.ApplyProfile(opts.Profile); err != nil {
+		restore()
+		return nil, err
+	}
+	if opts.OutputDir != "" {
+		config.Config.OutputDir = opts.OutputDir
+	}
+	if opts.NameTemplate != "" {
+		config.Config.NameTemplate = opts.NameTemplate
+	}
+	if opts.EpubVersion != 0 {
+		config.Config.EpubVersion = opts.EpubVersion
+	}
+	if opts.Format != "" {
+		config.Config.Format = opts.Format
+	}
+	// The books are rebuilt with the new chapters.
+	config.Config.OnConflict = sites.BookOverwrite
+	return restore, nil
+}
+
+// Return the books in BOOKS affected by CHANGES, and the new chapters
+// in each.  Books are matched to the changed volumes by title.  The
+// chapters of the volumes matching no book, as when the adapter names
+// its volumes differently from the table of contents, go to the last
+// book.
+func changedBooks(books []sites.Book, changes []library.Change) ([]sites.Book, [][]sites.TocChapter) {
+	if len(books) == 0 {
+		return nil, nil
+	}
+	chs := make([][]sites.TocChapter, len(books))
+	for _, c := range changes {
+		i := len(books) - 1
+		for j, b := range books {
+			if b.Volume == c.Volume {
+				i = j
+				break
+			}
+		}
+		chs[i] = append(chs[i], c.Chapters...)
+	}
+	var changed []sites.Book
+	var chapters [][]sites.TocChapter
+	for i, b := range books {
+		if len(chs[i]) > 0 {
+			changed = append(changed, b)
+			chapters = append(chapters, chs[i])
+		}
+	}
+	return changed, chapters
+}
+
+// Sync series S, building the books with new chapters on DATE.
+// If DRYRUN is true, only report the new chapters.
+func syncSeries(s *library.Series, date time.Time, dryRun bool) ([]library.Update, error) {
+	restore, err := applyOptions(s.Options)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	toc, err := sites.TableOfContents(s.Url)
+	if err != nil {
+		return nil, err
+	}
+	changes := library.Diff(s.Toc, toc)
+	var updates []library.Update
+	if dryRun {
+		for _, c := range changes {
+			updates = append(updates, library.Update{
+				Series: toc.Series, Url: s.Url, Volume: c.Volume, Chapters: c.Chapters,
+			})
+		}
+		return updates, nil
+	}
+	if len(changes) > 0 {
+		books, err := sites.Books(s.Url)
+		if err != nil {
+			return nil, err
+		}
+		changed, chapters := changedBooks(books, changes)
+		for i, b := range changed {
+			f, err := WriteBook(b, date)
+			if err != nil {
+				return updates, err
+			}
+			if f != "" {
+				// Leave the series unsynced so that the next
+				// sync builds the book again.
+				if err := hook.All(b, date, f); err != nil {
+					return updates, err
+				}
+			}
+			if f != "" && config.Config.Email != "" {
+				if err := MailBook(f, b, date); err != nil {
+					progress.Error(err)
+				}
+			}
+			updates = append(updates, library.Update{
+				Series: b.Series, Url: s.Url, Volume: b.Volume, Chapters: chapters[i], File: f,
+			})
+		}
+	}
+	s.Title = toc.Series
+	s.Toc = toc
+	s.Synced = time.Now().UTC().Truncate(time.Second)
+	return updates, nil
+}
+
+// Write the report of UPDATES to W.
+func syncReport(w io.Writer, updates []library.Update) {
+	for _, u := range updates {
+		title := sites.Book{Series: u.Series, Volume: u.Volume}.Title()
+		fmt.Fprintf(w, "%s: %d new chapters\n", title, len(u.Chapters))
+		for _, ch := range u.Chapters {
+			fmt.Fprintf(w, "  %s\n", ch.Title)
+		}
+		if u.File != "" {
+			fmt.Fprintf(w, "  -> %s\n", u.File)
+		}
+	}
+}
+
+// Run the sync command with arguments ARGS.
+func SyncMain(args []string) {
+	os.Exit(syncRun(args))
+}
+
+// Run the sync command with arguments ARGS, and return the exit
+// status.  The cookies are saved before SyncMain exits.
+func syncRun(args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	libraryFile := flags.String("library", "", "library `file` (default "+library.DefaultFile()+")")
+	configFile := flags.String("config", "", "configuration `file` (default "+config.Path()+")")
+	dryRun := flags.Bool("dry-run", false, "only report the new chapters, do not build or update the library")
+	jsonReport := flags.Bool("json", false, "write the report as JSON")
+	quiet := flags.Bool("quiet", false, "only report errors and new chapters")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), `usage: ln2epub sync [flags] [URL...]
+
+Check the subscribed series, or only the series URL..., for new
+chapters and rebuild the books that have them.  The notifiers in the
+configuration are told of each book rebuilt.  Nothing is written to
+stdout if there are no new chapters, so this is suitable for cron.
+The books are dated with SOURCE_DATE_EPOCH if set, as with ln2epub.`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	l := loadLibrary(*libraryFile)
+	for _, u := range flags.Args() {
+		if l.Find(u) < 0 {
+			fmt.Fprintf(os.Stderr, "not subscribed to %s\n", u)
+			return 1
+		}
+	}
+
+	if err := config.Load(*configFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := config.CheckProxy(config.Config.Proxy); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := export.Check(config.Config.Format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cleanup.Check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, h := range config.Config.Hooks {
+		if err := hook.Check(h); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if err := fetch.CookiesInit(""); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer fetch.CookiesSave()
+	if *quiet {
+		progress.Default.Level = progress.Quiet
+	}
+	// The report is the result, keep stdout for it.
+	progress.Default.Result = progress.Default.Out
+
+	date, err := sites.BuildDate("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var updates []library.Update
+	failed := false
+	for i := range l.Series {
+		s := &l.Series[i]
+		if flags.NArg() > 0 && !contains(flags.Args(), s.Url) {
+			continue
+		}
+		progress.Logf("Syncing %s", s.Title)
+		u, err := syncSeries(s, date, *dryRun)
+		updates = append(updates, u...)
+		for _, up := range u {
+			if up.File != "" && !notify.All(up) {
+				failed = true
+			}
+		}
+		if err != nil {
+			progress.Error(err)
+			failed = true
+			continue
+		}
+		if !*dryRun {
+			// Save after each series so that an interrupted sync
+			// does not build the same chapters again.
+			if err := l.Save(); err != nil {
+				progress.Error(err)
+				return 1
+			}
+		}
+	}
+
+	if *jsonReport {
+		if len(updates) > 0 {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(updates)
+		}
+	} else {
+		syncReport(os.Stdout, updates)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// Return true if S is in SS.
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/9viz/ln2epub/library"
+	"github.com/9viz/ln2epub/sites"
+	"reflect"
+	"testing"
+)
+
+func TestChangedBooks(t *testing.T) {
+	a := []sites.TocChapter{{Title: "A", Url: "/a"}}
+	b := []sites.TocChapter{{Title: "B", Url: "/b"}}
+	for _, c := range []struct {
+		name    string
+		volumes []string
+		changes []library.Change
+		// Want are the volumes of the changed books and their
+		// chapters.
+		want     []string
+		chapters [][]sites.TocChapter
+	}{{
+		"single volume",
+		[]string{""},
+		[]library.Change{{Volume: "", Chapters: a}},
+		[]string{""},
+		[][]sites.TocChapter{a},
+	}, {
+		"multiple volumes",
+		[]string{"Volume 1", "Volume 2", "Volume 3"},
+		[]library.Change{{Volume: "Volume 2", Chapters: a}, {Volume: "Volume 3", New: true, Chapters: b}},
+		[]string{"Volume 2", "Volume 3"},
+		[][]sites.TocChapter{a, b},
+	}, {
+		"renamed volume",
+		[]string{"Volume 1", "Volume 2"},
+		[]library.Change{{Volume: "Vol. 2", Chapters: a}},
+		[]string{"Volume 2"},
+		[][]sites.TocChapter{a},
+	}, {
+		"some volumes renamed",
+		[]string{"Volume 1", "Volume 2"},
+		[]library.Change{{Volume: "Volume 1", Chapters: a}, {Volume: "Side Stories", Chapters: b}},
+		[]string{"Volume 1", "Volume 2"},
+		[][]sites.TocChapter{a, b},
+	}, {
+		"renamed and last volume",
+		[]string{"Volume 1", "Volume 2"},
+		[]library.Change{{Volume: "Volume 2", Chapters: a}, {Volume: "Side Stories", Chapters: b}},
+		[]string{"Volume 2"},
+		[][]sites.TocChapter{append(append([]sites.TocChapter(nil), a...), b...)},
+	}, {
+		"no books",
+		nil,
+		[]library.Change{{Volume: "Volume 1", Chapters: a}},
+		nil,
+		nil,
+	}} {
+		var books []sites.Book
+		for _, v := range c.volumes {
+			books = append(books, sites.Book{Series: "Foo", Volume: v})
+		}
+		changed, chapters := changedBooks(books, c.changes)
+		var got []string
+		for _, b := range changed {
+			got = append(got, b.Volume)
+		}
+		if !reflect.DeepEqual(got, c.want) || !reflect.DeepEqual(chapters, c.chapters) {
+			t.Errorf("%s: got %q with %v, want %q with %v", c.name, got, chapters, c.want, c.chapters)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/sites"
+	"io"
+	"os"
+)
+
+// Write TOCS to W as human readable text.
+func ListText(w io.Writer, tocs []sites.Toc) {
+	for i, toc := range tocs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%s)\n%s\n", toc.Series, toc.Site, toc.Url)
+		for _, vol := range toc.Volumes {
+			indent := "  "
+			if vol.Title != "" {
+				fmt.Fprintf(w, "\n  %s\n", vol.Title)
+				indent = "    "
+			}
+			if vol.Cover != "" {
+				fmt.Fprintf(w, "%sCover: %s\n", indent, vol.Cover)
+			}
+			for n, ch := range vol.Chapters {
+				fmt.Fprintf(w, "%s%d. %s\n%s   %s\n",
+					indent, n+1, ch.Title, indent, ch.Url)
+			}
+		}
+	}
+}
+
+// Write TOCS to W as JSON.
+func ListJson(w io.Writer, tocs []sites.Toc) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tocs)
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Type     string        `xml:"type,attr,omitempty"`
+	Url      string        `xml:"url,attr,omitempty"`
+	Cover    string        `xml:"cover,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opml struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Body    []opmlOutline `xml:"body>outline"`
+}
+
+// Write TOCS to W as an OPML outline.
+// Each series is an outline containing its volumes, which in turn
+// contain the chapters as links.  Series with no volumes have the
+// chapters directly under them.
+func ListOpml(w io.Writer, tocs []sites.Toc) error {
+	doc := opml{Version: "2.0", Title: "ln2epub"}
+	for _, toc := range tocs {
+		series := opmlOutline{Text: toc.Series, Type: "link", Url: toc.Url}
+		for _, vol := range toc.Volumes {
+			var chs []opmlOutline
+			for _, ch := range vol.Chapters {
+				chs = append(chs,
+					opmlOutline{Text: ch.Title, Type: "link", Url: ch.Url})
+			}
+			if vol.Title == "" {
+				series.Cover = vol.Cover
+				series.Outlines = append(series.Outlines, chs...)
+				continue
+			}
+			series.Outlines = append(series.Outlines,
+				opmlOutline{Text: vol.Title, Cover: vol.Cover, Outlines: chs})
+		}
+		doc.Body = append(doc.Body, series)
+	}
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Run the list command with arguments ARGS.
+func ListMain(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text, json or opml")
+	configFile := flags.String("config", "", "configuration `file` (default "+config.Path()+")")
+	proxy := flags.String("proxy", "", "proxy `URL` for all requests")
+	cookies := flags.String("cookies", "", "import cookies from Netscape cookies.txt `file`")
+	ignoreRobots := flags.Bool("ignore-robots", false, "do not honour robots.txt")
+	replay := flags.String("replay", "", "answer requests from the archive `file` made by ln2epub record")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: ln2epub list [-format text|json|opml] URL...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	if err := config.Load(*configFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *proxy != "" {
+		config.Config.Proxy = *proxy
+	}
+	if *ignoreRobots {
+		config.Config.IgnoreRobots = true
+	}
+	if err := config.CheckProxy(config.Config.Proxy); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := fetch.CookiesInit(*cookies); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *replay != "" {
+		if err := fetch.ReplayStart(*replay); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var tocs []sites.Toc
+	for _, u := range flags.Args() {
+		toc, err := sites.TableOfContents(u)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		tocs = append(tocs, toc)
+	}
+	fetch.CookiesSave()
+
+	var err error
+	switch *format {
+	case "text":
+		ListText(os.Stdout, tocs)
+	case "json":
+		err = ListJson(os.Stdout, tocs)
+	case "opml":
+		err = ListOpml(os.Stdout, tocs)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
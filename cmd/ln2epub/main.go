@@ -0,0 +1,341 @@
+// Scrape LN TL sites and convert to Epub.
+// Licensed under BSD 2-Clause License.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/9viz/ln2epub/cleanup"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/export"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/hook"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/sites"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "list" {
+		ListMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		ServeMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "subscribe" {
+		SubscribeMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "unsubscribe" {
+		UnsubscribeMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		SyncMain(os.Args[2:])
+		return
+	}
+	// `record' is -record with a default archive.
+	if len(os.Args) > 1 && os.Args[1] == "record" {
+		os.Args = append([]string{os.Args[0], "-record", fetch.RecordDefaultFile}, os.Args[2:]...)
+	}
+
+	os.Exit(run())
+}
+
+// Build the books of the series given on the command line, and return
+// the exit status.  The deferred saves of the cookies and the archive
+// happen before main exits.
+func run() int {
+	configFile := flag.String("config", "", "configuration `file` (default "+config.Path()+")")
+	outputDir := flag.String("output-dir", ".", "directory to write the epub files to")
+	nameTemplate := flag.String("name-template", config.DefaultNameTemplate,
+		"template for the epub filenames; fields are {site}, {series}, {volume},\n"+
+			"{title}, {author}, {first}, {last}, {chapters} and {date}")
+	onConflict := flag.String("on-conflict", sites.BookOverwrite,
+		"what to do if the epub file exists: overwrite, skip or rename")
+	epubVersion := flag.Int("epub-version", 2, "epub version, 2 or 3")
+	format := flag.String("format", "epub", "output `format`: "+strings.Join(export.Formats, ", "))
+	profile := flag.String("profile", "", "device `profile` for images, epub version and stylesheets: "+
+		strings.Join(config.ProfileNames(), ", ")+", or one in the configuration")
+	splitChapters := flag.Bool("split-chapters", false, "write each chapter of md and txt books to its own file")
+	typography := flag.Bool("typography", false, "use typographic quotes, dashes and ellipses, and mark scene breaks")
+	externalImages := flag.Bool("external-images", false, "write the images of html books next to the file instead of inlining them")
+	mailTo := flag.String("email", "", "mail the books to the `addresses`, separated by commas, through the SMTP server in the configuration")
+	concurrency := flag.Int("concurrency", 1, "number of pages to fetch in parallel")
+	proxy := flag.String("proxy", "", "proxy `URL` for all requests, e.g., socks5://127.0.0.1:9050")
+	cookies := flag.String("cookies", "", "import cookies from Netscape cookies.txt `file`")
+	saveCookies := flag.Bool("save-cookies", true, "save the cookies received to the cookie file in the configuration")
+	password := flag.String("password", "", "password for password protected posts of the series without one in the configuration")
+	ignoreRobots := flag.Bool("ignore-robots", false, "do not honour robots.txt")
+	quiet := flag.Bool("quiet", false, "only report errors and created files")
+	verbose := flag.Bool("verbose", false, "also report every request")
+	jsonEvents := flag.Bool("json", false, "write progress events as JSON lines to stdout")
+	logFile := flag.String("log", "", "also write every progress event to `file`")
+	record := flag.String("record", "", "record every request and response to the archive `file`")
+	placeholders := flag.Bool("placeholder-images", false, "record images as small placeholders")
+	replay := flag.String("replay", "", "answer requests from the archive `file` instead of the network")
+	buildDate := flag.String("date", "", "`date` of the books, like 2006-01-02, instead of $SOURCE_DATE_EPOCH or now")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), `usage: ln2epub [flags] URL...
+       ln2epub list [-format text|json|opml] URL...
+       ln2epub serve [-addr ADDRESS] [-dir DIRECTORY] [-opds DIRECTORY]
+       ln2epub subscribe [flags] [URL...]
+       ln2epub unsubscribe [-library FILE] URL...
+       ln2epub sync [-dry-run] [-json] [URL...]
+       ln2epub record [flags] URL...   (same as -record `+fetch.RecordDefaultFile+`)
+
+The books are dated with -date, or the SOURCE_DATE_EPOCH environment
+variable, in seconds since 1970, if set, or the current time.  Books
+built twice with the same date are byte-identical.`)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return 1
+	}
+
+	if err := config.Load(*configFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// Before the other flags so that they override the profile.
+	if err := config.ApplyProfile(*profile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "output-dir":
+			config.Config.OutputDir = *outputDir
+		case "name-template":
+			config.Config.NameTemplate = *nameTemplate
+		case "on-conflict":
+			config.Config.OnConflict = *onConflict
+		case "epub-version":
+			config.Config.EpubVersion = *epubVersion
+		case "format":
+			config.Config.Format = *format
+		case "external-images":
+			config.Config.ExternalImages = *externalImages
+		case "split-chapters":
+			config.Config.SplitChapters = *splitChapters
+		case "typography":
+			config.Config.Typography = *typography
+		case "email":
+			config.Config.Email = *mailTo
+		case "concurrency":
+			config.Config.Concurrency = *concurrency
+		case "proxy":
+			config.Config.Proxy = *proxy
+		case "ignore-robots":
+			config.Config.IgnoreRobots = *ignoreRobots
+		}
+	})
+	if err := config.CheckProxy(config.Config.Proxy); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := fetch.CookiesInit(*cookies); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *saveCookies {
+		defer fetch.CookiesSave()
+	}
+
+	if *record != "" && *replay != "" {
+		fmt.Fprintln(os.Stderr, "cannot record and replay at the same time")
+		return 1
+	}
+	if *replay != "" {
+		if err := fetch.ReplayStart(*replay); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *record != "" {
+		fetch.RecordStart(*placeholders)
+		// Also save when something panics, broken series are
+		// what the archives are for.
+		defer func() {
+			if err := fetch.Recorder.Save(*record); err != nil {
+				progress.Error(err)
+			} else {
+				progress.Logf("Recorded %d requests to %s", fetch.Recorder.Len(), *record)
+			}
+		}()
+	}
+
+	switch {
+	case *quiet:
+		progress.Default.Level = progress.Quiet
+	case *verbose:
+		progress.Default.Level = progress.Verbose
+	}
+	if *jsonEvents {
+		progress.Default.Json = true
+		progress.Default.Out = os.Stdout
+	}
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		progress.Default.Log = f
+	}
+
+	date, err := sites.BuildDate(*buildDate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := sites.BookFileName(config.Config.NameTemplate, sites.Book{Series: "x"}, date); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch config.Config.OnConflict {
+	case sites.BookOverwrite, sites.BookSkip, sites.BookRename:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown collision policy %q\n", config.Config.OnConflict)
+		return 1
+	}
+	if config.Config.EpubVersion != 2 && config.Config.EpubVersion != 3 {
+		fmt.Fprintln(os.Stderr, "epub version should be 2 or 3")
+		return 1
+	}
+	if err := export.Check(config.Config.Format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if config.Config.Email != "" && config.Config.Smtp.Host == "" {
+		fmt.Fprintln(os.Stderr, "no SMTP server to mail the books through in the configuration")
+		return 1
+	}
+	if err := cleanup.Check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, h := range config.Config.Hooks {
+		if err := hook.Check(h); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	for _, u := range flag.Args() {
+		if *password != "" && config.Config.Series[u].Password == "" {
+			if config.Config.Series == nil {
+				config.Config.Series = make(map[string]config.Series)
+			}
+			c := config.Config.Series[u]
+			c.Password = *password
+			config.Config.Series[u] = c
+		}
+
+		books, err := sites.Books(u)
+		if err != nil {
+			progress.Error(err)
+			continue
+		}
+
+		for _, b := range books {
+			f, err := WriteBook(b, date)
+			if err != nil {
+				progress.Error(err)
+				return 1
+			}
+			if f != "" {
+				if err := hook.All(b, date, f); err != nil {
+					progress.Error(err)
+					return 1
+				}
+			}
+			if f != "" && config.Config.Email != "" {
+				if err := MailBook(f, b, date); err != nil {
+					progress.Error(err)
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// Write the file for book B built on DATE in config.Config.Format.
+// The filename is made from config.Config.NameTemplate under
+// config.Config.OutputDir, and an existing file is handled according
+// to config.Config.OnConflict.  Return the filename, or "" if the
+// file was skipped.
+func WriteBook(b sites.Book, date time.Time) (string, error) {
+	var f string
+	name, err := sites.BookFileName(config.Config.NameTemplate, b, date)
+	if err == nil {
+		name = export.FileName(filepath.Join(config.Config.OutputDir, name), config.Config.Format)
+		if config.Config.SplitChapters && (config.Config.Format == export.FormatMarkdown ||
+			config.Config.Format == export.FormatText) {
+			// A directory of chapters.
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		f, err = sites.BookResolveCollision(name, config.Config.OnConflict)
+	}
+	if err != nil {
+		return "", err
+	}
+	if f == "" {
+		progress.Skipped(name, b.Title())
+		return "", nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+		return "", err
+	}
+	if err := writeBookFile(f, b, date); err != nil {
+		return "", err
+	}
+	progress.Created(f, b.Title())
+	return f, nil
+}
+
+// Write the file F for book B built on DATE in config.Config.Format.
+func writeBookFile(f string, b sites.Book, date time.Time) error {
+	css := config.Config.Css
+	if config.Config.Typography {
+		// First, so that the configured stylesheet may restyle
+		// the scene breaks.
+		css = cleanup.SceneBreakStylesheet + css
+	}
+	if css != "" {
+		b.Files = export.AddStylesheet(b.Files, css)
+	}
+	meta := sites.BookMetadata(b, date)
+	switch config.Config.Format {
+	case export.FormatHtml:
+		return export.HtmlFile(f, meta, b.Files, config.Config.ExternalImages)
+	case export.FormatMarkdown, export.FormatText:
+		return export.TextFile(f, config.Config.Format, meta, b.Files, export.TextOptions{
+			Width: config.Config.TextWidth,
+			Split: config.Config.SplitChapters,
+		})
+	case export.FormatFb2:
+		return export.Fb2File(f, meta, b.Files)
+	case export.FormatCbz:
+		return export.CbzFile(f, meta, b.Files)
+	case export.FormatKepub:
+		return epub.CreateFile(f, epub.AddExtra(meta, export.Kepub(b.Files)), date)
+	}
+	return epub.CreateFile(f, sites.BookEpubFiles(b, date), date)
+}
+
+// Local Variables:
+// compile-command: "go build"
+// outline-regexp: "// \\(\\*+\\) \\|^func \\|^type "
+// eval: (outline-minor-mode)
+// eval: (reveal-mode)
+// End:
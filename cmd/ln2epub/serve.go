@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/9viz/ln2epub/cleanup"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/opds"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/serve"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Run the serve command with arguments ARGS.
+func ServeMain(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "`address` to listen on")
+	dir := flags.String("dir", config.DataPath("serve"), "`directory` to keep the jobs and their files in")
+	jobs := flags.Int("jobs", 2, "number of jobs to run in parallel")
+	maxAge := flags.Duration("max-age", 7*24*time.Hour, "remove finished jobs after this `duration`, 0 to keep them")
+	configFile := flags.String("config", "", "configuration `file` for the jobs (default "+config.Path()+")")
+	opdsDir := flags.String("opds", "", "publish the epub files in `directory` as an OPDS catalog at /opds")
+	quiet := flags.Bool("quiet", false, "only report errors")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: ln2epub serve [-addr ADDRESS] [-dir DIRECTORY] [-opds DIRECTORY]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	if *quiet {
+		progress.Default.Level = progress.Quiet
+	}
+	// Check the configuration now rather than in every job.
+	if err := config.Load(*configFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := cleanup.Check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *opdsDir != "" {
+		if _, err := os.Stat(*opdsDir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	s, err := serve.NewServer(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	s.Jobs = *jobs
+	s.MaxAge = *maxAge
+	if *configFile != "" {
+		s.Args = []string{"-config", *configFile}
+	}
+	s.Start()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s.Handler())
+	if *opdsDir != "" {
+		catalog := opds.NewCatalog(*opdsDir, "/opds")
+		mux.Handle("/opds", catalog)
+		mux.Handle("/opds/", catalog)
+	}
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	// Stop the running jobs on interrupt so that they are run again
+	// on the next start.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		srv.Close()
+	}()
+
+	progress.Logf("Listening on http://%s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		progress.Error(err)
+		s.Close()
+		os.Exit(1)
+	}
+	s.Close()
+}
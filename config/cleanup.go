@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule is a cleanup rule for the chapters of a book, see package
+// cleanup.  Exactly one of Drop, DropText, Truncate and Strip should
+// be set.
+type Rule struct {
+	// Drop is a selector of the elements to remove.
+	Drop string `toml:"drop"`
+
+	// DropText is a regular expression, and the elements matching
+	// Select whose text matches it are removed.
+	DropText string `toml:"drop_text"`
+
+	// Truncate is a selector of the element marking the end of
+	// the chapter.  It and everything after it are removed.
+	Truncate string `toml:"truncate"`
+
+	// Strip are the attributes removed from the elements matching
+	// Select.
+	Strip []string `toml:"strip"`
+
+	// Select is a selector of the elements DropText and Strip
+	// apply to.  If empty, DropText applies to p elements and
+	// Strip to all elements.
+	Select string `toml:"select"`
+}
+
+// The text of navigation paragraphs and of requests for support.
+const (
+	ruleNavigation = `(?i)^\W*((previous|prev|next)( chapter| page)?|index|home|(table of )?contents|toc)(\W+((previous|prev|next)( chapter| page)?|index|home|(table of )?contents|toc))*\W*$`
+	rulePatreon    = `(?i)\b(patreon|ko-?fi|buy me a coffee)\b`
+)
+
+// RuleSets are the built-in cleanup rule sets.
+// Rule sets of the same name in the configuration file take
+// precedence.
+var RuleSets = map[string][]Rule{
+	// Share buttons and ads of WordPress sites.
+	"wordpress": {
+		{Drop: "div.sharedaddy, div.sd-sharing-enabled, div.sd-block"},
+		{Drop: "div.wpcnt, div.code-block, div[id^=atatags-], span#wordads-inline-marker"},
+	},
+	// Jetpack likes, related posts and subscription forms.
+	"jetpack": {
+		{Drop: "div.sd-like, div[id^=like-post-wrapper], div#jp-post-flair"},
+		{Drop: "div#jp-relatedposts, div.jp-relatedposts, div.wp-block-jetpack-subscriptions"},
+	},
+	// Previous, next and index links between chapters.
+	"navigation": {
+		{DropText: ruleNavigation, Select: "p, div"},
+		{Drop: "div.wp-block-buttons, nav.post-navigation, div.nav-links"},
+	},
+	// Requests for support on Patreon, Ko-fi and the like.
+	"patreon": {
+		{DropText: rulePatreon},
+		{Drop: `p:has(a[href*="patreon.com"]), figure:has(a[href*="patreon.com"])`},
+		{Drop: `p:has(a[href*="ko-fi.com"]), figure:has(a[href*="ko-fi.com"])`},
+	},
+}
+
+// Return the names of the built-in and configured rule sets, sorted.
+func RuleSetNames() []string {
+	var names []string
+	for n := range RuleSets {
+		names = append(names, n)
+	}
+	for n := range Config.RuleSets {
+		if _, ok := RuleSets[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Return the rule set NAME from the configuration file or the built-in
+// ones.
+func RuleSetFor(name string) ([]Rule, error) {
+	if r, ok := Config.RuleSets[name]; ok {
+		return r, nil
+	}
+	if r, ok := RuleSets[name]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("unknown rule set %q, should be one of %s",
+		name, strings.Join(RuleSetNames(), ", "))
+}
+
+// Return the cleanup rules for the series URL: those of the rule sets
+// in Config.Cleanup and the series, then the rules of the series.
+func RulesFor(url string) ([]Rule, error) {
+	var rules []Rule
+	series := Config.Series[url]
+	for _, name := range append(append([]string(nil), Config.Cleanup...), series.Cleanup...) {
+		r, err := RuleSetFor(name)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r...)
+	}
+	return append(rules, series.Rules...), nil
+}
+
+// Return an error if R is not a valid rule.
+// The selectors are checked by package cleanup, see cleanup.Check.
+func CheckRule(r Rule) error {
+	n := 0
+	for _, set := range []bool{r.Drop != "", r.DropText != "", r.Truncate != "", len(r.Strip) > 0} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("exactly one of drop, drop_text, truncate and strip should be set")
+	}
+	if r.Select != "" && (r.Drop != "" || r.Truncate != "") {
+		return fmt.Errorf("select only applies to drop_text and strip")
+	}
+	if r.DropText != "" {
+		if _, err := regexp.Compile(r.DropText); err != nil {
+			return fmt.Errorf("drop_text: %v", err)
+		}
+	}
+	return nil
+}
+
+// Return an error if RULES are not valid rules.
+func CheckRules(rules []Rule) error {
+	for i, r := range rules {
+		if err := CheckRule(r); err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
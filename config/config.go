@@ -0,0 +1,599 @@
+// Licensed under BSD 2-Clause License.
+
+// Package config is the configuration of ln2epub, usually loaded
+// from a TOML file, see File.
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File is the configuration file.
+// It is a TOML file like the following,
+//
+//	output_dir = "~/Books"
+//	name_template = "{series}/{title}.epub"
+//	on_conflict = "rename"
+//	epub_version = 3
+//	format = "html"
+//	profile = "boox"
+//	external_images = true
+//	split_chapters = true
+//	text_width = 80
+//	typography = true
+//	concurrency = 4
+//	contact = "mailto:me@example.com"
+//	email = "me@kindle.com"
+//	cleanup = ["wordpress", "jetpack"]
+//	proxy = "socks5://127.0.0.1:9050"
+//	rate = 0.5
+//	delay = 1
+//
+//	[headers]
+//	Accept-Language = "en"
+//
+//	[images]
+//	max_width = 1264
+//	max_height = 1680
+//	grayscale = true
+//	jpeg_quality = 80
+//	cover_aspect = 0.75
+//
+//	[profiles.boox]
+//	epub_version = 3
+//	css = "p { text-align: left; }"
+//	images = { max_width = 1404, max_height = 1872, grayscale = true }
+//
+//	[[rule_sets.tlnotes]]
+//	drop = "div.tl-note"
+//
+//	[hosts."www.baka-tsuki.org"]
+//	user_agent = "Mozilla/5.0"
+//	headers = { Referer = "https://www.baka-tsuki.org/" }
+//
+//	[hosts."wordpress.com"]
+//	proxy = "direct"
+//	rate = 2
+//	burst = 10
+//
+//	[sites.neosekai]
+//	author = "NeoSekai"
+//	options = { ajax_url = "https://example.com/wp-admin/admin-ajax.php" }
+//
+//	[series."https://www.neosekaitranslations.com/novel/foo/"]
+//	author = "Foo Bar"
+//	language = "en-US"
+//	password = "hunter2"
+//	cleanup = ["navigation", "patreon", "tlnotes"]
+//	rules = [
+//		{ drop_text = "^Translator: .* Editor: " },
+//		{ truncate = "div.author-note" },
+//		{ strip = ["style"], select = "span" },
+//	]
+//
+//	[smtp]
+//	host = "smtp.example.com"
+//	username = "me@example.com"
+//	password = "hunter2"
+//	shrink = "kindle"
+//
+//	[[hooks]]
+//	command = ["cp", "{file}", "/media/KOBOeReader/"]
+//
+//	[[hooks]]
+//	command = ["ebook-convert", "{file}", "{dir}/{name}.azw3"]
+//	on_error = "abort"
+//	timeout = 300
+//
+//	[[notify]]
+//	webhook = "http://localhost:8000/ln2epub"
+//	retries = 5
+//
+//	[[notify]]
+//	command = 'notify-send "$LN2EPUB_TITLE" "$LN2EPUB_CHAPTERS new chapters"'
+//
+// Flags given in the command line override the values in the file.
+type File struct {
+	// OutputDir is the directory to write the epub files to.
+	OutputDir string `toml:"output_dir"`
+
+	// NameTemplate is the template for the epub filenames, see
+	// sites.BookFileName.
+	NameTemplate string `toml:"name_template"`
+
+	// OnConflict is the collision policy, see
+	// sites.BookResolveCollision.
+	OnConflict string `toml:"on_conflict"`
+
+	// EpubVersion is the version of the epub files, 2 or 3.
+	EpubVersion int `toml:"epub_version"`
+
+	// Format is the output format, see export.Formats.
+	Format string `toml:"format"`
+
+	// ExternalImages is true if the images of HTML books should be
+	// written next to the file instead of being inlined.
+	ExternalImages bool `toml:"external_images"`
+
+	// SplitChapters is true if each chapter of md and txt books
+	// should be written to its own file.
+	SplitChapters bool `toml:"split_chapters"`
+
+	// TextWidth is the column txt books are wrapped at, 0 for no
+	// wrapping.
+	TextWidth int `toml:"text_width"`
+
+	// Typography is true if the chapters should have typographic
+	// quotes, dashes and ellipses, see cleanup.Typography.
+	Typography bool `toml:"typography"`
+
+	// Profile is the device profile applied to the settings, see
+	// ApplyProfile.
+	Profile string `toml:"profile"`
+
+	// Profiles are device profiles in addition to the built-in
+	// ones, see Profiles.
+	Profiles map[string]Profile `toml:"profiles"`
+
+	// Css is added to the chapters after their own stylesheets.
+	Css string `toml:"css"`
+
+	// Cleanup are the names of the rule sets applied to the
+	// chapters of every book, see RulesFor.
+	Cleanup []string `toml:"cleanup"`
+
+	// RuleSets are cleanup rule sets in addition to the built-in
+	// ones, see RuleSets.
+	RuleSets map[string][]Rule `toml:"rule_sets"`
+
+	// Concurrency is the number of pages fetched in parallel.
+	Concurrency int `toml:"concurrency"`
+
+	// CookieFile is the Netscape cookies.txt file where the cookies
+	// are kept between runs, see fetch.CookieJar.
+	CookieFile string `toml:"cookie_file"`
+
+	// UserAgent is the User-Agent header for all requests.  It is
+	// best left alone, see Contact.
+	UserAgent string `toml:"user_agent"`
+
+	// Contact is added to the default User-Agent header, e.g., an
+	// email address.
+	Contact string `toml:"contact"`
+
+	// Rate is the number of requests per second allowed to each
+	// host, after the first Burst requests.  Zero means no limit.
+	Rate  float64 `toml:"rate"`
+	Burst int     `toml:"burst"`
+
+	// Delay is the minimum number of seconds between requests to
+	// the same host.
+	Delay float64 `toml:"delay"`
+
+	// IgnoreRobots is true if robots.txt should not be honoured.
+	IgnoreRobots bool `toml:"ignore_robots"`
+
+	// Headers are extra headers for all requests.
+	Headers map[string]string `toml:"headers"`
+
+	// Proxy is the URL of the proxy for all requests.  The
+	// supported schemes are http, https and socks5, which resolves
+	// host names through the proxy.  If empty, the proxy is taken
+	// from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables.  "direct" means no proxy.
+	Proxy string `toml:"proxy"`
+
+	Images Images `toml:"images"`
+
+	// Hosts are the settings for requests to each host.  The
+	// settings for a domain apply to its subdomains too, see
+	// HostFor.
+	Hosts map[string]Host `toml:"hosts"`
+
+	// Sites are the settings for each site, keyed by sites.Site.Name.
+	Sites map[string]Site `toml:"sites"`
+
+	// Series are the settings for each series, keyed by the series
+	// URL.
+	Series map[string]Series `toml:"series"`
+
+	// Email are the addresses books are mailed to after they are
+	// created, separated by commas, e.g., a Send to Kindle address.
+	// Empty means none.
+	Email string `toml:"email"`
+
+	// Smtp is the mail server books are mailed through.
+	Smtp Smtp `toml:"smtp"`
+
+	// Hooks are commands run after each book is created.
+	Hooks []Hook `toml:"hooks"`
+
+	// Notify are where to send notifications when a sync builds a
+	// book with new chapters.
+	Notify []Notifier `toml:"notify"`
+}
+
+// Images is how the images in the epub files are processed.
+// Zero values mean leave as-is.
+type Images struct {
+	// Images larger than MaxWidth x MaxHeight are scaled down to
+	// fit.
+	MaxWidth  int `toml:"max_width"`
+	MaxHeight int `toml:"max_height"`
+
+	// Grayscale is true if images should be made grayscale.
+	Grayscale bool `toml:"grayscale"`
+
+	// JpegQuality is the quality, 1-100, to reencode JPEG images
+	// with.
+	JpegQuality int `toml:"jpeg_quality"`
+
+	// CoverAspect is the width to height ratio covers are made to
+	// fit, usually that of the screen.  CoverFit is how: CoverPad
+	// adds white borders, and CoverCrop cuts the sides off.  Empty
+	// means CoverPad.
+	CoverAspect float64 `toml:"cover_aspect"`
+	CoverFit    string  `toml:"cover_fit"`
+}
+
+// Host is the settings for requests to a host.
+type Host struct {
+	UserAgent string            `toml:"user_agent"`
+	Headers   map[string]string `toml:"headers"`
+
+	// Proxy overrides File.Proxy for the host.
+	Proxy string `toml:"proxy"`
+
+	// Rate, Burst and Delay override those in File for the
+	// host when not zero.
+	Rate  float64 `toml:"rate"`
+	Burst int     `toml:"burst"`
+	Delay float64 `toml:"delay"`
+}
+
+// Site is the settings for a site.
+type Site struct {
+	// Author and Language are the defaults for books from the
+	// site.
+	Author   string `toml:"author"`
+	Language string `toml:"language"`
+
+	// Options are site specific options.  See the site adapters
+	// for the options they understand.
+	Options map[string]string `toml:"options"`
+}
+
+// Series is the settings for a series.
+type Series struct {
+	Author   string `toml:"author"`
+	Language string `toml:"language"`
+
+	// Password is the password of the password protected posts
+	// in the series, see fetch.WpUnlock.
+	Password string `toml:"password"`
+
+	// Cleanup are the names of the rule sets applied to the
+	// chapters of the series, and Rules are rules of its own.
+	Cleanup []string `toml:"cleanup"`
+	Rules   []Rule   `toml:"rules"`
+}
+
+// Smtp is the settings of a mail server, see package email.
+type Smtp struct {
+	Host string `toml:"host"`
+
+	// Port is the port of Host, 465 for SmtpTls and 587 otherwise
+	// if zero.
+	Port int `toml:"port"`
+
+	// Username and Password are for authenticating with Host, if
+	// it needs it.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// From is the sender address, Username if empty.  Send to
+	// Kindle only takes books from approved addresses.
+	From string `toml:"from"`
+
+	// Security is how the connection is encrypted: SmtpStarttls,
+	// SmtpTls or SmtpNone.  Empty means SmtpStarttls.
+	Security string `toml:"security"`
+
+	// MaxSize is the largest message Host takes in megabytes, 25
+	// if zero.
+	MaxSize float64 `toml:"max_size"`
+
+	// Shrink is the profile whose image settings make books that
+	// are too large smaller before they are mailed.  If empty,
+	// they are not mailed.
+	Shrink string `toml:"shrink"`
+
+	// Timeout is the number of seconds to wait for Host, 120 if
+	// zero.
+	Timeout float64 `toml:"timeout"`
+}
+
+// The encryption of connections to mail servers, see Smtp.Security.
+const (
+	SmtpStarttls = "starttls"
+	SmtpTls      = "tls"
+	SmtpNone     = "none"
+)
+
+// Hook is a command run after a book is created, see package hook.
+type Hook struct {
+	// Command is the program to run and its arguments, where
+	// {FIELD} is replaced by the value of FIELD.
+	Command []string `toml:"command"`
+
+	// OnError is what to do when the command fails: HookWarn
+	// reports the error and goes on, HookIgnore only reports it at
+	// the verbose level, and HookAbort stops building books.  Empty
+	// means HookWarn.
+	OnError string `toml:"on_error"`
+
+	// Timeout is the number of seconds to wait for the command,
+	// no limit if zero.
+	Timeout float64 `toml:"timeout"`
+}
+
+// The failure policies of hooks, see Hook.OnError.
+const (
+	HookWarn   = "warn"
+	HookIgnore = "ignore"
+	HookAbort  = "abort"
+)
+
+// Notifier is a notification sent when a sync builds a book with new
+// chapters, see package notify.  Either Webhook or Command should be
+// set.
+type Notifier struct {
+	// Webhook is the URL to POST the notification to as JSON.
+	Webhook string            `toml:"webhook"`
+	Headers map[string]string `toml:"headers"`
+
+	// Retries is the number of times a failed webhook request is
+	// tried again, 3 if zero.  Negative means never.
+	Retries int `toml:"retries"`
+
+	// Command is run by the shell with the notification in
+	// environment variables.
+	Command string `toml:"command"`
+
+	// Timeout is the number of seconds to wait for the webhook or
+	// the command, 30 if zero.
+	Timeout float64 `toml:"timeout"`
+}
+
+// Default template for the epub filenames.
+var DefaultNameTemplate = "{title}.epub"
+
+// The configuration in effect.
+var Config = File{
+	OutputDir:    ".",
+	NameTemplate: DefaultNameTemplate,
+	OnConflict:   "overwrite",
+	EpubVersion:  2,
+	Format:       "epub",
+	TextWidth:    72,
+	Concurrency:  1,
+	CookieFile:   DataPath("cookies.txt"),
+	Rate:         1,
+	Burst:        5,
+	Delay:        0.5,
+}
+
+// Return the path of data file NAME.
+// Data files are kept in the cache directory, e.g.,
+// $XDG_CACHE_HOME/ln2epub/NAME.
+func DataPath(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ln2epub", name)
+}
+
+// Return the default path of the configuration file.
+// This is $XDG_CONFIG_HOME/ln2epub/config.toml or the equivalent in
+// other systems.
+func Path() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ln2epub", "config.toml")
+}
+
+// Return PATH with a leading ~ replaced by the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// Load the configuration file PATH into Config.
+// If PATH is empty, the default configuration file is loaded if it
+// exists.
+func Load(path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = Path()
+	}
+	if path == "" {
+		return nil
+	}
+
+	md, err := toml.DecodeFile(path, &Config)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		return fmt.Errorf("%s: unknown configuration key %s", path, keys[0])
+	}
+
+	Config.OutputDir = expandHome(Config.OutputDir)
+	Config.CookieFile = expandHome(Config.CookieFile)
+	if Config.EpubVersion != 2 && Config.EpubVersion != 3 {
+		return fmt.Errorf("%s: epub_version should be 2 or 3", path)
+	}
+	if Config.Concurrency < 1 {
+		Config.Concurrency = 1
+	}
+	if err := CheckProxy(Config.Proxy); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for h, c := range Config.Hosts {
+		if err := CheckProxy(c.Proxy); err != nil {
+			return fmt.Errorf("%s: host %s: %v", path, h, err)
+		}
+	}
+	if err := CheckImages(Config.Images); err != nil {
+		return fmt.Errorf("%s: images: %v", path, err)
+	}
+	for name, p := range Config.Profiles {
+		if err := CheckProfile(p); err != nil {
+			return fmt.Errorf("%s: profile %s: %v", path, name, err)
+		}
+	}
+	userSettings.images, userSettings.css = Config.Images, Config.Css
+	userSettings.epubVersion, userSettings.format = Config.EpubVersion, ""
+	userSettings.epubVersionSet = md.IsDefined("epub_version")
+	userSettings.grayscaleSet = md.IsDefined("images", "grayscale")
+	if md.IsDefined("format") {
+		userSettings.format = Config.Format
+	}
+	if err := ApplyProfile(Config.Profile); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for name, rules := range Config.RuleSets {
+		if err := CheckRules(rules); err != nil {
+			return fmt.Errorf("%s: rule set %s: %v", path, name, err)
+		}
+	}
+	for u, s := range Config.Series {
+		if err := CheckRules(s.Rules); err != nil {
+			return fmt.Errorf("%s: series %s: %v", path, u, err)
+		}
+		if _, err := RulesFor(u); err != nil {
+			return fmt.Errorf("%s: series %s: %v", path, u, err)
+		}
+	}
+	if _, err := RulesFor(""); err != nil {
+		return fmt.Errorf("%s: cleanup: %v", path, err)
+	}
+	if err := CheckSmtp(Config.Smtp); err != nil {
+		return fmt.Errorf("%s: smtp: %v", path, err)
+	}
+	for i, h := range Config.Hooks {
+		if err := CheckHook(h); err != nil {
+			return fmt.Errorf("%s: hook %d: %v", path, i+1, err)
+		}
+	}
+	for i, n := range Config.Notify {
+		if err := CheckNotifier(n); err != nil {
+			return fmt.Errorf("%s: notify %d: %v", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// Return an error if PROXY is not a valid proxy setting.
+func CheckProxy(proxy string) error {
+	if proxy == "" || proxy == "direct" {
+		return nil
+	}
+	u, err := nurl.Parse(proxy)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return nil
+	}
+	return fmt.Errorf("unsupported proxy %s", proxy)
+}
+
+// Return an error if S is not a valid mail server.
+func CheckSmtp(s Smtp) error {
+	switch s.Security {
+	case "", SmtpStarttls, SmtpTls, SmtpNone:
+	default:
+		return fmt.Errorf("unknown security %q, should be starttls, tls or none", s.Security)
+	}
+	if s.Shrink != "" {
+		if _, err := ProfileFor(s.Shrink); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return an error if H is not a valid hook.
+func CheckHook(h Hook) error {
+	if len(h.Command) == 0 || h.Command[0] == "" {
+		return fmt.Errorf("no command")
+	}
+	switch h.OnError {
+	case "", HookWarn, HookIgnore, HookAbort:
+		return nil
+	}
+	return fmt.Errorf("unknown on_error %q, should be warn, ignore or abort", h.OnError)
+}
+
+// Return an error if N is not a valid notifier.
+func CheckNotifier(n Notifier) error {
+	switch {
+	case n.Webhook != "" && n.Command != "":
+		return fmt.Errorf("both webhook and command are set")
+	case n.Command != "":
+		return nil
+	case n.Webhook == "":
+		return fmt.Errorf("neither webhook nor command is set")
+	}
+	u, err := nurl.Parse(n.Webhook)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported webhook %s", n.Webhook)
+	}
+	return nil
+}
+
+// Return the settings for HOST.
+// If there are none for HOST, the settings of the closest parent
+// domain are returned, e.g., those of "wordpress.com" for
+// "foo.wordpress.com".
+func HostFor(host string) Host {
+	for {
+		if c, ok := Config.Hosts[host]; ok {
+			return c
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return Host{}
+		}
+		host = host[i+1:]
+	}
+}
+
+// Return the value of site option KEY for SITE, or DEF if not set.
+func SiteOption(site, key, def string) string {
+	if v, ok := Config.Sites[site].Options[key]; ok {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Load TEXT as the configuration file and return the error, if any.
+// Config and the settings profiles merge with are restored when the
+// test ends.
+func testLoad(t *testing.T, text string) error {
+	t.Helper()
+	saved, savedSettings := Config, userSettings
+	t.Cleanup(func() { Config, userSettings = saved, savedSettings })
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoad(t *testing.T) {
+	err := testLoad(t, `
+epub_version = 3
+concurrency = 0
+
+[hosts."wordpress.com"]
+proxy = "direct"
+rate = 2
+
+[sites.fiance.options]
+title = "Foo"
+
+[[notify]]
+webhook = "http://localhost:8000/"
+
+[[notify]]
+command = "true"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Config.EpubVersion != 3 || Config.Concurrency != 1 {
+		t.Errorf("got version %d and concurrency %d", Config.EpubVersion, Config.Concurrency)
+	}
+	// Defaults are kept.
+	if Config.Burst != 5 || Config.NameTemplate != DefaultNameTemplate {
+		t.Errorf("defaults were lost")
+	}
+	if h := HostFor("foo.wordpress.com"); h.Proxy != "direct" || h.Rate != 2 {
+		t.Errorf("got %+v for foo.wordpress.com", h)
+	}
+	if h := HostFor("example.com"); h.Proxy != "" {
+		t.Errorf("got %+v for example.com", h)
+	}
+	if v := SiteOption("fiance", "title", "Bar"); v != "Foo" {
+		t.Errorf("got title %q", v)
+	}
+	if v := SiteOption("fiance", "author", "Bar"); v != "Bar" {
+		t.Errorf("got author %q", v)
+	}
+	if len(Config.Notify) != 2 || Config.Notify[1].Command != "true" {
+		t.Errorf("got notifiers %+v", Config.Notify)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for text, want := range map[string]string{
+		`epub_version = 4`:                                         "epub_version should be 2 or 3",
+		`proxy = "ftp://example.com"`:                              "unsupported proxy",
+		`proxy = "socks5h://127.0.0.1:9050"`:                       "unsupported proxy",
+		`colour = "blue"`:                                          "unknown configuration key colour",
+		"[hosts.foo]\nproxy = \"gopher:\"":                         "host foo: unsupported proxy",
+		"[[notify]]\nretries = 1":                                  "notify 1: neither webhook nor command",
+		"[[notify]]\nwebhook = \"ftp:\"":                           "notify 1: unsupported webhook",
+		"[[notify]]\nwebhook = \"http://a\"\ncommand = \"b\"":      "notify 1: both",
+		`profile = "kindel"`:                                       "unknown profile \"kindel\"",
+		"[images]\ncover_fit = \"stretch\"":                        "images: unknown cover_fit",
+		"[profiles.foo]\nepub_version = 1":                         "profile foo: epub_version",
+		"[smtp]\nsecurity = \"ssl\"":                               "smtp: unknown security",
+		"[smtp]\nshrink = \"tiny\"":                                "smtp: unknown profile",
+		"[[hooks]]\ncommand = []":                                  "hook 1: no command",
+		`cleanup = ["wordpres"]`:                                   "cleanup: unknown rule set \"wordpres\"",
+		"[[rule_sets.foo]]\ndrop = \"div\"\ntruncate = \"hr\"":     "rule set foo: rule 1: exactly one",
+		"[series.x]\nrules = [{ drop_text = \"(\" }]":              "series x: rule 1: drop_text",
+		"[series.x]\nrules = [{ drop = \"div\", select = \"p\" }]": "series x: rule 1: select only applies",
+		"[series.x]\ncleanup = [\"foo\"]":                          "series x: unknown rule set",
+		"[[hooks]]\ncommand = [\"cp\"]\non_error = \"x\"":          "hook 1: unknown on_error",
+	} {
+		text, want := text, want
+		t.Run(want, func(t *testing.T) {
+			err := testLoad(t, text)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("got error %v, want %s", err, want)
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	err := testLoad(t, `
+profile = "boox"
+
+[images]
+max_width = 100
+max_height = 200
+
+[profiles.boox]
+epub_version = 3
+css = "p { text-align: left; }"
+images = { max_width = 1404, max_height = 1872, grayscale = true }
+
+[profiles.kindle]
+images = { max_width = 600 }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Images{MaxWidth: 100, MaxHeight: 200, Grayscale: true}
+	if Config.Images != want || Config.EpubVersion != 3 || Config.Css != "p { text-align: left; }" {
+		t.Errorf("got images %+v, version %d and css %q", Config.Images, Config.EpubVersion, Config.Css)
+	}
+
+	// The configured profiles take precedence, and another profile
+	// undoes the first, back to the default epub version.
+	if err := ApplyProfile("kindle"); err != nil {
+		t.Fatal(err)
+	}
+	if Config.Images != (Images{MaxWidth: 100, MaxHeight: 200}) || Config.Css != "" || Config.EpubVersion != 2 {
+		t.Errorf("got images %+v, version %d and css %q", Config.Images, Config.EpubVersion, Config.Css)
+	}
+
+	if err := ApplyProfile("kobo"); err != nil {
+		t.Fatal(err)
+	}
+	if Config.Format != "kepub" || Config.Images.CoverAspect == 0 {
+		t.Errorf("got format %s and images %+v", Config.Format, Config.Images)
+	}
+	if err := ApplyProfile("tablet"); err != nil {
+		t.Fatal(err)
+	}
+	if Config.Format != "epub" || Config.Images.Grayscale {
+		t.Errorf("got format %s and images %+v", Config.Format, Config.Images)
+	}
+	Config.Format = "html"
+	if err := ApplyProfile("kobo"); err != nil || Config.Format != "html" {
+		t.Errorf("got format %s, %v", Config.Format, err)
+	}
+
+	names := strings.Join(ProfileNames(), " ")
+	if names != "boox kindle kobo phone pocketbook tablet" {
+		t.Errorf("got profiles %s", names)
+	}
+	for name, p := range Profiles {
+		if err := CheckProfile(p); err != nil {
+			t.Errorf("profile %s: %v", name, err)
+		}
+	}
+}
+
+func TestProfileMerge(t *testing.T) {
+	// The settings of the configuration file survive the profile.
+	err := testLoad(t, `
+css = "p { text-indent: 1em; }"
+epub_version = 2
+format = "kepub"
+
+[images]
+jpeg_quality = 60
+grayscale = false
+cover_fit = "crop"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyProfile("kindle"); err != nil {
+		t.Fatal(err)
+	}
+	want := Images{MaxWidth: 1236, MaxHeight: 1648, JpegQuality: 60, CoverAspect: 0.75, CoverFit: CoverCrop}
+	if Config.Images != want || Config.EpubVersion != 2 || Config.Format != "kepub" {
+		t.Errorf("got images %+v, version %d and format %s", Config.Images, Config.EpubVersion, Config.Format)
+	}
+	if !strings.HasPrefix(Config.Css, Profiles["kindle"].Css) || !strings.HasSuffix(Config.Css, "p { text-indent: 1em; }") {
+		t.Errorf("got css %q", Config.Css)
+	}
+}
+
+func TestRulesFor(t *testing.T) {
+	err := testLoad(t, `
+cleanup = ["wordpress"]
+
+[[rule_sets.navigation]]
+drop = "div.nav"
+
+[series."https://example.com/foo/"]
+cleanup = ["navigation", "patreon"]
+rules = [
+	{ truncate = "div.author-note" },
+	{ strip = ["style"], select = "span" },
+]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := RulesFor("https://example.com/foo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := len(RuleSets["wordpress"]) + 1 + len(RuleSets["patreon"]) + 2
+	if len(rules) != want {
+		t.Fatalf("got %d rules, want %d", len(rules), want)
+	}
+	// The configured rule sets take precedence.
+	if r := rules[len(RuleSets["wordpress"])]; r.Drop != "div.nav" {
+		t.Errorf("got rule %+v for navigation", r)
+	}
+	if r := rules[len(rules)-1]; r.Select != "span" || len(r.Strip) != 1 {
+		t.Errorf("got last rule %+v", r)
+	}
+	if rules, _ := RulesFor("https://example.com/bar/"); len(rules) != len(RuleSets["wordpress"]) {
+		t.Errorf("got %d rules for another series", len(rules))
+	}
+
+	for name, rules := range RuleSets {
+		if err := CheckRules(rules); err != nil {
+			t.Errorf("rule set %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile is the output settings for a reading device.  A profile
+// fills in the image settings and stylesheet overrides the
+// configuration file leaves unset, see ApplyProfile.
+type Profile struct {
+	Images Images `toml:"images"`
+
+	// EpubVersion is the epub version, 2 or 3.  Zero leaves the
+	// version as-is.
+	EpubVersion int `toml:"epub_version"`
+
+	// Kepub is true if epub files should be made KEPUB files for
+	// Kobo e-readers.
+	Kepub bool `toml:"kepub"`
+
+	// Css is added to the chapters after their own stylesheets.
+	Css string `toml:"css"`
+}
+
+// The cover fitting policies, see Images.CoverFit.
+const (
+	CoverPad  = "pad"
+	CoverCrop = "crop"
+)
+
+// Profiles are the built-in device profiles.
+// Profiles of the same name in the configuration file take precedence.
+var Profiles = map[string]Profile{
+	// Kindle Paperwhite, through send-to-kindle.  Amazon's
+	// conversion drops paragraph margins and stretches small
+	// images.
+	"kindle": {
+		Images: Images{
+			MaxWidth: 1236, MaxHeight: 1648, Grayscale: true,
+			JpegQuality: 80, CoverAspect: 0.75, CoverFit: CoverPad,
+		},
+		EpubVersion: 3,
+		Css:         "p { margin-top: 0; margin-bottom: 0.5em; }\nimg { max-width: 100%; height: auto; }\n",
+	},
+	// Kobo Libra.
+	"kobo": {
+		Images: Images{
+			MaxWidth: 1264, MaxHeight: 1680, Grayscale: true,
+			JpegQuality: 85, CoverAspect: 0.75, CoverFit: CoverPad,
+		},
+		EpubVersion: 3,
+		Kepub:       true,
+	},
+	// PocketBook readers, whose renderer knows epub 2 best and
+	// leaves no margin of its own.
+	"pocketbook": {
+		Images: Images{
+			MaxWidth: 1072, MaxHeight: 1448, Grayscale: true,
+			JpegQuality: 80, CoverAspect: 0.74, CoverFit: CoverPad,
+		},
+		EpubVersion: 2,
+		Css:         "body { margin: 0 2%; }\n",
+	},
+	"phone": {
+		Images:      Images{MaxWidth: 1080, MaxHeight: 2400, JpegQuality: 85},
+		EpubVersion: 3,
+		Css:         "img { max-width: 100%; height: auto; }\n",
+	},
+	"tablet": {
+		Images:      Images{MaxWidth: 1600, MaxHeight: 2560, JpegQuality: 90},
+		EpubVersion: 3,
+	},
+}
+
+// Return the names of the built-in and configured profiles, sorted.
+func ProfileNames() []string {
+	var names []string
+	for n := range Profiles {
+		names = append(names, n)
+	}
+	for n := range Config.Profiles {
+		if _, ok := Profiles[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Return the profile NAME from the configuration file or the built-in
+// ones.
+func ProfileFor(name string) (Profile, error) {
+	if p, ok := Config.Profiles[name]; ok {
+		return p, nil
+	}
+	if p, ok := Profiles[name]; ok {
+		return p, nil
+	}
+	return Profile{}, fmt.Errorf("unknown profile %q, should be one of %s",
+		name, strings.Join(ProfileNames(), ", "))
+}
+
+// The settings of the configuration file a profile is merged with,
+// see ApplyProfile.
+type settings struct {
+	images      Images
+	css         string
+	epubVersion int
+
+	// Format is empty if the configuration file does not set it.
+	format string
+
+	// EpubVersionSet and grayscaleSet are true if the
+	// configuration file sets epub_version and images.grayscale.
+	epubVersionSet, grayscaleSet bool
+}
+
+// The settings of the configuration file as of the last Load, the
+// defaults until then.
+var userSettings = settings{epubVersion: Config.EpubVersion}
+
+// Apply the profile NAME to Config.  Nothing is done if NAME is
+// empty.  The profile only fills in the image settings and epub
+// version the configuration file leaves unset, and its Css comes
+// before that of the configuration file.  Epub files are made KEPUB
+// files if the profile asks for them, unless the configuration file
+// sets the format.  Applying another profile undoes this one.
+func ApplyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	p, err := ProfileFor(name)
+	if err != nil {
+		return err
+	}
+	u := userSettings
+	Config.Profile = name
+	Config.Images = mergeImages(u.images, p.Images, u.grayscaleSet)
+	Config.Css = p.Css + u.css
+	Config.EpubVersion = u.epubVersion
+	if !u.epubVersionSet && p.EpubVersion != 0 {
+		Config.EpubVersion = p.EpubVersion
+	}
+	// Only undo a KEPUB format an earlier profile chose.
+	switch {
+	case u.format != "":
+	case p.Kepub && Config.Format == "epub":
+		Config.Format = "kepub"
+	case !p.Kepub && Config.Format == "kepub":
+		Config.Format = "epub"
+	}
+	return nil
+}
+
+// Return the image settings USER with the unset ones taken from
+// PROFILE.  The grayscale setting of USER is kept if GRAYSCALESET is
+// true.
+func mergeImages(user, profile Images, grayscaleSet bool) Images {
+	if user.MaxWidth == 0 && user.MaxHeight == 0 {
+		user.MaxWidth, user.MaxHeight = profile.MaxWidth, profile.MaxHeight
+	}
+	if !grayscaleSet {
+		user.Grayscale = profile.Grayscale
+	}
+	if user.JpegQuality == 0 {
+		user.JpegQuality = profile.JpegQuality
+	}
+	if user.CoverAspect == 0 {
+		user.CoverAspect = profile.CoverAspect
+	}
+	if user.CoverFit == "" {
+		user.CoverFit = profile.CoverFit
+	}
+	return user
+}
+
+// Return an error if P is not a valid profile.
+func CheckProfile(p Profile) error {
+	if v := p.EpubVersion; v != 0 && v != 2 && v != 3 {
+		return fmt.Errorf("epub_version should be 2 or 3")
+	}
+	return CheckImages(p.Images)
+}
+
+// Return an error if IMAGES are not valid image settings.
+func CheckImages(images Images) error {
+	switch {
+	case images.CoverFit != "" && images.CoverFit != CoverPad && images.CoverFit != CoverCrop:
+		return fmt.Errorf("unknown cover_fit %q, should be pad or crop", images.CoverFit)
+	case images.CoverAspect < 0:
+		return fmt.Errorf("cover_aspect should be positive")
+	case images.JpegQuality < 0 || images.JpegQuality > 100:
+		return fmt.Errorf("jpeg_quality should be between 1 and 100")
+	}
+	return nil
+}
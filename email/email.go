@@ -0,0 +1,176 @@
+// Licensed under BSD 2-Clause License.
+
+// Package email mails books as attachments, e.g., to Send to Kindle
+// addresses, through the SMTP server in config.Config.Smtp.
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Return the mimetype of attachment NAME.
+func fileType(name string) string {
+	if strings.HasSuffix(strings.ToLower(name), ".epub") {
+		return "application/epub+zip"
+	}
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Return the size of the message mailing a file of N bytes.  The
+// attachment is base64 encoded in lines of 76 characters, and the
+// headers are a few hundred bytes more.
+func Size(n int64) int64 {
+	enc := (n + 2) / 3 * 4
+	return enc + enc/76*2 + 1024
+}
+
+// Return the largest message the server in CONF takes, in bytes.
+func MaxSize(conf config.Smtp) int64 {
+	mb := conf.MaxSize
+	if mb == 0 {
+		mb = 25
+	}
+	return int64(mb * 1024 * 1024)
+}
+
+// Return the message from FROM to TO with subject SUBJECT and the file
+// NAME with CONTENT attached.
+func Message(from, to, subject, name string, content []byte) []byte {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+
+	w, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	w.Write([]byte(subject + "\r\n"))
+
+	w, _ = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(fileType(name), map[string]string{"name": name})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	enc := base64.StdEncoding.EncodeToString(content)
+	for len(enc) > 76 {
+		w.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	w.Write([]byte(enc + "\r\n"))
+	mw.Close()
+	return b.Bytes()
+}
+
+// Return a client of the server in CONF, connected and authenticated.
+func dial(conf config.Smtp, timeout time.Duration) (*smtp.Client, error) {
+	port := conf.Port
+	if port == 0 {
+		port = 587
+		if conf.Security == config.SmtpTls {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(conf.Host, strconv.Itoa(port))
+	d := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if conf.Security == config.SmtpTls {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, &tls.Config{ServerName: conf.Host})
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	c, err := smtp.NewClient(conn, conf.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if conf.Security == "" || conf.Security == config.SmtpStarttls {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, fmt.Errorf("%s does not support STARTTLS", conf.Host)
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: conf.Host}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if conf.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Mail the file FILENAME to the addresses TO with subject SUBJECT
+// through the server in CONF.  An error is returned if the message
+// would be larger than MaxSize.
+func Send(conf config.Smtp, to []string, subject, filename string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if n, max := Size(int64(len(content))), MaxSize(conf); n > max {
+		return fmt.Errorf("%s is too large to mail, %d bytes with at most %d", filename, n, max)
+	}
+	from := conf.From
+	if from == "" {
+		from = conf.Username
+	}
+	msg := Message(from, strings.Join(to, ", "), subject, filepath.Base(filename), content)
+
+	timeout := time.Duration(conf.Timeout * float64(time.Second))
+	if timeout == 0 {
+		timeout = 2 * time.Minute
+	}
+	c, err := dial(conf, timeout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, a := range to {
+		if err := c.Rcpt(a); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,104 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/email/emailtest"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Return a running SMTP stand-in, closed when the test ends, and the
+// settings for mailing through it.
+func testServer(t *testing.T) (*emailtest.Server, config.Smtp) {
+	s := emailtest.NewServer()
+	t.Cleanup(s.Close)
+	conf := s.Conf()
+	conf.Username, conf.Password = "me@example.com", "hunter2"
+	return s, conf
+}
+
+func TestSend(t *testing.T) {
+	s, conf := testServer(t)
+	content := bytes.Repeat([]byte("epub file\x00\xff"), 1000)
+	f := filepath.Join(t.TempDir(), "Foo - Volume 1.epub")
+	if err := os.WriteFile(f, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	to := []string{"me@kindle.com", "you@kindle.com"}
+	if err := Send(conf, to, "Foo - Volume 1", f); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := s.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.Auth != "\x00me@example.com\x00hunter2" {
+		t.Errorf("got auth %q", msg.Auth)
+	}
+	if msg.From != "me@example.com" || strings.Join(msg.To, " ") != "me@kindle.com you@kindle.com" {
+		t.Errorf("got message from %s to %v", msg.From, msg.To)
+	}
+	if n := int64(len(msg.Data)); n > Size(int64(len(content))) {
+		t.Errorf("got a message of %d bytes, more than %d", n, Size(int64(len(content))))
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(msg.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Header.Get("Subject"); got != "Foo - Volume 1" {
+		t.Errorf("got subject %q", got)
+	}
+	mt, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mt != "multipart/mixed" {
+		t.Fatalf("got content type %s, %v", mt, err)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	if _, err := mr.NextPart(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.FileName() != "Foo - Volume 1.epub" || p.Header.Get("Content-Type") != `application/epub+zip; name="Foo - Volume 1.epub"` {
+		t.Errorf("got attachment %s of type %s", p.FileName(), p.Header.Get("Content-Type"))
+	}
+	b, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+	if err != nil || !bytes.Equal(b, content) {
+		t.Errorf("got attachment of %d bytes, want %d, %v", len(b), len(content), err)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	s, saved := testServer(t)
+	f := filepath.Join(t.TempDir(), "Foo.epub")
+	if err := os.WriteFile(f, bytes.Repeat([]byte("x"), 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := saved
+	conf.MaxSize = 1
+	err := Send(conf, []string{"me@kindle.com"}, "Foo", f)
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("got error %v", err)
+	}
+	if len(s.Messages()) > 0 {
+		t.Error("the message was sent")
+	}
+
+	conf = saved
+	conf.Security = ""
+	err = Send(conf, []string{"me@kindle.com"}, "Foo", f)
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("got error %v", err)
+	}
+}
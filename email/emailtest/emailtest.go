@@ -0,0 +1,142 @@
+// Licensed under BSD 2-Clause License.
+
+// Package emailtest provides an SMTP server stand-in for the tests of
+// the packages that mail books.
+package emailtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"github.com/9viz/ln2epub/config"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message is a message sent to a Server.
+type Message struct {
+	// Auth is the decoded response of the AUTH PLAIN command, "" if
+	// the client did not authenticate.
+	Auth string
+
+	// From and To are the addresses of the MAIL and RCPT commands.
+	From string
+	To   []string
+
+	// Data is the message itself, with the dots unstuffed.
+	Data []byte
+}
+
+// Server is an SMTP server stand-in keeping the messages it is sent.
+// It offers AUTH PLAIN but not STARTTLS.
+type Server struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	msgs []Message
+}
+
+// Return a running Server on a local port.  It should be closed with
+// Close when the test ends.
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("emailtest: " + err.Error())
+	}
+	s := &Server{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// Stop S from taking new connections.
+func (s *Server) Close() {
+	s.ln.Close()
+}
+
+// Return the settings for mailing through S without encryption.
+func (s *Server) Conf() config.Smtp {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return config.Smtp{Host: host, Port: n, Security: config.SmtpNone}
+}
+
+// Return the messages sent to S so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.msgs...)
+}
+
+// Return the address in ARG, the argument of the MAIL or RCPT command
+// starting with PREFIX.
+func address(arg, prefix string) string {
+	a, _, _ := strings.Cut(strings.TrimPrefix(arg, prefix), " ")
+	return strings.Trim(a, "<>")
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	var m Message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			reply("250-localhost\r\n250-AUTH PLAIN\r\n250 8BITMIME")
+		case "AUTH":
+			b, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			m.Auth = string(b)
+			reply("235 OK")
+		case "MAIL":
+			m = Message{Auth: m.Auth, From: address(arg, "FROM:")}
+			reply("250 OK")
+		case "RCPT":
+			m.To = append(m.To, address(arg, "TO:"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			m.Data = data.Bytes()
+			s.mu.Lock()
+			s.msgs = append(s.msgs, m)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RSET":
+			m = Message{Auth: m.Auth}
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Unknown command")
+		}
+	}
+}
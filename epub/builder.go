@@ -0,0 +1,118 @@
+package epub
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Builder puts together the files of an epub file.
+// For example,
+//
+//	b := epub.NewBuilder(epub.Metadata{
+//		Title:      "Foo - Volume 1",
+//		Author:     "Bar",
+//		Identifier: epub.Uuid("https://example.com/foo/"),
+//		Date:       time.Now(),
+//	})
+//	b.SetCover(cover, "image/jpeg")
+//	src := b.AddImage(img, "image/png")
+//	b.AddChapter("Prologue", "<p>Once upon a time.</p><img src='"+src+"' />")
+//	err := b.BuildFile("foo.epub")
+//
+// Chapters are read in the order they are added, after the cover page
+// if there is one.
+type Builder struct {
+	// Metadata is the metadata of the epub file.  Metadata.Date is
+	// also the modification time of the files in the archive.
+	Metadata Metadata
+
+	cover    []File
+	files    []File
+	chapters int
+	images   int
+}
+
+// Return a new Builder for an epub file with metadata META.
+func NewBuilder(meta Metadata) *Builder {
+	return &Builder{Metadata: meta}
+}
+
+// Add chapter TITLE with xhtml BODY.
+// BODY is the content of the body element and is added as-is, so it
+// should be well-formed xhtml.  The chapter file is returned.
+func (b *Builder) AddChapter(title, body string) File {
+	b.chapters++
+	f := File{
+		Title:    title,
+		Id:       fmt.Sprintf("Chapter%d", b.chapters),
+		Filename: fmt.Sprintf("OEBPS/Text/Chapter%d.xhtml", b.chapters),
+		Mimetype: "application/xhtml+xml",
+		Content: []byte(ContentPreamble(escapeXml(title)) +
+			body + ContentEnd()),
+	}
+	b.files = append(b.files, f)
+	return f
+}
+
+// Add image CONTENT with mimetype MIMETYPE.
+// The value to use for the src attribute of img tags in chapters is
+// returned.
+func (b *Builder) AddImage(content []byte, mimetype string) string {
+	b.images++
+	id := fmt.Sprintf("Img%d", b.images)
+	b.files = append(b.files, File{
+		Id:       id,
+		Filename: "OEBPS/Images/" + id,
+		Mimetype: mimetype,
+		Content:  content,
+	})
+	return "../Images/" + id
+}
+
+// Add file F as-is.
+// F.Filename should start with "OEBPS/", and F.Id should be unique.
+func (b *Builder) AddFile(f File) {
+	b.files = append(b.files, f)
+}
+
+// Set the cover image to CONTENT with mimetype MIMETYPE.
+// A cover page showing the image is added before the chapters.
+func (b *Builder) SetCover(content []byte, mimetype string) {
+	var page bytes.Buffer
+	page.WriteString(ContentPreamble("cover"))
+	page.WriteString("<img src='../Images/cover' />")
+	page.WriteString(ContentEnd())
+	b.cover = []File{
+		{
+			Id:       "cover-image",
+			Filename: "OEBPS/Images/cover",
+			Mimetype: mimetype,
+			Content:  content,
+		},
+		{
+			Title:    "Cover",
+			Id:       "cover",
+			Filename: "OEBPS/Text/Cover.xhtml",
+			Mimetype: "application/xhtml+xml",
+			Content:  page.Bytes(),
+		},
+	}
+}
+
+// Return all the files of the epub file, including the mandatory
+// ones added by AddExtra.
+func (b *Builder) Files() []File {
+	files := append(append([]File(nil), b.cover...), b.files...)
+	return AddExtra(b.Metadata, files)
+}
+
+// Write the epub file to W.
+func (b *Builder) Build(w io.Writer) error {
+	return Write(w, b.Files(), b.Metadata.Date)
+}
+
+// Write the epub file to FILENAME.
+func (b *Builder) BuildFile(filename string) error {
+	return CreateFile(filename, b.Files(), b.Metadata.Date)
+}
@@ -0,0 +1,495 @@
+// Licensed under BSD 2-Clause License.
+
+// Package epub writes epub 2 and 3 files.
+//
+// An epub file is a zip file with the following required files:
+//   - mimetype - which should be the first and contains the mimetype of
+//     the file---application/epub+zip.
+//   - META-INF/container.xml - this file tells where the "root file" is.
+//     Root file is where the rest of the files listed below are stored.
+//     Usually the location is "OEBPS".
+//   - OEBPS/content.opf - this file lists all the files used by the epub.
+//   - toc.ncx - this has the order of the files to be opened aka Table
+//     of Contents.
+//
+// The epub wikipedia page has a very nice summary: https://en.wikipedia.org/wiki/EPUB#Version_2.0.1
+// Opening the epub archive yourself will also give you a good idea of
+// what needs to be done.
+//
+// Builder is the easiest way to make an epub file.  The other
+// functions can be used for finer control.
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File is a file in the epub archive.
+type File struct {
+	// Title is the title of the chapter if it is a xhtml file.
+	Title string
+
+	// Content is the content of the file.
+	Content []byte
+
+	// Filename of file.
+	Filename string
+
+	// Mimetype of the file.
+	Mimetype string
+
+	// `Id' attribute of the file.
+	Id string
+}
+
+func StripOebpsPrefix(filename string) string {
+	return strings.TrimPrefix(filename, "OEBPS/")
+}
+
+func escapeXml(str string) string {
+	escape := [][]string{
+		{"&", "&amp;"},
+		{"'", "&apos;"},
+		{"\"", "&quot;"},
+		{"<", "&lt;"},
+		{">", "&gt;"},
+	}
+	for _, e := range escape {
+		str = strings.ReplaceAll(str, e[0], e[1])
+	}
+	return str
+}
+
+// Metadata is the metadata of an epub file.
+type Metadata struct {
+	// Author of the series.
+	Author string
+
+	// Identifier is the value of unique-identifier for the series.
+	// This should be a "urn:uuid:" URN, see Uuid.
+	Identifier string
+
+	// Title is the name of the series.
+	Title string
+
+	// Date is the modification date of the epub file.
+	Date time.Time
+
+	// Language is the language code of the series, "en" if empty.
+	Language string
+
+	// Version is the epub version, either 2 or 3.  Zero means 2.
+	Version int
+
+	// Series is the series the book belongs to, if any.  This is
+	// written as Calibre series metadata, and as a collection for
+	// epub 3.
+	Series string
+
+	// Source is the URL the book was made from, if any.
+	Source string
+}
+
+// Return the language of the series with metadata META.
+func (meta Metadata) language() string {
+	if meta.Language == "" {
+		return "en"
+	}
+	return meta.Language
+}
+
+// Return a name-based (version 5) UUID URN for NAME.
+// NAME is hashed in the URL namespace, so the same NAME always gives
+// the same UUID.
+func Uuid(name string) string {
+	// The URL namespace from RFC 4122.
+	ns := []byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1,
+		0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// Return the file contents of the content.opf file for the series.
+// META is the metadata of the series, FILES is a list of File.
+// Filenames are stripped off "OEBPS/" prefix.
+// If the epub file Id is "cover", then it is taken as the cover image
+// page and treated specially.
+// The unique identifier used will always be "BookId".
+func ContentOpf(meta Metadata, files []File) []byte {
+	var content bytes.Buffer
+	var manifest strings.Builder
+	var cover File
+	var coverImg File
+
+	// Do the manifest first and figure out if there's a cover
+	// image.
+	manifest.WriteString("<manifest>")
+	for _, i := range files {
+		if i.Id == "cover" {
+			cover = i
+		}
+		if i.Id == "cover-image" {
+			coverImg = i
+		}
+		manifest.WriteString("\n<item id='")
+		manifest.WriteString(i.Id)
+		manifest.WriteString("' href='")
+		manifest.WriteString(StripOebpsPrefix(i.Filename))
+		manifest.WriteString("' media-type='")
+		manifest.WriteString(i.Mimetype)
+		manifest.WriteString("'")
+		if i.Id == "cover-image" {
+			manifest.WriteString(" properties='cover-image'")
+		}
+		manifest.WriteString(" />")
+	}
+	if meta.Version == 3 {
+		manifest.WriteString("\n<item id='nav' href='nav.xhtml' media-type='application/xhtml+xml' properties='nav'/>")
+	}
+	manifest.WriteString("\n<item id='ncx' href='toc.ncx' media-type='application/x-dtbncx+xml'/>\n</manifest>\n")
+
+	// Header.
+	version := "2.0"
+	if meta.Version == 3 {
+		version = "3.0"
+	}
+	content.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<package version="` + version + `" unique-identifier="BookId" xmlns="http://www.idpf.org/2007/opf">`)
+
+	// First do the metadata section.
+	content.WriteString(`<metadata xmlns:dc="http://purl.org/dc/elements/1.1/"  xmlns:opf="http://www.idpf.org/2007/opf">
+`)
+	content.WriteString("<dc:creator>")
+	content.WriteString(escapeXml(meta.Author))
+	content.WriteString("</dc:creator>\n")
+	// opf:scheme and opf:event are not allowed in epub 3.
+	if meta.Version == 3 {
+		content.WriteString("<dc:identifier id=\"BookId\">")
+	} else {
+		content.WriteString("<dc:identifier id=\"BookId\" opf:scheme=\"UUID\">")
+	}
+	content.WriteString(escapeXml(meta.Identifier))
+	content.WriteString("</dc:identifier>\n")
+	content.WriteString("<dc:language>")
+	content.WriteString(escapeXml(meta.language()))
+	content.WriteString("</dc:language>\n")
+	content.WriteString("<dc:title>")
+	content.WriteString(escapeXml(meta.Title))
+	content.WriteString("</dc:title>\n")
+	if meta.Source != "" {
+		content.WriteString("<dc:source>")
+		content.WriteString(escapeXml(meta.Source))
+		content.WriteString("</dc:source>\n")
+	}
+	if meta.Series != "" {
+		content.WriteString("<meta name=\"calibre:series\" content=\"")
+		content.WriteString(escapeXml(meta.Series))
+		content.WriteString("\" />\n")
+		if meta.Version == 3 {
+			content.WriteString(`<meta property="belongs-to-collection" id="series">`)
+			content.WriteString(escapeXml(meta.Series))
+			content.WriteString("</meta>\n")
+			content.WriteString(`<meta refines="#series" property="collection-type">series</meta>`)
+			content.WriteString("\n")
+		}
+	}
+	date := meta.Date.UTC().Format(time.RFC3339)
+	if meta.Version == 3 {
+		content.WriteString("<dc:date>")
+		content.WriteString(date)
+		content.WriteString("</dc:date>\n")
+		content.WriteString(`<meta property="dcterms:modified">`)
+		content.WriteString(date)
+		content.WriteString("</meta>\n")
+	} else {
+		content.WriteString(`<dc:date opf:event="modification" xmlns:opf="http://www.idpf.org/2007/opf">`)
+		content.WriteString(date)
+		content.WriteString("</dc:date>\n")
+	}
+	if coverImg.Id == "cover-image" {
+		content.WriteString("<meta name='cover' content='")
+		// I can't tell what exactly this should be!
+		// Different epubs use different value here, but
+		// thankfully the exact value does not matter.
+		content.WriteString(coverImg.Id)
+		content.WriteString("' />\n")
+	}
+	content.WriteString("</metadata>\n\n")
+
+	// Manifest section.
+	content.WriteString(manifest.String())
+
+	// Spine section.
+	content.WriteString("\n<spine toc='ncx'>")
+	for _, i := range files {
+		if i.Mimetype != "application/xhtml+xml" {
+			continue
+		}
+		content.WriteString("\n<itemref idref='")
+		content.WriteString(i.Id)
+		content.WriteString("'/>")
+	}
+	content.WriteString("\n</spine>\n")
+
+	if cover.Id == "cover" {
+		content.WriteString(`<guide><reference type="cover" title="Cover" href="`)
+		content.WriteString(StripOebpsPrefix(cover.Filename))
+		content.WriteString(`" /></guide>`)
+	}
+	content.WriteString("</package>\n")
+	return content.Bytes()
+}
+
+// Return the file contents of the toc.ncx file for the series.
+// Arguments have the same meaning as for ContentOpf.
+// FILES with a mimetype other than xhtml, and cover image xhtml file
+// are ignored.
+// Filenames are stripped off "OEBPS/" prefix.
+func TocNcx(meta Metadata, files []File) []byte {
+	var content bytes.Buffer
+
+	// Header.
+	content.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE ncx PUBLIC "-//NISO//DTD ncx 2005-1//EN" "http://www.daisy.org/z3986/2005/ncx-2005-1.dtd">
+
+<ncx version="2005-1" xml:lang="`)
+	content.WriteString(escapeXml(meta.language()))
+	content.WriteString(`" xmlns="http://www.daisy.org/z3986/2005/ncx/">
+  <head>
+    <meta name="dtb:uid" content="`)
+	content.WriteString(escapeXml(meta.Identifier))
+	content.WriteString(`"/>
+    <meta name="dtb:depth" content="1"/>
+    <meta name="dtb:totalPageCount" content="0"/>
+    <meta name="dtb:maxPageNumber" content="0"/>
+  </head>
+
+  <docTitle><text>`)
+	content.WriteString(escapeXml(meta.Title))
+	content.WriteString(`</text></docTitle>
+  <docAuthor><text>`)
+	content.WriteString(escapeXml(meta.Author))
+	content.WriteString(`</text></docAuthor>
+  <navMap>`)
+
+	n := 1
+	// Now for the nested structure.
+	for _, i := range files {
+		// Non-xhtml files.
+		if i.Mimetype != "application/xhtml+xml" {
+			continue
+		}
+		// Ignore cover page.
+		if i.Id == "cover" {
+			continue
+		}
+		content.WriteString("\n<navPoint id='")
+		content.WriteString(i.Id)
+		content.WriteString("' playOrder='")
+		content.WriteString(strconv.Itoa(n))
+		content.WriteString("'>\n")
+
+		content.WriteString("<navLabel><text>")
+		content.WriteString(escapeXml(i.Title))
+		content.WriteString("</text></navLabel>\n")
+		content.WriteString("<content src='")
+		content.WriteString(StripOebpsPrefix(i.Filename))
+		content.WriteString("' />\n</navPoint>")
+		n += 1
+	}
+
+	content.WriteString("\n</navMap>\n</ncx>\n")
+	return content.Bytes()
+}
+
+// Return the file contents of the nav.xhtml file for the series.
+// This is the table of contents for epub 3, and lists the same files
+// as TocNcx.
+func Nav(meta Metadata, files []File) []byte {
+	var content bytes.Buffer
+	lang := escapeXml(meta.language())
+
+	content.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + lang + `" lang="` + lang + `">
+  <head>
+    <title>`)
+	content.WriteString(escapeXml(meta.Title))
+	content.WriteString(`</title>
+  </head>
+  <body>
+    <nav epub:type="toc" id="toc">
+      <h1>Table of Contents</h1>
+      <ol>`)
+	for _, i := range files {
+		if i.Mimetype != "application/xhtml+xml" || i.Id == "cover" {
+			continue
+		}
+		content.WriteString("\n<li><a href='")
+		content.WriteString(StripOebpsPrefix(i.Filename))
+		content.WriteString("'>")
+		content.WriteString(escapeXml(i.Title))
+		content.WriteString("</a></li>")
+	}
+	content.WriteString(`
+      </ol>
+    </nav>
+  </body>
+</html>
+`)
+	return content.Bytes()
+}
+
+// Return the file contents of the container.xml file.
+func ContainerXml() []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+    <rootfiles>
+        <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+   </rootfiles>
+</container>
+`)
+}
+
+// Return the file contents of the mimetype file.
+func Mimetype() []byte {
+	return []byte("application/epub+zip")
+}
+
+// Doctype of the xhtml content files.
+// Epub 3 requires the HTML5 doctype instead, see AddExtra.
+var Xhtml11Doctype = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.1//EN" "http://www.w3.org/TR/xhtml11/DTD/xhtml11.dtd">`
+
+// Return the preamble for xhtml content files for chapter with TITLE.
+func ContentPreamble(title string) string {
+	return `<?xml version="1.0" encoding="UTF-8" ?>
+` + Xhtml11Doctype + `
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en">
+  <head>
+    <meta http-equiv="Content-Type" content="application/xhtml+xml; charset=utf-8" />
+    <title>` + title + `</title>
+  </head>
+  <body>`
+}
+
+// Return the ending part for xhtml content files.
+func ContentEnd() string {
+	return `</body>
+</html>
+`
+}
+
+// Match the src attribute of img elements.
+var imgSrcRe = regexp.MustCompile(`<img\b[^>]*\ssrc=['"]([^'"]*)['"]`)
+
+// Return the filenames of the images the xhtml file F refers to, in
+// the order they appear.
+func ImageRefs(f File) []string {
+	var refs []string
+	for _, m := range imgSrcRe.FindAllSubmatch(f.Content, -1) {
+		refs = append(refs, path.Join(path.Dir(f.Filename), string(m[1])))
+	}
+	return refs
+}
+
+// Write an .epub file with FILES to W.
+// The modification time of all the files in the archive is set to
+// MODIFIED so that the same FILES always give the same .epub file.
+// The mimetype file is stored uncompressed as the spec requires.
+func Write(w io.Writer, files []File, modified time.Time) error {
+	z := zip.NewWriter(w)
+	for _, file := range files {
+		method := zip.Deflate
+		if file.Filename == "mimetype" {
+			method = zip.Store
+		}
+		f, err := z.CreateHeader(&zip.FileHeader{
+			Name:     file.Filename,
+			Method:   method,
+			Modified: modified.UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(file.Content); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// Create an .epub file with filename FILENAME.
+// FILES and MODIFIED are as in Write.
+func CreateFile(filename string, files []File, modified time.Time) error {
+	epubFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := Write(epubFile, files, modified); err != nil {
+		epubFile.Close()
+		return err
+	}
+	return epubFile.Close()
+}
+
+// Add the extra manadatory epub files to FILES.
+// META is passed as-is to ContentOpf and friends.
+// For epub 3, the nav.xhtml file is added too and the doctype of the
+// xhtml files is changed to the HTML5 one.
+func AddExtra(meta Metadata, files []File) []File {
+	contentOpf := ContentOpf(meta, files)
+	tocNcx := TocNcx(meta, files)
+
+	if meta.Version == 3 {
+		files = append([]File(nil), files...)
+		for i, f := range files {
+			if f.Mimetype == "application/xhtml+xml" {
+				files[i].Content = bytes.Replace(f.Content,
+					[]byte(Xhtml11Doctype), []byte("<!DOCTYPE html>"), 1)
+			}
+		}
+		files = append(files, File{
+			Content:  Nav(meta, files),
+			Filename: "OEBPS/nav.xhtml",
+		})
+	}
+
+	files = append(files,
+		[]File{
+			{
+				Content:  contentOpf,
+				Filename: "OEBPS/content.opf",
+			},
+			{
+				Content:  tocNcx,
+				Filename: "OEBPS/toc.ncx",
+			},
+			{
+				Content:  ContainerXml(),
+				Filename: "META-INF/container.xml",
+			},
+		}...)
+	files = append([]File{
+		{
+			Content:  Mimetype(),
+			Filename: "mimetype",
+		},
+	},
+		files...)
+	return files
+}
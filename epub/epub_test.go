@@ -0,0 +1,188 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUuid(t *testing.T) {
+	// uuid.uuid5(uuid.NAMESPACE_URL, ...) in Python.
+	got := Uuid("https://example.com/series/foo/")
+	if want := "urn:uuid:43254818-3460-5608-8281-0d701a711778"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// Return a book made with Builder for version VERSION.
+func testBuilder(version int) *Builder {
+	b := NewBuilder(Metadata{
+		Author:     "Foo & Bar",
+		Identifier: Uuid("https://example.com/series/foo/"),
+		Title:      "Foo <Volume 1>",
+		Date:       time.Date(2023, time.January, 18, 0, 0, 0, 0, time.UTC),
+		Version:    version,
+		Series:     "Foo & Bar's Series",
+		Source:     "https://example.com/series/foo/",
+	})
+	b.SetCover([]byte("cover"), "image/png")
+	src := b.AddImage([]byte("img"), "image/jpeg")
+	b.AddChapter("Prologue", "<p>Hello.</p><img src='"+src+"' />")
+	b.AddChapter("Chapter 1 & 2", "<p>Bye.</p>")
+	return b
+}
+
+// Return the files in the epub file B.
+func testUnzip(t *testing.T, b []byte) ([]*zip.File, map[string]string) {
+	t.Helper()
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, _ := io.ReadAll(r)
+		r.Close()
+		content[f.Name] = string(c)
+	}
+	return z.File, content
+}
+
+func TestBuilder(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testBuilder(2).Build(&buf); err != nil {
+		t.Fatal(err)
+	}
+	files, content := testUnzip(t, buf.Bytes())
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	want := []string{
+		"mimetype",
+		"OEBPS/Images/cover",
+		"OEBPS/Text/Cover.xhtml",
+		"OEBPS/Images/Img1",
+		"OEBPS/Text/Chapter1.xhtml",
+		"OEBPS/Text/Chapter2.xhtml",
+		"OEBPS/content.opf",
+		"OEBPS/toc.ncx",
+		"META-INF/container.xml",
+	}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("got files %v, want %v", names, want)
+	}
+	if files[0].Method != zip.Store {
+		t.Error("mimetype is compressed")
+	}
+	if content["mimetype"] != "application/epub+zip" {
+		t.Errorf("got mimetype %q", content["mimetype"])
+	}
+
+	opf := content["OEBPS/content.opf"]
+	for _, s := range []string{
+		`<dc:creator>Foo &amp; Bar</dc:creator>`,
+		`<dc:title>Foo &lt;Volume 1&gt;</dc:title>`,
+		`<dc:identifier id="BookId" opf:scheme="UUID">urn:uuid:43254818-3460-5608-8281-0d701a711778</dc:identifier>`,
+		`2023-01-18T00:00:00Z`,
+		`<meta name='cover' content='cover-image' />`,
+		"<spine toc='ncx'>\n<itemref idref='cover'/>\n<itemref idref='Chapter1'/>\n<itemref idref='Chapter2'/>\n</spine>",
+		`<item id='Img1' href='Images/Img1' media-type='image/jpeg' />`,
+		`<dc:source>https://example.com/series/foo/</dc:source>`,
+		`<meta name="calibre:series" content="Foo &amp; Bar&apos;s Series" />`,
+	} {
+		if !strings.Contains(opf, s) {
+			t.Errorf("content.opf has no %s", s)
+		}
+	}
+
+	if strings.Contains(opf, "belongs-to-collection") {
+		t.Error("content.opf of version 2 has a collection")
+	}
+
+	ncx := content["OEBPS/toc.ncx"]
+	if strings.Contains(ncx, "Cover.xhtml") {
+		t.Error("toc.ncx lists the cover page")
+	}
+	if !strings.Contains(ncx, "<text>Chapter 1 &amp; 2</text>") {
+		t.Error("toc.ncx has no Chapter 1 & 2")
+	}
+
+	ch := content["OEBPS/Text/Chapter1.xhtml"]
+	if !strings.HasPrefix(ch, ContentPreamble("Prologue")) ||
+		!strings.HasSuffix(ch, ContentEnd()) ||
+		!strings.Contains(ch, "<img src='../Images/Img1' />") {
+		t.Errorf("unexpected chapter\n%s", ch)
+	}
+	if !strings.Contains(content["OEBPS/Text/Chapter2.xhtml"], "<title>Chapter 1 &amp; 2</title>") {
+		t.Error("chapter title is not escaped")
+	}
+}
+
+func TestBuilderVersion3(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testBuilder(3).Build(&buf); err != nil {
+		t.Fatal(err)
+	}
+	_, content := testUnzip(t, buf.Bytes())
+
+	opf := content["OEBPS/content.opf"]
+	for _, s := range []string{
+		`<package version="3.0"`,
+		`<meta property="dcterms:modified">2023-01-18T00:00:00Z</meta>`,
+		`properties='nav'`,
+		`properties='cover-image'`,
+		`<meta property="belongs-to-collection" id="series">Foo &amp; Bar&apos;s Series</meta>`,
+		`<meta refines="#series" property="collection-type">series</meta>`,
+	} {
+		if !strings.Contains(opf, s) {
+			t.Errorf("content.opf has no %s", s)
+		}
+	}
+	nav, ok := content["OEBPS/nav.xhtml"]
+	if !ok {
+		t.Fatal("no nav.xhtml")
+	}
+	if !strings.Contains(nav, "<a href='Text/Chapter1.xhtml'>Prologue</a>") {
+		t.Errorf("nav.xhtml has no Prologue\n%s", nav)
+	}
+	for _, f := range []string{"OEBPS/Text/Cover.xhtml", "OEBPS/Text/Chapter1.xhtml"} {
+		if !strings.Contains(content[f], "<!DOCTYPE html>") {
+			t.Errorf("%s does not have the HTML5 doctype", f)
+		}
+	}
+}
+
+// The same files and date should always give the same epub file.
+func TestBuilderReproducible(t *testing.T) {
+	var a, b bytes.Buffer
+	if err := testBuilder(2).Build(&a); err != nil {
+		t.Fatal(err)
+	}
+	if err := testBuilder(2).Build(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("epub files differ")
+	}
+}
+
+func TestImageRefs(t *testing.T) {
+	f := File{
+		Filename: "OEBPS/Text/Chapter1.xhtml",
+		Content: []byte(`<p><img alt="" src="../Images/a.png"/> <img
+src='../Images/b.jpg' /> <imgx src="c.png"/> <img alt="src=d.png"/></p>`),
+	}
+	got := strings.Join(ImageRefs(f), " ")
+	if want := "OEBPS/Images/a.png OEBPS/Images/b.jpg"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
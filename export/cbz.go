@@ -0,0 +1,147 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/9viz/ln2epub/epub"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Match the number of a volume in its title.
+var volumeNumberRe = regexp.MustCompile(`(?i)\b(?:volume|vol\.?|book|part)\s*(\d+)`)
+
+// Return the images in FILES in reading order: the cover first, then
+// the images in the order the content files refer to them.  Images no
+// content file refers to come last.
+func Images(files []epub.File) []epub.File {
+	byName := make(map[string]epub.File)
+	for _, f := range files {
+		byName[f.Filename] = f
+	}
+	var out []epub.File
+	seen := make(map[string]bool)
+	add := func(f epub.File) {
+		if strings.HasPrefix(f.Mimetype, "image/") && !seen[f.Filename] {
+			seen[f.Filename] = true
+			out = append(out, f)
+		}
+	}
+	for _, f := range files {
+		if f.Id == "cover-image" {
+			add(f)
+		}
+	}
+	for _, f := range files {
+		if !IsContent(f) {
+			continue
+		}
+		for _, name := range epub.ImageRefs(f) {
+			if img, ok := byName[name]; ok {
+				add(img)
+			}
+		}
+	}
+	for _, f := range files {
+		add(f)
+	}
+	return out
+}
+
+// Return the ComicInfo.xml file for the book with metadata META and
+// PAGES pages, the first being the cover if COVER is true.
+func comicInfo(meta epub.Metadata, pages int, cover bool) []byte {
+	var b bytes.Buffer
+	title := meta.Title
+	if meta.Series != "" && strings.HasPrefix(title, meta.Series+" - ") {
+		// The title of the volume, see sites.Book.Title.
+		title = title[len(meta.Series+" - "):]
+	}
+	lang := meta.Language
+	if lang == "" {
+		lang = "en"
+	}
+	b.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	b.WriteString("<ComicInfo xmlns:xsd=\"http://www.w3.org/2001/XMLSchema\" xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\">\n")
+	b.WriteString("  <Title>" + xmlEscape(title) + "</Title>\n")
+	if meta.Series != "" {
+		b.WriteString("  <Series>" + xmlEscape(meta.Series) + "</Series>\n")
+	}
+	if m := volumeNumberRe.FindStringSubmatch(title); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		b.WriteString("  <Volume>" + strconv.Itoa(n) + "</Volume>\n")
+	}
+	if meta.Author != "" {
+		if IsTranslator(meta.Author) {
+			b.WriteString("  <Translator>" + xmlEscape(meta.Author) + "</Translator>\n")
+		} else {
+			b.WriteString("  <Writer>" + xmlEscape(meta.Author) + "</Writer>\n")
+		}
+	}
+	if meta.Source != "" {
+		b.WriteString("  <Web>" + xmlEscape(meta.Source) + "</Web>\n")
+	}
+	b.WriteString("  <LanguageISO>" + xmlEscape(lang) + "</LanguageISO>\n")
+	b.WriteString("  <PageCount>" + strconv.Itoa(pages) + "</PageCount>\n")
+	if cover {
+		b.WriteString("  <Pages>\n    <Page Image=\"0\" Type=\"FrontCover\" />\n  </Pages>\n")
+	}
+	b.WriteString("</ComicInfo>\n")
+	return b.Bytes()
+}
+
+// Write the illustrations of the book with metadata META and FILES to
+// W as a CBZ archive.  The images, see Images, are named after their
+// page number so that they sort in reading order, and the text is left
+// out.  The archive has a ComicInfo.xml file with the title, series
+// and volume.
+func Cbz(w io.Writer, meta epub.Metadata, files []epub.File) error {
+	images := Images(files)
+	if len(images) == 0 {
+		return fmt.Errorf("no images in %s", meta.Title)
+	}
+	cover := images[0].Id == "cover-image"
+	z := zip.NewWriter(w)
+	write := func(name string, method uint16, content []byte) error {
+		fw, err := z.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   method,
+			Modified: meta.Date,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(content)
+		return err
+	}
+	for i, f := range images {
+		// Images are compressed already.
+		name := fmt.Sprintf("%04d%s", i+1, ImageExtension(f.Mimetype))
+		if err := write(name, zip.Store, f.Content); err != nil {
+			return err
+		}
+	}
+	if err := write("ComicInfo.xml", zip.Deflate, comicInfo(meta, len(images), cover)); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// Create the CBZ file FILENAME with the illustrations of the book with
+// metadata META and FILES.
+func CbzFile(filename string, meta epub.Metadata, files []epub.File) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := Cbz(f, meta, files); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return err
+	}
+	return f.Close()
+}
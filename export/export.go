@@ -0,0 +1,254 @@
+// Licensed under BSD 2-Clause License.
+
+// Package export writes books in formats other than epub.
+// The writers take the same files the site adapters make for the epub
+// file, see sites.Book.Files, so every site works with every format.
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/9viz/ln2epub/epub"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// The output formats.
+const (
+	FormatEpub     = "epub"
+	FormatHtml     = "html"
+	FormatMarkdown = "md"
+	FormatText     = "txt"
+	FormatFb2      = "fb2"
+	FormatKepub    = "kepub"
+	FormatCbz      = "cbz"
+)
+
+// Formats are the supported output formats.
+var Formats = []string{FormatEpub, FormatHtml, FormatMarkdown, FormatText, FormatFb2, FormatKepub, FormatCbz}
+
+// Return an error if FORMAT is not a supported output format.
+func Check(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q, should be one of %s",
+		format, strings.Join(Formats, ", "))
+}
+
+// Return the extension of files in FORMAT.
+func Extension(format string) string {
+	if format == FormatKepub {
+		// Kobo e-readers only take them as KEPUB files with
+		// this extension.
+		return ".kepub.epub"
+	}
+	return "." + format
+}
+
+// Return the filename NAME for a book in FORMAT.
+// NAME is usually made from a name template ending in ".epub", which
+// is replaced by the extension for FORMAT.
+func FileName(name, format string) string {
+	if format == FormatEpub {
+		return name
+	}
+	if strings.HasSuffix(strings.ToLower(name), ".epub") {
+		name = name[:len(name)-len(".epub")]
+	}
+	return name + Extension(format)
+}
+
+// Return the file extension for images of MIMETYPE.
+// Images in epub files have none.
+func ImageExtension(mimetype string) string {
+	switch mimetype {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	return ""
+}
+
+// Return true if F is a content file, i.e., a chapter or the cover
+// page.
+func IsContent(f epub.File) bool {
+	return f.Mimetype == "application/xhtml+xml"
+}
+
+// Return true if F is the cover page.
+func IsCover(f epub.File) bool {
+	return f.Id == "cover"
+}
+
+// Return the content of the body element of the content file F.
+func Body(f epub.File) string {
+	s := string(f.Content)
+	if i := strings.Index(s, "<body"); i >= 0 {
+		if j := strings.IndexByte(s[i:], '>'); j >= 0 {
+			s = s[i+j+1:]
+		}
+	}
+	if i := strings.LastIndex(s, "</body>"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// Return FILES with the stylesheet CSS added, and linked to from every
+// content file after its own stylesheets.
+func AddStylesheet(files []epub.File, css string) []epub.File {
+	const name = "OEBPS/Styles/override.css"
+	out := make([]epub.File, 0, len(files)+1)
+	for _, f := range files {
+		if IsContent(f) {
+			up := strings.Repeat("../", strings.Count(epub.StripOebpsPrefix(f.Filename), "/"))
+			link := []byte("<link rel=\"stylesheet\" type=\"text/css\" href=\"" + up + epub.StripOebpsPrefix(name) + "\" />\n")
+			if i := bytes.Index(f.Content, []byte("</head>")); i >= 0 {
+				f.Content = append(append(append([]byte(nil), f.Content[:i]...), link...), f.Content[i:]...)
+			}
+		}
+		out = append(out, f)
+	}
+	return append(out, epub.File{
+		Id:       "override-css",
+		Filename: name,
+		Mimetype: "text/css",
+		Content:  []byte(css),
+	})
+}
+
+// Match the URL attributes of elements.
+var urlAttrRe = regexp.MustCompile(`(\s(?:src|href)=)(['"])([^'"]*)(['"])`)
+
+// Return BODY of the content file F with the URL in every src and href
+// attribute replaced by REPLACE(FILENAME, FRAGMENT), where FILENAME is
+// the file in the epub archive the URL refers to.  REPLACE returns the
+// new URL and true, or false to leave the URL alone.  URLs of other
+// sites are left alone.
+func ReplaceUrls(f epub.File, body string, replace func(filename, fragment string) (string, bool)) string {
+	dir := path.Dir(f.Filename)
+	return urlAttrRe.ReplaceAllStringFunc(body, func(m string) string {
+		sm := urlAttrRe.FindStringSubmatch(m)
+		u := sm[3]
+		if u == "" || strings.Contains(u, ":") || strings.HasPrefix(u, "/") {
+			return m
+		}
+		name, fragment, _ := strings.Cut(u, "#")
+		if name == "" {
+			name = f.Filename
+		} else {
+			name = path.Join(dir, name)
+		}
+		r, ok := replace(name, fragment)
+		if !ok {
+			return m
+		}
+		return sm[1] + sm[2] + r + sm[4]
+	})
+}
+
+// footnotes numbers the footnotes of a book for the converters that
+// write them apart from the text.
+type footnotes struct {
+	// Ids of the footnotes and their numbers, given in the order
+	// they are referred to.
+	notes   map[string]int
+	noteIds map[string]bool
+
+	// True while converting a footnote.
+	inNote bool
+}
+
+// Return the footnotes of the chapters DOCS.
+func newFootnotes(docs []*html.Node) footnotes {
+	return footnotes{notes: make(map[string]int), noteIds: findNotes(docs)}
+}
+
+// Return the ids of the footnotes in DOCS, i.e., the block elements
+// linked to from elsewhere in the book.
+func findNotes(docs []*html.Node) map[string]bool {
+	linked := make(map[string]bool)
+	notes := make(map[string]bool)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			if id := internalLink(n); id != "" {
+				linked[id] = true
+			}
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			walk(ch)
+		}
+	}
+	for _, d := range docs {
+		walk(d)
+	}
+	var blocks func(n *html.Node)
+	blocks = func(n *html.Node) {
+		if n.Type == html.ElementNode && textBlocks[n.DataAtom] && n.DataAtom != atom.Body {
+			if id := attr(n, "id"); id != "" && linked[id] {
+				notes[id] = true
+			}
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			blocks(ch)
+		}
+	}
+	for _, d := range docs {
+		blocks(d)
+	}
+	return notes
+}
+
+// Return the number of footnote ID.
+func (f *footnotes) note(id string) int {
+	n, ok := f.notes[id]
+	if !ok {
+		n = len(f.notes) + 1
+		f.notes[id] = n
+	}
+	return n
+}
+
+// Return true if the element N is a footnote.
+func (f *footnotes) isNote(n *html.Node) bool {
+	return f.noteIds[attr(n, "id")]
+}
+
+// Return the number of the footnote the link to ID within the book
+// refers to, 0 if it is not a footnote, or -1 if the link is in a
+// footnote.  Those link back to the text and are dropped.
+func (f *footnotes) noteLink(id string) int {
+	switch {
+	case f.inNote:
+		return -1
+	case f.noteIds[id]:
+		return f.note(id)
+	}
+	return 0
+}
+
+// Return the number of footnote N and N converted by CONVERT, or 0 if
+// N is not a footnote or is within one.
+func (f *footnotes) noteBlock(n *html.Node, convert func(*html.Node) []string) (int, []string) {
+	if !f.isNote(n) || f.inNote {
+		return 0, nil
+	}
+	f.inNote = true
+	sub := convert(n)
+	f.inNote = false
+	return f.note(attr(n, "id")), sub
+}
@@ -0,0 +1,449 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"github.com/9viz/ln2epub/epub"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Return the metadata and the files of a book with a cover, an image
+// and a footnote linking to the next chapter.
+func testBook() (epub.Metadata, []epub.File) {
+	meta := epub.Metadata{
+		Title:    "Foo <Volume 1>",
+		Author:   "Foo & Bar",
+		Date:     time.Date(2023, time.January, 18, 0, 0, 0, 0, time.UTC),
+		Language: "en",
+		Series:   "Foo",
+		Source:   "https://example.com/foo/",
+	}
+	b := epub.NewBuilder(meta)
+	b.SetCover([]byte("cover"), "image/png")
+	src := b.AddImage([]byte("img"), "image/jpeg")
+	b.AddChapter("Prologue", "<p>Hello.<a href='Chapter2.xhtml#fn1'>[1]</a></p>\n<p><img src='"+src+"' alt='' /></p>")
+	b.AddChapter("Notes & more", "<p id=\"fn1\">A note, see <a href=\"https://example.com/\">here</a>.</p>")
+	b.AddFile(epub.File{Id: "style", Filename: "OEBPS/Styles/style.css", Mimetype: "text/css", Content: []byte("p { text-indent: 1em; }")})
+	var files []epub.File
+	for _, f := range b.Files() {
+		// Leave out the mandatory files like the site adapters do.
+		if f.Mimetype != "" {
+			files = append(files, f)
+		}
+	}
+	return meta, files
+}
+
+func TestFileName(t *testing.T) {
+	for _, test := range [][3]string{
+		{"Foo.epub", FormatEpub, "Foo.epub"},
+		{"Foo.epub", FormatHtml, "Foo.html"},
+		{"Foo.EPUB", FormatHtml, "Foo.html"},
+		{"Foo", FormatHtml, "Foo.html"},
+		{"Foo.epub", FormatKepub, "Foo.kepub.epub"},
+		{"dir.epub/Foo - 1.epub", FormatHtml, "dir.epub/Foo - 1.html"},
+	} {
+		if got := FileName(test[0], test[1]); got != test[2] {
+			t.Errorf("got %s for %s in %s, want %s", got, test[0], test[1], test[2])
+		}
+	}
+	if Check("html") != nil || Check("pdf") == nil {
+		t.Error("wrong formats")
+	}
+}
+
+func TestAddStylesheet(t *testing.T) {
+	_, files := testBook()
+	out := AddStylesheet(files, "p { margin: 0; }")
+	if len(out) != len(files)+1 {
+		t.Fatalf("got %d files, want %d", len(out), len(files)+1)
+	}
+	css := out[len(out)-1]
+	if css.Mimetype != "text/css" || string(css.Content) != "p { margin: 0; }" {
+		t.Errorf("got stylesheet %+v", css)
+	}
+	for i, f := range out[:len(files)] {
+		linked := bytes.Contains(f.Content, []byte("<link rel=\"stylesheet\" type=\"text/css\" href=\"../Styles/override.css\" />\n</head>"))
+		if linked != IsContent(f) {
+			t.Errorf("%s: got linked %v", f.Filename, linked)
+		}
+		if bytes.Contains(files[i].Content, []byte("override.css")) {
+			t.Errorf("%s changed in place", f.Filename)
+		}
+	}
+	var buf bytes.Buffer
+	if err := Html(&buf, epub.Metadata{}, out, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "p { text-indent: 1em; }\np { margin: 0; }\n</style>") {
+		t.Errorf("stylesheet not last in\n%s", got)
+	}
+}
+
+func TestHtml(t *testing.T) {
+	meta, files := testBook()
+	var buf bytes.Buffer
+	if err := Html(&buf, meta, files, ""); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, s := range []string{
+		"<!DOCTYPE html>\n<html lang=\"en\">",
+		"<title>Foo &lt;Volume 1&gt;</title>",
+		"<p class=\"author\">Foo &amp; Bar</p>",
+		"<a href=\"https://example.com/foo/\">",
+		"p { text-indent: 1em; }",
+		"<li><a href=\"#Chapter1\">Prologue</a></li>\n<li><a href=\"#Chapter2\">Notes &amp; more</a></li>\n</ol>",
+		"<section class=\"cover\" id=\"cover\">\n<img src='data:image/png;base64,Y292ZXI=' />\n</section>",
+		"<section class=\"chapter\" id=\"Chapter1\">\n<p>Hello.<a href='#fn1'>[1]</a></p>",
+		"<img src='data:image/jpeg;base64,aW1n' alt='' />",
+		"<a href=\"https://example.com/\">here</a>",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("no %s in\n%s", s, got)
+		}
+	}
+	if strings.Contains(got, "Cover</a>") {
+		t.Error("the cover page is in the table of contents")
+	}
+	if strings.Index(got, "id=\"Chapter1\"") > strings.Index(got, "id=\"Chapter2\"") {
+		t.Error("chapters are out of order")
+	}
+}
+
+func TestHtmlFile(t *testing.T) {
+	meta, files := testBook()
+	dir := t.TempDir()
+	f := filepath.Join(dir, "Foo 1.html")
+	if err := HtmlFile(f, meta, files, true); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"<img src='Foo%201_files/cover.png' />", "<img src='Foo%201_files/Img1.jpg'"} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("no %s in\n%s", s, b)
+		}
+	}
+	img, err := os.ReadFile(filepath.Join(dir, "Foo 1_files", "Img1.jpg"))
+	if err != nil || string(img) != "img" {
+		t.Errorf("got image %q, %v", img, err)
+	}
+}
+
+func TestKepub(t *testing.T) {
+	_, files := testBook()
+	files = append(files, epub.File{Id: "Chapter3", Filename: "OEBPS/Text/Chapter3.xhtml", Mimetype: "application/xhtml+xml",
+		Content: []byte(epub.ContentPreamble("Three") + "<h1>Three</h1>\n<p>\"Well.\" She left! Did he… no?</p>\n<div><p>A &amp; B</p> tail.</div>" + epub.ContentEnd())})
+	kepub := Kepub(files)
+	if len(kepub) != len(files) {
+		t.Fatalf("got %d files, want %d", len(kepub), len(files))
+	}
+	for i, f := range kepub {
+		if !IsContent(f) {
+			if !bytes.Equal(f.Content, files[i].Content) {
+				t.Errorf("%s changed", f.Filename)
+			}
+			continue
+		}
+		d := xml.NewDecoder(bytes.NewReader(f.Content))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v in\n%s", f.Filename, err, f.Content)
+			}
+		}
+	}
+	got := string(kepub[len(kepub)-1].Content)
+	for _, s := range []string{
+		"<title>Three</title>\n  <style type=\"text/css\" id=\"kobostylehacks\">div#book-inner",
+		"<body><div id=\"book-columns\"><div id=\"book-inner\"><h1><span class=\"koboSpan\" id=\"kobo.1.1\">Three</span></h1>",
+		"<p><span class=\"koboSpan\" id=\"kobo.2.1\">\"Well.\" </span><span class=\"koboSpan\" id=\"kobo.2.2\">She left! </span><span class=\"koboSpan\" id=\"kobo.2.3\">Did he… </span><span class=\"koboSpan\" id=\"kobo.2.4\">no?</span></p>",
+		"<p><span class=\"koboSpan\" id=\"kobo.4.1\">A &amp; B</span></p><span class=\"koboSpan\" id=\"kobo.4.2\"> tail.</span></div></div></div></body>",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("no %s in\n%s", s, got)
+		}
+	}
+	for _, f := range kepub {
+		if got := string(f.Content); f.Id == "Chapter1" && !strings.Contains(got, "<span class=\"koboSpan\" id=\"kobo.2.1\"><img src='../Images/Img1' alt='' /></span>") {
+			t.Errorf("image not in a span in\n%s", got)
+		}
+	}
+}
+
+func TestCbz(t *testing.T) {
+	meta := epub.Metadata{
+		Title:  "Foo - Volume 2",
+		Author: "Foo Translations",
+		Date:   time.Date(2023, time.January, 18, 0, 0, 0, 0, time.UTC),
+		Series: "Foo",
+	}
+	b := epub.NewBuilder(meta)
+	b.SetCover([]byte("cover"), "image/jpeg")
+	// Not in any chapter.
+	b.AddImage([]byte("extra"), "image/gif")
+	first := b.AddImage([]byte("first"), "image/png")
+	second := b.AddImage([]byte("second"), "image/jpeg")
+	b.AddChapter("One", "<p>Text.</p><p><img src='"+first+"' alt='' /></p>")
+	b.AddChapter("Two", "<p><img src=\""+second+"\" /><img src='"+first+"' /></p>")
+	var buf bytes.Buffer
+	if err := Cbz(&buf, meta, b.Files()); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{
+		{"0001.jpg", "cover"},
+		{"0002.png", "first"},
+		{"0003.jpg", "second"},
+		{"0004.gif", "extra"},
+	}
+	if len(z.File) != len(want)+1 {
+		t.Fatalf("got %d files, want %d", len(z.File), len(want)+1)
+	}
+	read := func(f *zip.File) string {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	for i, w := range want {
+		if got := z.File[i].Name; got != w[0] {
+			t.Errorf("got file %s, want %s", got, w[0])
+		}
+		if got := read(z.File[i]); got != w[1] {
+			t.Errorf("got %s for %s, want %s", got, w[0], w[1])
+		}
+	}
+	info := read(z.File[len(want)])
+	for _, s := range []string{
+		"<Title>Volume 2</Title>",
+		"<Series>Foo</Series>",
+		"<Volume>2</Volume>",
+		"<Translator>Foo Translations</Translator>",
+		"<PageCount>4</PageCount>",
+		"<Page Image=\"0\" Type=\"FrontCover\" />",
+	} {
+		if !strings.Contains(info, s) {
+			t.Errorf("no %s in\n%s", s, info)
+		}
+	}
+
+	b = epub.NewBuilder(meta)
+	b.AddChapter("One", "<p>Text.</p>")
+	if err := Cbz(io.Discard, meta, b.Files()); err == nil {
+		t.Error("no error for a book without images")
+	}
+}
+
+// Return a book with the chapters in BODIES for the text formats.
+func testTextBook(bodies ...string) (epub.Metadata, []epub.File) {
+	meta := epub.Metadata{
+		Title:  "Foo - Volume 1",
+		Author: "Bar",
+		Date:   time.Date(2023, time.January, 18, 0, 0, 0, 0, time.UTC),
+		Series: "Foo",
+		Source: "https://example.com/foo/",
+	}
+	b := epub.NewBuilder(meta)
+	b.SetCover([]byte("cover"), "image/jpeg")
+	src := b.AddImage([]byte("img"), "image/png")
+	for i, body := range bodies {
+		b.AddChapter("Chapter "+string(rune('1'+i)), strings.ReplaceAll(body, "SRC", src))
+	}
+	var files []epub.File
+	for _, f := range b.Files() {
+		if f.Mimetype != "" {
+			files = append(files, f)
+		}
+	}
+	return meta, files
+}
+
+var testTextBodies = []string{
+	`<h2>The <em>Start</em></h2>
+<p>It was a <em>dark</em> and <strong>stormy</strong> night.<sup><a href="#fn1" id="ref1">1</a></sup></p>
+<p>&nbsp;</p>
+<p>* * *</p>
+<p>Line one<br/>line two with a [bracket] and *star*.</p>
+<hr/>
+<ul><li>First</li><li>Second</li></ul>
+<p><img src='SRC' alt='A map' /></p>
+<p>See <a href="https://example.com/next/">the next chapter</a>.</p>
+<ol><li id="fn1">A storm of <em>words</em>. <a href="#ref1">↩</a></li></ol>`,
+	`<p>1. Not a list.</p>
+<blockquote><p>Quoted.</p></blockquote>`,
+}
+
+func TestMarkdown(t *testing.T) {
+	meta, files := testTextBook(testTextBodies...)
+	dir := t.TempDir()
+	f := filepath.Join(dir, "Foo.md")
+	if err := TextFile(f, FormatMarkdown, meta, files, TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+title: "Foo - Volume 1"
+author: "Bar"
+series: "Foo"
+source: "https://example.com/foo/"
+date: "2023-01-18"
+chapters: 2
+---
+
+![Cover](images/Foo/cover.jpg)
+
+# Chapter 1
+
+## The *Start*
+
+It was a *dark* and **stormy** night.[^1]
+
+* * *
+
+Line one\
+line two with a \[bracket\] and \*star\*.
+
+* * *
+
+- First
+- Second
+
+![A map](images/Foo/Img1.png)
+
+See [the next chapter](https://example.com/next/).
+
+[^1]: A storm of *words*.
+
+# Chapter 2
+
+1\. Not a list.
+
+> Quoted.
+`
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+	if img, err := os.ReadFile(filepath.Join(dir, "images", "Foo", "Img1.png")); err != nil || string(img) != "img" {
+		t.Errorf("got image %q, %v", img, err)
+	}
+}
+
+func TestText(t *testing.T) {
+	meta, files := testTextBook(testTextBodies[0])
+	dir := filepath.Join(t.TempDir(), "Foo")
+	if err := TextFile(dir, FormatText, meta, files, TextOptions{Width: 20, Split: true}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "001.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Title: Chapter 1
+Book: Foo - Volume 1
+Series: Foo
+Chapter: 1
+Source: https://example.com/foo/
+
+Chapter 1
+=========
+
+The _Start_
+===========
+
+It was a _dark_ and
+*stormy* night.[1]
+
+       * * *
+
+Line one
+line two with a
+[bracket] and
+*star*.
+
+       * * *
+
+- First
+- Second
+
+[Image: A map,
+images/Img1.png]
+
+See the next
+chapter.
+
+[1] A storm of
+_words_.
+`
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "images", "Img1.png")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFb2(t *testing.T) {
+	meta, files := testTextBook(testTextBodies...)
+	meta.Author = "Bar Translations"
+	var buf bytes.Buffer
+	if err := Fb2(&buf, meta, files); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	d := xml.NewDecoder(strings.NewReader(got))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("%v in\n%s", err, got)
+		}
+	}
+	for _, s := range []string{
+		"<book-title>Foo - Volume 1</book-title>",
+		"<author><nickname>Bar Translations</nickname></author>",
+		"<translator><nickname>Bar Translations</nickname></translator>",
+		"<coverpage><image l:href=\"#cover.jpg\"/></coverpage>\n<lang>en</lang>",
+		"<sequence name=\"Foo\"/>",
+		"<src-url>https://example.com/foo/</src-url>",
+		"<section id=\"Chapter1\">\n<title><p>Chapter 1</p></title>\n<subtitle>The <emphasis>Start</emphasis></subtitle>\n",
+		"<p>It was a <emphasis>dark</emphasis> and <strong>stormy</strong> night.<sup><a l:href=\"#n1\" type=\"note\">[1]</a></sup></p>\n<subtitle>* * *</subtitle>\n<p>Line one</p>\n<p>line two",
+		"<p>• First</p>\n<p>• Second</p>\n<image l:href=\"#Img1.png\"/>\n",
+		"<a l:href=\"https://example.com/next/\">the next chapter</a>",
+		"<p>1. Not a list.</p>\n<cite><p>Quoted.</p></cite>",
+		"<body name=\"notes\">\n<title><p>Notes</p></title>\n<section id=\"n1\">\n<title><p>1</p></title>\n<p>A storm of <emphasis>words</emphasis>.</p>\n</section>",
+		"<binary id=\"Img1.png\" content-type=\"image/png\">aW1n</binary>",
+		"<binary id=\"cover.jpg\" content-type=\"image/jpeg\">Y292ZXI=</binary>",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("no %s in\n%s", s, got)
+		}
+	}
+	if strings.Contains(got, "&nbsp;") || strings.Contains(got, "<p></p>") {
+		t.Errorf("spacer paragraphs in\n%s", got)
+	}
+}
@@ -0,0 +1,403 @@
+package export
+
+import (
+	"bufio"
+	"encoding/base64"
+	"github.com/9viz/ln2epub/cleanup"
+	"github.com/9viz/ln2epub/epub"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Fb2Genre is the genre of FB2 books, which the format requires.
+// Most light novels are fantasy.
+var Fb2Genre = "sf_fantasy"
+
+// Separators in the inline FB2 markup of a paragraph.  Line breaks
+// start new paragraphs, and images, which are blocks in FB2, are given
+// as fb2Break fb2Image ID fb2Break.
+const (
+	fb2Break = "\x00"
+	fb2Image = "\x01"
+)
+
+// Scene breaks in FB2.
+const fb2SceneBreak = "<subtitle>* * *</subtitle>"
+
+// Tags in FB2 markup.
+var tagRe = regexp.MustCompile(`<[^>]*>`)
+
+// Return S escaped for XML, with the characters XML does not allow
+// removed.
+func xmlEscape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if (r < ' ' && r != '\t' && r != '\n' && r != '\r') || r == '\uFFFE' || r == '\uFFFF' {
+			return -1
+		}
+		return r
+	}, s)
+	return html.EscapeString(s)
+}
+
+// Return NAME as an XML id.
+func fb2Id(name string) string {
+	id := strings.Map(func(r rune) rune {
+		if r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_') {
+			return r
+		}
+		return '_'
+	}, name)
+	if id == "" || !unicode.IsLetter(rune(id[0])) && id[0] != '_' {
+		id = "_" + id
+	}
+	return id
+}
+
+// fb2Converter turns the chapters of a book into FB2 sections.
+type fb2Converter struct {
+	// image returns the id of the binary for the image file NAME in
+	// the epub archive, "" if none.
+	image func(name string) string
+
+	footnotes
+	// Content of the footnotes by number.
+	noteBlocks map[int][]string
+
+	// File being converted.
+	file epub.File
+}
+
+// Return S, inline FB2 markup, wrapped in the element starting with
+// OPEN and ending with CLOSE.  Each paragraph in S is wrapped on its
+// own, keeping the surrounding spaces outside.
+func fb2Wrap(s, open, close string) string {
+	parts := strings.Split(s, fb2Break)
+	for i, p := range parts {
+		t := strings.TrimSpace(p)
+		if t == "" || strings.HasPrefix(p, fb2Image) {
+			continue
+		}
+		j := strings.Index(p, t)
+		parts[i] = p[:j] + open + t + close + p[j+len(t):]
+	}
+	return strings.Join(parts, fb2Break)
+}
+
+// Return the inline content of N as FB2 markup.
+func (c *fb2Converter) inline(n *html.Node) string {
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		b.WriteString(c.inlineNode(ch))
+	}
+	return b.String()
+}
+
+// Return the inline node N as FB2 markup.
+func (c *fb2Converter) inlineNode(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return xmlEscape(spaceRe.ReplaceAllString(n.Data, " "))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return fb2Break
+	case atom.Em, atom.I, atom.Cite:
+		return fb2Wrap(c.inline(n), "<emphasis>", "</emphasis>")
+	case atom.Strong, atom.B:
+		return fb2Wrap(c.inline(n), "<strong>", "</strong>")
+	case atom.S, atom.Del, atom.Strike:
+		return fb2Wrap(c.inline(n), "<strikethrough>", "</strikethrough>")
+	case atom.Sup:
+		return fb2Wrap(c.inline(n), "<sup>", "</sup>")
+	case atom.Sub:
+		return fb2Wrap(c.inline(n), "<sub>", "</sub>")
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		return fb2Wrap(c.inline(n), "<code>", "</code>")
+	case atom.Img:
+		id := c.image(path.Join(path.Dir(c.file.Filename), attr(n, "src")))
+		if id == "" {
+			return ""
+		}
+		return fb2Break + fb2Image + id + fb2Break
+	case atom.A:
+		text := c.inline(n)
+		if id := internalLink(n); id != "" {
+			switch k := c.noteLink(id); {
+			case k < 0:
+				return ""
+			case k > 0:
+				ks := strconv.Itoa(k)
+				return `<a l:href="#n` + ks + `" type="note">[` + ks + `]</a>`
+			}
+			return text
+		}
+		if href := attr(n, "href"); href != "" {
+			return fb2Wrap(text, `<a l:href="`+xmlEscape(href)+`">`, "</a>")
+		}
+		return text
+	case atom.Script, atom.Style:
+		return ""
+	}
+	return c.inline(n)
+}
+
+// Return the paragraphs and images in S, inline FB2 markup, as
+// blocks.  Empty paragraphs, often used as spacers, are left out.
+func (c *fb2Converter) paragraphs(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, fb2Break) {
+		if strings.HasPrefix(p, fb2Image) {
+			out = append(out, `<image l:href="#`+p[len(fb2Image):]+`"/>`)
+			continue
+		}
+		p = strings.TrimFunc(spaceRe.ReplaceAllString(p, " "), unicode.IsSpace)
+		text := html.UnescapeString(tagRe.ReplaceAllString(p, ""))
+		switch {
+		case strings.TrimFunc(text, unicode.IsSpace) == "":
+		case cleanup.IsSceneBreak(text):
+			out = append(out, fb2SceneBreak)
+		default:
+			out = append(out, "<p>"+p+"</p>")
+		}
+	}
+	return out
+}
+
+// Return the blocks in N as FB2 markup.
+func (c *fb2Converter) blocks(n *html.Node) []string {
+	var out []string
+	var inline strings.Builder
+	flush := func() {
+		out = append(out, c.paragraphs(inline.String())...)
+		inline.Reset()
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if ch.Type != html.ElementNode || !textBlocks[ch.DataAtom] {
+			inline.WriteString(c.inlineNode(ch))
+			continue
+		}
+		flush()
+		out = append(out, c.block(ch)...)
+	}
+	flush()
+	return out
+}
+
+// Return the block element N as FB2 markup.  Footnotes are kept for
+// the notes body instead.
+func (c *fb2Converter) block(n *html.Node) []string {
+	if k, sub := c.noteBlock(n, c.blocks); k > 0 {
+		c.noteBlocks[k] = sub
+		return nil
+	}
+
+	switch n.DataAtom {
+	case atom.Hr:
+		return []string{fb2SceneBreak}
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		out := c.paragraphs(c.inline(n))
+		for i, b := range out {
+			if strings.HasPrefix(b, "<p>") {
+				out[i] = "<subtitle>" + b[len("<p>"):len(b)-len("</p>")] + "</subtitle>"
+			}
+		}
+		return out
+	case atom.Ul, atom.Ol:
+		var out []string
+		i := 0
+		for li := n.FirstChild; li != nil; li = li.NextSibling {
+			if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+				continue
+			}
+			if c.isNote(li) {
+				// A list of footnotes.
+				c.block(li)
+				continue
+			}
+			i++
+			marker := "• "
+			if n.DataAtom == atom.Ol {
+				marker = strconv.Itoa(i) + ". "
+			}
+			sub := c.blocks(li)
+			if len(sub) > 0 && strings.HasPrefix(sub[0], "<p>") {
+				sub[0] = "<p>" + marker + sub[0][len("<p>"):]
+			}
+			out = append(out, sub...)
+		}
+		return out
+	case atom.Blockquote:
+		// Citations only have paragraphs, so anything else comes
+		// after.
+		var cite, rest []string
+		for _, b := range c.blocks(n) {
+			if strings.HasPrefix(b, "<p>") || strings.HasPrefix(b, "<subtitle>") {
+				cite = append(cite, b)
+			} else {
+				rest = append(rest, b)
+			}
+		}
+		if len(cite) == 0 {
+			return rest
+		}
+		return append([]string{"<cite>" + strings.Join(cite, "") + "</cite>"}, rest...)
+	case atom.Pre:
+		var out []string
+		for _, l := range strings.Split(strings.Trim(textContent(n), "\n"), "\n") {
+			if strings.TrimSpace(l) == "" {
+				out = append(out, "<empty-line/>")
+			} else {
+				out = append(out, "<p><code>"+xmlEscape(l)+"</code></p>")
+			}
+		}
+		return out
+	}
+	return c.blocks(n)
+}
+
+// Write the FB2 section with ID, TITLE and BLOCKS to W.
+func writeFb2Section(w *bufio.Writer, id, title string, blocks []string) {
+	w.WriteString("<section id=\"" + id + "\">\n<title><p>" + xmlEscape(title) + "</p></title>\n")
+	if len(blocks) == 0 {
+		// Sections cannot be empty.
+		w.WriteString("<empty-line/>\n")
+	}
+	for _, b := range blocks {
+		w.WriteString(b + "\n")
+	}
+	w.WriteString("</section>\n")
+}
+
+// Write the book with metadata META and FILES to W as a FictionBook
+// 2.0 document.  The chapters are in the order of FILES, footnotes are
+// moved to the notes body, and images are embedded as binaries.
+func Fb2(w io.Writer, meta epub.Metadata, files []epub.File) error {
+	byName := make(map[string]epub.File)
+	var images []epub.File
+	var cover string
+	for _, f := range files {
+		byName[f.Filename] = f
+		if strings.HasPrefix(f.Mimetype, "image/") {
+			images = append(images, f)
+			if f.Id == "cover-image" {
+				cover = fb2Id(ImageName(f))
+			}
+		}
+	}
+	chapters, docs, err := parseChapters(files)
+	if err != nil {
+		return err
+	}
+	c := &fb2Converter{
+		image: func(name string) string {
+			f, ok := byName[name]
+			if !ok || !strings.HasPrefix(f.Mimetype, "image/") {
+				return ""
+			}
+			return fb2Id(ImageName(f))
+		},
+		footnotes:  newFootnotes(docs),
+		noteBlocks: make(map[int][]string),
+	}
+
+	bw := bufio.NewWriter(w)
+	lang := meta.Language
+	if lang == "" {
+		lang = "en"
+	}
+	author := meta.Author
+	if author == "" {
+		author = "Unknown"
+	}
+	id := strings.TrimPrefix(meta.Identifier, "urn:uuid:")
+	if id == "" {
+		id = strings.TrimPrefix(epub.Uuid(meta.Title), "urn:uuid:")
+	}
+	date := meta.Date.Format("2006-01-02")
+	bw.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	bw.WriteString("<FictionBook xmlns=\"http://www.gribuser.ru/xml/fictionbook/2.0\" xmlns:l=\"http://www.w3.org/1999/xlink\">\n")
+	bw.WriteString("<description>\n<title-info>\n")
+	bw.WriteString("<genre>" + xmlEscape(Fb2Genre) + "</genre>\n")
+	bw.WriteString("<author><nickname>" + xmlEscape(author) + "</nickname></author>\n")
+	bw.WriteString("<book-title>" + xmlEscape(meta.Title) + "</book-title>\n")
+	if cover != "" {
+		bw.WriteString("<coverpage><image l:href=\"#" + cover + "\"/></coverpage>\n")
+	}
+	bw.WriteString("<lang>" + xmlEscape(lang) + "</lang>\n")
+	if IsTranslator(meta.Author) {
+		bw.WriteString("<translator><nickname>" + xmlEscape(meta.Author) + "</nickname></translator>\n")
+	}
+	if meta.Series != "" {
+		bw.WriteString("<sequence name=\"" + xmlEscape(meta.Series) + "\"/>\n")
+	}
+	bw.WriteString("</title-info>\n<document-info>\n")
+	bw.WriteString("<author><nickname>ln2epub</nickname></author>\n")
+	bw.WriteString("<program-used>ln2epub</program-used>\n")
+	bw.WriteString("<date value=\"" + date + "\">" + date + "</date>\n")
+	if meta.Source != "" {
+		bw.WriteString("<src-url>" + xmlEscape(meta.Source) + "</src-url>\n")
+	}
+	bw.WriteString("<id>" + xmlEscape(id) + "</id>\n<version>1.0</version>\n")
+	bw.WriteString("</document-info>\n</description>\n")
+
+	bw.WriteString("<body>\n<title><p>" + xmlEscape(meta.Title) + "</p></title>\n")
+	for i, doc := range docs {
+		c.file = chapters[i]
+		var blocks []string
+		if body := findBody(doc); body != nil {
+			blocks = c.blocks(body)
+		}
+		writeFb2Section(bw, fb2Id(chapters[i].Id), chapters[i].Title, blocks)
+	}
+	bw.WriteString("</body>\n")
+	if len(c.notes) > 0 {
+		bw.WriteString("<body name=\"notes\">\n<title><p>Notes</p></title>\n")
+		for k := 1; k <= len(c.notes); k++ {
+			writeFb2Section(bw, "n"+strconv.Itoa(k), strconv.Itoa(k), c.noteBlocks[k])
+		}
+		bw.WriteString("</body>\n")
+	}
+
+	for _, f := range images {
+		bw.WriteString("<binary id=\"" + fb2Id(ImageName(f)) + "\" content-type=\"" + xmlEscape(f.Mimetype) + "\">")
+		bw.WriteString(base64.StdEncoding.EncodeToString(f.Content))
+		bw.WriteString("</binary>\n")
+	}
+	bw.WriteString("</FictionBook>\n")
+	return bw.Flush()
+}
+
+// Translation groups, as opposed to authors.
+var translatorRe = regexp.MustCompile(`(?i)\b(?:translations?|translators?|tls?)\b`)
+
+// Return true if NAME, the author of a book, is a translation group.
+// The site adapters give the translators as the author since the
+// pages rarely name the author.
+func IsTranslator(name string) bool {
+	return translatorRe.MatchString(name)
+}
+
+// Create the FB2 file FILENAME for the book with metadata META and
+// FILES.
+func Fb2File(filename string, meta epub.Metadata, files []epub.File) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := Fb2(f, meta, files); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
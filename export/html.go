@@ -0,0 +1,168 @@
+package export
+
+import (
+	"bufio"
+	"encoding/base64"
+	"github.com/9viz/ln2epub/epub"
+	"html"
+	"io"
+	nurl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Stylesheet for reading HTML books in a browser.
+// The stylesheets in the book, if any, come after it.
+var HtmlStylesheet = `body { max-width: 40em; margin: 0 auto; padding: 1em; line-height: 1.5; font-family: serif; }
+img { max-width: 100%; height: auto; }
+header, nav, section { margin-bottom: 3em; }
+section.cover { text-align: center; }
+nav ol { padding-left: 1.5em; }
+`
+
+// Return the filename of image F when written out of the epub archive.
+func ImageName(f epub.File) string {
+	return path.Base(f.Filename) + ImageExtension(f.Mimetype)
+}
+
+// Write the images in FILES to DIR.
+func WriteImages(dir string, files []epub.File) error {
+	made := false
+	for _, f := range files {
+		if !strings.HasPrefix(f.Mimetype, "image/") {
+			continue
+		}
+		if !made {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			made = true
+		}
+		if err := os.WriteFile(filepath.Join(dir, ImageName(f)), f.Content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the book with metadata META and FILES to W as a single HTML
+// file.  The chapters are in the order of FILES, after a linked table
+// of contents, and the stylesheets are inlined.  Images are inlined as
+// data URIs, unless IMAGEDIR is not empty.  Then they are referred to
+// as IMAGEDIR/NAME, see ImageName and WriteImages.
+func Html(w io.Writer, meta epub.Metadata, files []epub.File, imageDir string) error {
+	byName := make(map[string]epub.File)
+	for _, f := range files {
+		byName[f.Filename] = f
+	}
+	// Return the URL for the file NAME.
+	link := func(name, fragment string) (string, bool) {
+		f, ok := byName[name]
+		switch {
+		case !ok:
+			return "", false
+		case IsContent(f) && fragment != "":
+			return "#" + fragment, true
+		case IsContent(f):
+			return "#" + f.Id, true
+		case !strings.HasPrefix(f.Mimetype, "image/"):
+			return "", false
+		case imageDir != "":
+			return imageDir + "/" + escapePath(ImageName(f)), true
+		}
+		return "data:" + f.Mimetype + ";base64," + base64.StdEncoding.EncodeToString(f.Content), true
+	}
+
+	bw := bufio.NewWriter(w)
+	lang := meta.Language
+	if lang == "" {
+		lang = "en"
+	}
+	title := html.EscapeString(meta.Title)
+	bw.WriteString("<!DOCTYPE html>\n<html lang=\"" + html.EscapeString(lang) + "\">\n<head>\n")
+	bw.WriteString("<meta charset=\"utf-8\" />\n")
+	bw.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\" />\n")
+	bw.WriteString("<title>" + title + "</title>\n")
+	if meta.Author != "" {
+		bw.WriteString("<meta name=\"author\" content=\"" + html.EscapeString(meta.Author) + "\" />\n")
+	}
+	bw.WriteString("<style>\n" + HtmlStylesheet)
+	for _, f := range files {
+		if f.Mimetype == "text/css" {
+			bw.Write(f.Content)
+			bw.WriteString("\n")
+		}
+	}
+	bw.WriteString("</style>\n</head>\n<body>\n")
+
+	bw.WriteString("<header>\n<h1>" + title + "</h1>\n")
+	if meta.Author != "" {
+		bw.WriteString("<p class=\"author\">" + html.EscapeString(meta.Author) + "</p>\n")
+	}
+	if meta.Source != "" {
+		src := html.EscapeString(meta.Source)
+		bw.WriteString("<p class=\"source\"><a href=\"" + src + "\">" + src + "</a></p>\n")
+	}
+	bw.WriteString("</header>\n")
+
+	bw.WriteString("<nav id=\"toc\">\n<h2>Contents</h2>\n<ol>\n")
+	for _, f := range files {
+		if IsContent(f) && !IsCover(f) {
+			bw.WriteString("<li><a href=\"#" + html.EscapeString(f.Id) + "\">" +
+				html.EscapeString(f.Title) + "</a></li>\n")
+		}
+	}
+	bw.WriteString("</ol>\n</nav>\n")
+
+	for _, f := range files {
+		if !IsContent(f) {
+			continue
+		}
+		class := "chapter"
+		if IsCover(f) {
+			class = "cover"
+		}
+		bw.WriteString("<section class=\"" + class + "\" id=\"" + html.EscapeString(f.Id) + "\">\n")
+		bw.WriteString(ReplaceUrls(f, Body(f), link))
+		bw.WriteString("\n</section>\n")
+	}
+	bw.WriteString("</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// Return the slash-separated path P with every element escaped for
+// use in a URL.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, s := range parts {
+		parts[i] = html.EscapeString(nurl.PathEscape(s))
+	}
+	return strings.Join(parts, "/")
+}
+
+// Create the HTML file FILENAME for the book with metadata META and
+// FILES.  If EXTERNALIMAGES is true, the images are written to the
+// directory NAME_files next to FILENAME, where NAME is FILENAME
+// without the extension, instead of being inlined.
+func HtmlFile(filename string, meta epub.Metadata, files []epub.File, externalImages bool) error {
+	var imageDir string
+	if externalImages {
+		base := filepath.Base(filename)
+		imageDir = strings.TrimSuffix(base, filepath.Ext(base)) + "_files"
+		if err := WriteImages(filepath.Join(filepath.Dir(filename), imageDir), files); err != nil {
+			return err
+		}
+		imageDir = escapePath(imageDir)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := Html(f, meta, files, imageDir); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/9viz/ln2epub/epub"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"regexp"
+	"strings"
+)
+
+// KepubStylesheet is added to the chapters of KEPUB books so that the
+// wrapper divs do not change the margins.
+var KepubStylesheet = `div#book-inner { margin-top: 0; margin-bottom: 0; }`
+
+// Elements whose text is not split into sentences.
+var kepubSkip = map[string]bool{
+	"script": true, "style": true, "svg": true, "math": true,
+}
+
+// The end of a sentence: the punctuation, any closing quotes and
+// brackets, and the spaces after.
+var sentenceEndRe = regexp.MustCompile(`[.!?…]+["'”’»)\]]*\s+`)
+
+// Return the sentences in TEXT, each with the spaces after it.
+func sentences(text string) []string {
+	var out []string
+	start := 0
+	for _, m := range sentenceEndRe.FindAllStringIndex(text, -1) {
+		out = append(out, text[start:m[1]])
+		start = m[1]
+	}
+	if start < len(text) {
+		out = append(out, text[start:])
+	}
+	return out
+}
+
+// Return the content file F changed for Kobo e-readers, see Kepub.
+// The markup is left as-is, only spans and divs are added to it.
+func kepubFile(f epub.File) epub.File {
+	var b bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(f.Content))
+	inBody := false
+	skip := 0
+	para, sentence := 0, 0
+	span := func(content []byte) {
+		sentence++
+		fmt.Fprintf(&b, `<span class="koboSpan" id="kobo.%d.%d">`, para, sentence)
+		b.Write(content)
+		b.WriteString("</span>")
+	}
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch n := string(name); {
+			case n == "body" && tt == html.StartTagToken:
+				b.Write(raw)
+				b.WriteString(`<div id="book-columns"><div id="book-inner">`)
+				inBody = true
+				continue
+			case kepubSkip[n] && tt == html.StartTagToken:
+				skip++
+			case n == "img" && inBody && skip == 0:
+				span(raw)
+				continue
+			case textBlocks[atom.Lookup(name)]:
+				para++
+				sentence = 0
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch n := string(name); {
+			case n == "head":
+				b.WriteString(`<style type="text/css" id="kobostylehacks">` + KepubStylesheet + "</style>\n")
+			case n == "body" && inBody:
+				b.WriteString("</div></div>")
+				inBody = false
+			case kepubSkip[n] && skip > 0:
+				skip--
+			}
+		case html.TextToken:
+			if !inBody || skip > 0 {
+				break
+			}
+			for _, s := range sentences(string(raw)) {
+				if strings.TrimSpace(s) == "" {
+					b.WriteString(s)
+				} else {
+					span([]byte(s))
+				}
+			}
+			continue
+		}
+		b.Write(raw)
+	}
+	f.Content = b.Bytes()
+	return f
+}
+
+// Return FILES with the chapters changed for Kobo e-readers, which
+// count pages and keep reading statistics and highlights by sentence.
+// Every sentence and image is wrapped in a koboSpan span with the id
+// kobo.PARAGRAPH.SENTENCE, the body is wrapped in the book-columns and
+// book-inner divs, and KepubStylesheet is added.
+func Kepub(files []epub.File) []epub.File {
+	out := make([]epub.File, len(files))
+	for i, f := range files {
+		if IsContent(f) {
+			f = kepubFile(f)
+		}
+		out[i] = f
+	}
+	return out
+}
@@ -0,0 +1,557 @@
+package export
+
+import (
+	"fmt"
+	"github.com/9viz/ln2epub/cleanup"
+	"github.com/9viz/ln2epub/epub"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TextOptions are how books are written in the md and txt formats.
+type TextOptions struct {
+	// Width is the column plain text is wrapped at, 0 for no
+	// wrapping.
+	Width int
+
+	// Split is true if each chapter should be written to its own
+	// file.
+	Split bool
+}
+
+// Block elements, anything else is taken as inline.
+var textBlocks = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true,
+	atom.Blockquote: true, atom.Center: true, atom.Dd: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Header: true, atom.Hr: true,
+	atom.Li: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Table: true, atom.Tr: true,
+	atom.Ul: true, atom.Body: true,
+}
+
+// textConverter turns the chapters of a book into Markdown or plain
+// text.
+type textConverter struct {
+	md    bool
+	width int
+
+	// imageUrl returns the reference to the image file NAME in the
+	// epub archive, "" if none.
+	imageUrl func(name string) string
+
+	footnotes
+
+	// File being converted.
+	file epub.File
+}
+
+// Return the id the link A refers to if it is a link within the book,
+// or "".
+func internalLink(a *html.Node) string {
+	href := attr(a, "href")
+	if href == "" || strings.Contains(href, ":") {
+		return ""
+	}
+	_, fragment, _ := strings.Cut(href, "#")
+	return fragment
+}
+
+// Return the value of attribute KEY of N.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// Return the reference to footnote N.
+func (c *textConverter) noteRef(n int) string {
+	if c.md {
+		return "[^" + strconv.Itoa(n) + "]"
+	}
+	return "[" + strconv.Itoa(n) + "]"
+}
+
+// Markdown characters escaped in text.
+var mdEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`,
+	"`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+
+// Collapse whitespace.
+var spaceRe = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// Return the inline content of N.
+func (c *textConverter) inline(n *html.Node) string {
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		b.WriteString(c.inlineNode(ch))
+	}
+	return b.String()
+}
+
+// Return S wrapped in MARK, keeping the surrounding spaces outside.
+func wrapMark(s, mark string) string {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return s
+	}
+	i := strings.Index(s, t)
+	return s[:i] + mark + t + mark + s[i+len(t):]
+}
+
+// Return the inline node N as text.
+func (c *textConverter) inlineNode(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		s := spaceRe.ReplaceAllString(n.Data, " ")
+		if c.md {
+			s = mdEscaper.Replace(s)
+		}
+		return s
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		if c.md {
+			return "\\\n"
+		}
+		return "\n"
+	case atom.Em, atom.I, atom.Cite:
+		if c.md {
+			return wrapMark(c.inline(n), "*")
+		}
+		return wrapMark(c.inline(n), "_")
+	case atom.Strong, atom.B:
+		if c.md {
+			return wrapMark(c.inline(n), "**")
+		}
+		return wrapMark(c.inline(n), "*")
+	case atom.S, atom.Del, atom.Strike:
+		if c.md {
+			return wrapMark(c.inline(n), "~~")
+		}
+	case atom.Img:
+		src := c.imageUrl(path.Join(path.Dir(c.file.Filename), attr(n, "src")))
+		if src == "" {
+			return ""
+		}
+		alt := spaceRe.ReplaceAllString(attr(n, "alt"), " ")
+		if c.md {
+			return "![" + mdEscaper.Replace(alt) + "](" + strings.ReplaceAll(src, " ", "%20") + ")"
+		}
+		if alt != "" {
+			return "[Image: " + alt + ", " + src + "]"
+		}
+		return "[Image: " + src + "]"
+	case atom.A:
+		text := c.inline(n)
+		if id := internalLink(n); id != "" {
+			switch k := c.noteLink(id); {
+			case k < 0:
+				return ""
+			case k > 0:
+				return c.noteRef(k)
+			}
+			return text
+		}
+		href := attr(n, "href")
+		if c.md && href != "" && strings.TrimSpace(text) != "" {
+			return "[" + text + "](" + strings.ReplaceAll(href, " ", "%20") + ")"
+		}
+		return text
+	case atom.Script, atom.Style:
+		return ""
+	}
+	return c.inline(n)
+}
+
+// Return paragraph S tidied up: the spaces of every line collapsed and
+// trimmed, and Markdown syntax at the start escaped.
+func (c *textConverter) tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	var out []string
+	for _, l := range lines {
+		l = strings.TrimFunc(spaceRe.ReplaceAllString(l, " "), unicode.IsSpace)
+		if l != "" && l != `\` {
+			out = append(out, l)
+		}
+	}
+	s = strings.Join(out, "\n")
+	s = strings.TrimSuffix(s, `\`)
+	if c.md && s != "" {
+		if strings.ContainsRune("#>+-=", rune(s[0])) {
+			s = `\` + s
+		} else if m := mdOrderedRe.FindStringIndex(s); m != nil {
+			s = s[:m[1]-2] + `\` + s[m[1]-2:]
+		}
+	}
+	return s
+}
+
+var mdOrderedRe = regexp.MustCompile(`^\d+\. `)
+
+// Return the scene break marker.
+func (c *textConverter) sceneBreak() string {
+	if c.md {
+		return "* * *"
+	}
+	if c.width > 0 {
+		return strings.Repeat(" ", (c.width-5)/2) + "* * *"
+	}
+	return "* * *"
+}
+
+// Return the blocks in N, each a paragraph, heading, etc.
+func (c *textConverter) blocks(n *html.Node) []string {
+	var out []string
+	var inline strings.Builder
+	flush := func() {
+		p := c.tidy(inline.String())
+		inline.Reset()
+		switch {
+		case p == "":
+		case cleanup.IsSceneBreak(strings.ReplaceAll(p, `\`, "")):
+			out = append(out, c.sceneBreak())
+		default:
+			out = append(out, c.wrap(p))
+		}
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if ch.Type != html.ElementNode || !textBlocks[ch.DataAtom] {
+			inline.WriteString(c.inlineNode(ch))
+			continue
+		}
+		flush()
+		out = append(out, c.block(ch)...)
+	}
+	flush()
+	return out
+}
+
+// Return the block element N as blocks.
+func (c *textConverter) block(n *html.Node) []string {
+	if k, sub := c.noteBlock(n, c.blocks); k > 0 {
+		text := strings.Join(sub, " ")
+		ref := c.noteRef(k)
+		if c.md {
+			return []string{ref + ": " + text}
+		}
+		return []string{c.wrap(ref + " " + strings.ReplaceAll(text, "\n", " "))}
+	}
+
+	switch n.DataAtom {
+	case atom.Hr:
+		return []string{c.sceneBreak()}
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		t := strings.ReplaceAll(c.tidy(c.inline(n)), "\\\n", " ")
+		t = strings.ReplaceAll(t, "\n", " ")
+		if t == "" {
+			return nil
+		}
+		if c.md {
+			return []string{strings.Repeat("#", level) + " " + strings.TrimPrefix(t, `\`)}
+		}
+		under := "-"
+		if level <= 2 {
+			under = "="
+		}
+		return []string{t + "\n" + strings.Repeat(under, len([]rune(t)))}
+	case atom.Ul, atom.Ol:
+		var items, notes []string
+		i := 0
+		for li := n.FirstChild; li != nil; li = li.NextSibling {
+			if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+				continue
+			}
+			if c.isNote(li) {
+				// A list of footnotes.
+				notes = append(notes, c.block(li)...)
+				continue
+			}
+			i++
+			marker := "- "
+			if n.DataAtom == atom.Ol {
+				marker = strconv.Itoa(i) + ". "
+			}
+			text := strings.Join(c.blocks(li), "\n")
+			if text != "" {
+				items = append(items, marker+strings.ReplaceAll(text, "\n", "\n"+strings.Repeat(" ", len(marker))))
+			}
+		}
+		if len(items) == 0 {
+			return notes
+		}
+		return append([]string{strings.Join(items, "\n")}, notes...)
+	case atom.Blockquote:
+		sub := c.blocks(n)
+		if len(sub) == 0 {
+			return nil
+		}
+		text := strings.Join(sub, "\n\n")
+		if c.md {
+			return []string{"> " + strings.ReplaceAll(text, "\n", "\n> ")}
+		}
+		return []string{"    " + strings.ReplaceAll(text, "\n", "\n    ")}
+	case atom.Pre:
+		text := strings.Trim(textContent(n), "\n")
+		if c.md {
+			return []string{"```\n" + text + "\n```"}
+		}
+		return []string{text}
+	}
+	return c.blocks(n)
+}
+
+// Return the text of N as-is.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		b.WriteString(textContent(ch))
+	}
+	return b.String()
+}
+
+// Return paragraph S wrapped at the width of plain text.
+func (c *textConverter) wrap(s string) string {
+	if c.md || c.width <= 0 {
+		return s
+	}
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		col := 0
+		var b strings.Builder
+		for _, w := range strings.Fields(line) {
+			n := len([]rune(w))
+			if col > 0 && col+1+n > c.width {
+				b.WriteString("\n")
+				col = 0
+			} else if col > 0 {
+				b.WriteString(" ")
+				col++
+			}
+			b.WriteString(w)
+			col += n
+		}
+		out = append(out, b.String())
+	}
+	return strings.Join(out, "\n")
+}
+
+// Return the body element of DOC.
+func findBody(doc *html.Node) *html.Node {
+	if doc.Type == html.ElementNode && doc.DataAtom == atom.Body {
+		return doc
+	}
+	for ch := doc.FirstChild; ch != nil; ch = ch.NextSibling {
+		if b := findBody(ch); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// TextChapter is a chapter converted to Markdown or plain text.
+type TextChapter struct {
+	// N is the number of the chapter, starting from 1.
+	N     int
+	Title string
+	Text  string
+}
+
+// Return the chapters in FILES, leaving out the cover page, and their
+// parsed documents.
+func parseChapters(files []epub.File) ([]epub.File, []*html.Node, error) {
+	var chapters []epub.File
+	var docs []*html.Node
+	for _, f := range files {
+		if !IsContent(f) || IsCover(f) {
+			continue
+		}
+		doc, err := html.Parse(strings.NewReader(string(f.Content)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", f.Filename, err)
+		}
+		chapters = append(chapters, f)
+		docs = append(docs, doc)
+	}
+	return chapters, docs, nil
+}
+
+// Convert the chapters in FILES to Markdown if MD is true, plain text
+// otherwise.  The cover page is left out.  The text is wrapped at
+// WIDTH if not zero, and images are referred to by IMAGEURL, see
+// textConverter.
+func convertText(files []epub.File, md bool, width int, imageUrl func(string) string) ([]TextChapter, error) {
+	chapters, docs, err := parseChapters(files)
+	if err != nil {
+		return nil, err
+	}
+	c := &textConverter{
+		md:        md,
+		width:     width,
+		imageUrl:  imageUrl,
+		footnotes: newFootnotes(docs),
+	}
+
+	var out []TextChapter
+	for i, doc := range docs {
+		c.file = chapters[i]
+		var blocks []string
+		if body := findBody(doc); body != nil {
+			blocks = c.blocks(body)
+		}
+		out = append(out, TextChapter{
+			N:     i + 1,
+			Title: chapters[i].Title,
+			Text:  strings.Join(blocks, "\n\n"),
+		})
+	}
+	return out, nil
+}
+
+// Return S quoted for YAML.
+func yamlQuote(s string) string {
+	return strconv.Quote(s)
+}
+
+// Return the front matter of a Markdown file with FIELDS, pairs of
+// keys and values.  Empty values are left out.
+func frontMatter(md bool, fields ...string) string {
+	var b strings.Builder
+	if md {
+		b.WriteString("---\n")
+	}
+	for i := 0; i < len(fields); i += 2 {
+		k, v := fields[i], fields[i+1]
+		if v == "" {
+			continue
+		}
+		if md {
+			if _, err := strconv.Atoi(v); err != nil {
+				v = yamlQuote(v)
+			}
+			b.WriteString(k + ": " + v + "\n")
+		} else {
+			b.WriteString(strings.ToUpper(k[:1]) + k[1:] + ": " + v + "\n")
+		}
+	}
+	if md {
+		b.WriteString("---\n")
+	}
+	return b.String()
+}
+
+// Return the title of chapter CH as a heading.
+func (ch TextChapter) heading(md bool) string {
+	if md {
+		return "# " + mdEscaper.Replace(ch.Title)
+	}
+	return ch.Title + "\n" + strings.Repeat("=", len([]rune(ch.Title)))
+}
+
+// Write the book with metadata META and FILES to FILENAME in FORMAT,
+// FormatMarkdown or FormatText.  The images are written to the images
+// directory next to FILENAME.
+// If OPTS.Split is true, FILENAME is a directory where each chapter
+// is written to a file of its own named after its number, e.g.,
+// 001.md, with front matter giving the title, the chapter number and
+// the source URL.  Otherwise, the chapters are written one after the
+// other to FILENAME with front matter for the book.
+func TextFile(filename, format string, meta epub.Metadata, files []epub.File, opts TextOptions) error {
+	md := format == FormatMarkdown
+	dir, base := filepath.Dir(filename), filepath.Base(filename)
+	imageDir := filepath.Join("images", strings.TrimSuffix(base, filepath.Ext(base)))
+	if opts.Split {
+		dir, imageDir = filename, "images"
+	}
+	byName := make(map[string]epub.File)
+	var images []epub.File
+	var cover string
+	for _, f := range files {
+		byName[f.Filename] = f
+	}
+	imageUrl := func(name string) string {
+		f, ok := byName[name]
+		if !ok || !strings.HasPrefix(f.Mimetype, "image/") {
+			return ""
+		}
+		return filepath.ToSlash(filepath.Join(imageDir, ImageName(f)))
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Mimetype, "image/") {
+			images = append(images, f)
+			if f.Id == "cover-image" {
+				cover = imageUrl(f.Filename)
+			}
+		}
+	}
+
+	chapters, err := convertText(files, md, opts.Width, imageUrl)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if len(images) > 0 {
+		if err := WriteImages(filepath.Join(dir, imageDir), images); err != nil {
+			return err
+		}
+	}
+
+	ext := Extension(format)
+	if opts.Split {
+		for _, ch := range chapters {
+			text := frontMatter(md,
+				"title", ch.Title,
+				"book", meta.Title,
+				"series", meta.Series,
+				"chapter", strconv.Itoa(ch.N),
+				"source", meta.Source) +
+				"\n" + ch.heading(md) + "\n\n" + ch.Text + "\n"
+			name := filepath.Join(dir, fmt.Sprintf("%03d%s", ch.N, ext))
+			if err := os.WriteFile(name, []byte(text), 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString(frontMatter(md,
+		"title", meta.Title,
+		"author", meta.Author,
+		"series", meta.Series,
+		"language", meta.Language,
+		"source", meta.Source,
+		"date", meta.Date.Format("2006-01-02"),
+		"chapters", strconv.Itoa(len(chapters))))
+	if md && cover != "" {
+		b.WriteString("\n![Cover](" + strings.ReplaceAll(cover, " ", "%20") + ")\n")
+	}
+	for _, ch := range chapters {
+		b.WriteString("\n" + ch.heading(md) + "\n\n")
+		if ch.Text != "" {
+			b.WriteString(ch.Text + "\n")
+		}
+	}
+	return os.WriteFile(filename, []byte(b.String()), 0644)
+}
@@ -0,0 +1,231 @@
+package fetch
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/progress"
+	"golang.org/x/net/publicsuffix"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CookieJar is a cookie jar that can be loaded from, and saved to, a
+// Netscape cookies.txt file like the ones exported by browsers.
+type CookieJar struct {
+	mu  sync.Mutex
+	jar *cookiejar.Jar
+
+	// Cookies to save, keyed by domain, path and name.
+	cookies map[string]cookieEntry
+}
+
+// A line in a cookies.txt file.
+type cookieEntry struct {
+	// Domain is the domain of the cookie.  If Subdomains is true,
+	// the cookie is sent to its subdomains too.
+	Domain     string
+	Subdomains bool
+	Path       string
+	Secure     bool
+	HttpOnly   bool
+	// Expires is zero for session cookies.
+	Expires time.Time
+	Name    string
+	Value   string
+}
+
+// Return a new empty CookieJar.
+func NewCookieJar() *CookieJar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &CookieJar{jar: jar, cookies: make(map[string]cookieEntry)}
+}
+
+// Return the cookies to send in a request to U.
+func (j *CookieJar) Cookies(u *nurl.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// Handle the COOKIES received in a response from U.
+func (j *CookieJar) SetCookies(u *nurl.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range cookies {
+		e := cookieEntry{
+			Domain:   u.Hostname(),
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			Expires:  c.Expires,
+			Name:     c.Name,
+			Value:    c.Value,
+		}
+		if c.Domain != "" {
+			e.Domain = "." + strings.TrimPrefix(c.Domain, ".")
+			e.Subdomains = true
+		}
+		if e.Path == "" {
+			e.Path = "/"
+		}
+		if c.MaxAge > 0 {
+			e.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		key := e.Domain + "\t" + e.Path + "\t" + e.Name
+		if c.MaxAge < 0 || (!e.Expires.IsZero() && e.Expires.Before(time.Now())) {
+			delete(j.cookies, key)
+			continue
+		}
+		j.cookies[key] = e
+	}
+}
+
+// Add the cookies in Netscape cookies.txt format from R to the jar.
+func (j *CookieJar) Load(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		f := strings.Split(line, "\t")
+		if len(f) != 7 {
+			return fmt.Errorf("line %d: expected 7 fields, found %d", n, len(f))
+		}
+		exp, err := strconv.ParseInt(f[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid expiry %s", n, f[4])
+		}
+		c := &http.Cookie{
+			Path:     f[2],
+			Secure:   f[3] == "TRUE",
+			HttpOnly: httpOnly,
+			Name:     f[5],
+			Value:    f[6],
+		}
+		if exp != 0 {
+			c.Expires = time.Unix(exp, 0)
+		}
+		if f[1] == "TRUE" {
+			c.Domain = f[0]
+		}
+		u := &nurl.URL{Scheme: "http", Host: strings.TrimPrefix(f[0], "."), Path: f[2]}
+		if c.Secure {
+			u.Scheme = "https"
+		}
+		j.SetCookies(u, []*http.Cookie{c})
+	}
+	return sc.Err()
+}
+
+// Write the cookies in the jar to W in Netscape cookies.txt format.
+// Expired cookies are left out.
+func (j *CookieJar) Save(w io.Writer) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var keys []string
+	for k := range j.cookies {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	bool := func(b bool) string {
+		if b {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Netscape HTTP Cookie File\n")
+	for _, k := range keys {
+		e := j.cookies[k]
+		var exp int64
+		if !e.Expires.IsZero() {
+			if e.Expires.Before(time.Now()) {
+				continue
+			}
+			exp = e.Expires.Unix()
+		}
+		if e.HttpOnly {
+			bw.WriteString("#HttpOnly_")
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			e.Domain, bool(e.Subdomains), e.Path, bool(e.Secure),
+			exp, e.Name, e.Value)
+	}
+	return bw.Flush()
+}
+
+// Add the cookies in the cookies.txt file FILENAME to the jar.
+// It is not an error if FILENAME does not exist.
+func (j *CookieJar) LoadFile(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := j.Load(f); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// Save the cookies in the jar to the cookies.txt file FILENAME.
+// The file is only readable by the user since it has login cookies.
+func (j *CookieJar) SaveFile(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := j.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load the persistent cookies, and the cookies in IMPORT if it is not
+// empty.
+func CookiesInit(imp string) error {
+	if config.Config.CookieFile != "" {
+		if err := Jar.LoadFile(config.Config.CookieFile); err != nil {
+			return err
+		}
+	}
+	if imp != "" {
+		if _, err := os.Stat(imp); err != nil {
+			return err
+		}
+		return Jar.LoadFile(imp)
+	}
+	return nil
+}
+
+// Save the persistent cookies.
+func CookiesSave() {
+	if config.Config.CookieFile == "" {
+		return
+	}
+	if err := Jar.SaveFile(config.Config.CookieFile); err != nil {
+		progress.Error(err)
+	}
+}
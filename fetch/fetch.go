@@ -0,0 +1,253 @@
+// Licensed under BSD 2-Clause License.
+
+// Package fetch makes the HTTP requests for the site adapters.
+// All requests go through Client, which honours the proxy, cookie and
+// politeness settings in config.Config.
+package fetch
+
+import (
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/progress"
+	"io/ioutil"
+	"net/http"
+	nurl "net/url"
+	"strings"
+	"sync"
+)
+
+// Name we go by in the User-Agent header and robots.txt.
+var Agent = "ln2epub"
+
+// Return the default User-Agent header.
+// If CONTACT is not empty, it is included so that site owners can
+// reach us.
+func UserAgent(contact string) string {
+	info := "+https://github.com/9viz/ln2epub"
+	if contact != "" {
+		info += "; " + contact
+	}
+	return Agent + " (" + info + ")"
+}
+
+// Headers to use when making HTTP requests.
+var DefaultHeaders map[string][]string = map[string][]string{
+	"User-Agent": {UserAgent("")},
+}
+
+// Return the headers to use for a request to URL.
+// These are DefaultHeaders with the headers from the configuration for all
+// hosts, and for the host of URL, on top.
+func fetchHeaders(url string) http.Header {
+	header := make(http.Header)
+	for k, v := range DefaultHeaders {
+		header[k] = append([]string(nil), v...)
+	}
+
+	if config.Config.Contact != "" {
+		header.Set("User-Agent", UserAgent(config.Config.Contact))
+	}
+
+	var host config.Host
+	if u, err := nurl.Parse(url); err == nil {
+		host = config.HostFor(u.Hostname())
+	}
+	for _, ua := range []string{config.Config.UserAgent, host.UserAgent} {
+		if ua != "" {
+			header.Set("User-Agent", ua)
+		}
+	}
+	for _, h := range []map[string]string{config.Config.Headers, host.Headers} {
+		for k, v := range h {
+			header.Set(k, v)
+		}
+	}
+	return header
+}
+
+// Return the proxy to use for request REQ.
+// The proxy for the host of REQ takes precedence over the one for all
+// requests, which in turn takes precedence over the environment
+// variables.
+func fetchProxy(req *http.Request) (*nurl.URL, error) {
+	proxy := config.HostFor(req.URL.Hostname()).Proxy
+	if proxy == "" {
+		proxy = config.Config.Proxy
+	}
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment(req)
+	case "direct":
+		return nil, nil
+	}
+	return nurl.Parse(proxy)
+}
+
+// Cookies for all requests.
+var Jar = NewCookieJar()
+
+// Client used for all requests.
+// Its transport is shared so that connections are reused, and uses
+// fetchProxy to pick the proxy.
+var Client = &http.Client{Transport: fetchTransport(), Jar: Jar}
+
+func fetchTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = fetchProxy
+	return t
+}
+
+// Pages fetched while caching is enabled, with key as URL.
+// See Prefetch.
+var PageCache = struct {
+	sync.Mutex
+	enabled bool
+	pages   map[string][]byte
+}{pages: make(map[string][]byte)}
+
+// Enable or disable caching of fetched pages according to ENABLE.
+// Disabling also empties the cache.
+func PageCacheEnable(enable bool) {
+	PageCache.Lock()
+	defer PageCache.Unlock()
+	PageCache.enabled = enable
+	if !enable {
+		PageCache.pages = make(map[string][]byte)
+	}
+}
+
+// Remove URL from PageCache.
+func PageCacheForget(url string) {
+	PageCache.Lock()
+	defer PageCache.Unlock()
+	delete(PageCache.pages, url)
+}
+
+// Fetch URLS with N requests in parallel and store them in PageCache.
+// Caching should be enabled beforehand.  Errors are ignored here, the
+// page will be requested again when needed.
+func Prefetch(urls []string, n int) {
+	ch := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range ch {
+				fetch(u, nil)
+			}
+		}()
+	}
+	for _, u := range urls {
+		ch <- u
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// Make a GET/POST request for URL.
+func fetch(url string, postform nurl.Values) ([]byte, error) {
+	if postform == nil {
+		PageCache.Lock()
+		body, ok := PageCache.pages[url]
+		PageCache.Unlock()
+		if ok {
+			return body, nil
+		}
+	}
+
+	var req *http.Request
+	if postform == nil {
+		req, _ = http.NewRequest("GET", url, nil)
+		req.Header = fetchHeaders(url)
+	} else {
+		req, _ = http.NewRequest("POST", url,
+			strings.NewReader(postform.Encode()))
+		req.Header = fetchHeaders(url)
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if err := PoliteWait(req.URL); err != nil {
+		return []byte(""), err
+	}
+	resp, err := Client.Do(req)
+	if err != nil {
+		return []byte(""), err
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	progress.Fetched(url, len(body))
+
+	if postform == nil {
+		PageCache.Lock()
+		if PageCache.enabled {
+			PageCache.pages[url] = body
+		}
+		PageCache.Unlock()
+	}
+
+	return body, nil
+}
+
+// Make a GET request for URL.
+// The response body and error, if any, are returned.
+// Password protected WordPress posts are unlocked with WpUnlock and
+// the password given to WpUsePassword.
+func Request(url string) (string, error) {
+	b, e := fetch(url, nil)
+	if e == nil {
+		if action := WpPasswordForm(string(b)); action != "" {
+			return WpUnlock(url, action, wpCurrentPassword())
+		}
+	}
+	return string(b), e
+}
+
+// Make a POST rqeuest for URL with form POSTFORM.
+func PostForm(url string, postform nurl.Values) (string, error) {
+	b, e := fetch(url, postform)
+	return string(b), e
+}
+
+// Fetch the image from url URL.
+// Return the image file contents, image mimetype.
+// The image is processed according to config.Config.Images.
+func Image(url string) ([]byte, string) {
+	img, _ := fetch(url, nil)
+	return ImageProcess(img, http.DetectContentType(img))
+}
+
+// Fetch the cover image from url URL.
+// Return the image file contents, image mimetype.
+// The image is processed according to config.Config.Images, see
+// CoverProcess.
+func Cover(url string) ([]byte, string) {
+	img, _ := fetch(url, nil)
+	return CoverProcess(img, http.DetectContentType(img))
+}
+
+// Fetched images with key as URL.
+var ImageCache = make(map[string]epub.File)
+
+// Return image located at URL if cached, or make new one.
+// N is the chapter name, and IMGCOUNTER is the number assigned to
+// image.  These are used if it is not found in `ImageCache'.
+// The second return value is the new IMGCOUNTER value.
+func ImageCached(url string, n, imgCounter int) (epub.File, int) {
+	var ifile epub.File
+	var ok bool
+	if ifile, ok = ImageCache[url]; !ok {
+		imgId := fmt.Sprintf("Img%d_Ch%d", imgCounter, n)
+		img, mimetype := Image(url)
+		ifile = epub.File{
+			Id:       imgId,
+			Filename: "OEBPS/Images/" + imgId,
+			Mimetype: mimetype,
+			Content:  img,
+		}
+		ImageCache[url] = ifile
+		imgCounter += 1
+	}
+	return ifile, imgCounter
+}
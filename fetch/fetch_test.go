@@ -0,0 +1,496 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/9viz/ln2epub/config"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUserAgent(t *testing.T) {
+	if got, want := UserAgent(""), "ln2epub (+https://github.com/9viz/ln2epub)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := UserAgent("mailto:me@example.com"),
+		"ln2epub (+https://github.com/9viz/ln2epub; mailto:me@example.com)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	body := `# Comment.
+User-agent: *
+Disallow: /
+
+User-agent: Foo
+User-agent: ln2epub
+Disallow: /wp-admin/
+Allow: /wp-admin/admin-ajax.php
+Disallow: /*.pdf$
+Disallow: /search?
+Crawl-delay: 2.5
+`
+	r := ParseRobots(body, UserAgent(""))
+	for path, want := range map[string]bool{
+		"/":                        true,
+		"/robots.txt":              true,
+		"/novel/foo/":              true,
+		"/wp-admin/":               false,
+		"/wp-admin/options.php":    false,
+		"/wp-admin/admin-ajax.php": true,
+		"/files/foo.pdf":           false,
+		"/files/foo.pdf.html":      true,
+		"/search?q=foo":            false,
+	} {
+		if got := r.Allowed(path); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if r.Delay != 2500*time.Millisecond {
+		t.Errorf("got delay %v, want 2.5s", r.Delay)
+	}
+
+	// Not for us, so the "*" group applies.
+	r = ParseRobots(body, "Bar")
+	if r.Allowed("/novel/foo/") || r.Delay != 0 {
+		t.Errorf("got rules for ln2epub for another agent")
+	}
+
+	// An empty User-agent line is for nobody.
+	r = ParseRobots("User-agent:\nDisallow: /\n\nUser-agent: *\nDisallow: /private/\n", UserAgent(""))
+	if !r.Allowed("/novel/foo/") || r.Allowed("/private/") {
+		t.Errorf("got the rules for an empty User-agent")
+	}
+}
+
+// A stand-in HTTP proxy that answers every request itself.
+type testProxy struct {
+	*httptest.Server
+	mu   sync.Mutex
+	urls []string
+}
+
+// Return a stand-in HTTP proxy, closed when the test ends.
+func newTestProxy(t *testing.T) *testProxy {
+	p := &testProxy{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.urls = append(p.urls, r.Method+" "+r.URL.String())
+		p.mu.Unlock()
+		w.Write([]byte("proxied"))
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// Return the requests made through P since the last call, and forget
+// them.
+func (p *testProxy) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	urls := p.urls
+	p.urls = nil
+	return urls
+}
+
+func TestProxy(t *testing.T) {
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.IgnoreRobots = true
+	config.Config.Rate, config.Config.Delay = 0, 0
+
+	global, host, env := newTestProxy(t), newTestProxy(t), newTestProxy(t)
+	t.Setenv("HTTP_PROXY", env.URL)
+	config.Config.Proxy = global.URL
+	config.Config.Hosts = map[string]config.Host{
+		"novel.test":  {Proxy: host.URL},
+		"direct.test": {Proxy: "direct"},
+	}
+
+	// The proxy for the host beats the one for all requests, also
+	// for subdomains.
+	if body, err := Request("http://www.novel.test/1"); err != nil || body != "proxied" {
+		t.Fatalf("got %q, %v", body, err)
+	}
+	if got := host.take(); len(got) != 1 || got[0] != "GET http://www.novel.test/1" {
+		t.Errorf("host proxy got %q", got)
+	}
+
+	// The proxy for all requests beats the environment, and every
+	// kind of request goes through it.
+	if _, err := Request("http://other.test/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PostForm("http://other.test/2", nurl.Values{"a": {"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	Image("http://other.test/3.png")
+	Cover("http://other.test/4.png")
+	want := []string{
+		"GET http://other.test/1", "POST http://other.test/2",
+		"GET http://other.test/3.png", "GET http://other.test/4.png",
+	}
+	if got := global.take(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("global proxy got %q, want %q", got, want)
+	}
+	if got := append(host.take(), env.take()...); len(got) > 0 {
+		t.Errorf("other proxies got %q", got)
+	}
+
+	// "direct" goes around every proxy.
+	u, _ := nurl.Parse("http://direct.test/")
+	if p, err := fetchProxy(&http.Request{URL: u}); p != nil || err != nil {
+		t.Errorf("got proxy %v, %v", p, err)
+	}
+}
+
+// A stand-in SOCKS5 proxy that answers every HTTP request itself.
+type testSocks struct {
+	net.Listener
+	mu   sync.Mutex
+	urls []string
+}
+
+// Return a stand-in SOCKS5 proxy, closed when the test ends.
+func newTestSocks(t *testing.T) *testSocks {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	p := &testSocks{Listener: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+// Answer the SOCKS5 handshake on CONN without authentication, then
+// the HTTP requests sent through it.
+func (p *testSocks) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	// Version, number of methods and the methods.
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil || head[0] != 5 {
+		return
+	}
+	if _, err := io.ReadFull(r, make([]byte, head[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+	// Version, CONNECT, reserved and the address type.
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(r, req); err != nil || req[1] != 1 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n, _ := r.ReadByte()
+		name := make([]byte, n)
+		io.ReadFull(r, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	for {
+		hr, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, hr.Body)
+		p.mu.Lock()
+		p.urls = append(p.urls, hr.Method+" "+addr+hr.URL.String())
+		p.mu.Unlock()
+		resp := http.Response{
+			StatusCode:    http.StatusOK,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			ContentLength: int64(len("proxied")),
+			Body:          io.NopCloser(strings.NewReader("proxied")),
+		}
+		if resp.Write(conn) != nil {
+			return
+		}
+	}
+}
+
+// Return the requests made through P since the last call, and forget
+// them.
+func (p *testSocks) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	urls := p.urls
+	p.urls = nil
+	return urls
+}
+
+func TestProxySocks(t *testing.T) {
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.IgnoreRobots = true
+	config.Config.Rate, config.Config.Delay = 0, 0
+
+	p := newTestSocks(t)
+	config.Config.Proxy = "socks5://" + p.Addr().String()
+	if err := config.CheckProxy(config.Config.Proxy); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := Request("http://www.novel.test/1"); err != nil || body != "proxied" {
+		t.Fatalf("got %q, %v", body, err)
+	}
+	if _, err := PostForm("http://www.novel.test/2", nurl.Values{"a": {"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	// The host names are resolved by the proxy.
+	want := []string{"GET www.novel.test:80/1", "POST www.novel.test:80/2"}
+	if got := p.take(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPoliteReserve(t *testing.T) {
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.Rate, config.Config.Burst, config.Config.Delay = 2, 3, 0
+
+	// A burst, then one request every half second.
+	start := time.Now()
+	h := &politeHost{tokens: 3, last: start}
+	for i, want := range []time.Duration{0, 0, 0, 500 * time.Millisecond, time.Second} {
+		if got := h.reserve("polite.test", start); got != want {
+			t.Errorf("request %d: got wait %v, want %v", i+1, got, want)
+		}
+	}
+	// The tokens refill, up to the burst.
+	later := start.Add(time.Minute)
+	for i, want := range []time.Duration{0, 0, 0, 500 * time.Millisecond} {
+		if got := h.reserve("polite.test", later); got != want {
+			t.Errorf("request %d a minute later: got wait %v, want %v", i+1, got, want)
+		}
+	}
+
+	// The minimum delay, without a rate.
+	config.Config.Rate, config.Config.Delay = 0, 1
+	h = &politeHost{tokens: 3, last: start}
+	for i, want := range []time.Duration{0, time.Second, 2 * time.Second} {
+		if got := h.reserve("polite.test", start); got != want {
+			t.Errorf("slow request %d: got wait %v, want %v", i+1, got, want)
+		}
+	}
+	if got := h.reserve("polite.test", start.Add(5*time.Second)); got != 0 {
+		t.Errorf("got wait %v after the delay", got)
+	}
+
+	// A longer Crawl-delay wins over the minimum delay.
+	h = &politeHost{tokens: 3, last: start, robots: &Robots{Delay: 3 * time.Second}}
+	for i, want := range []time.Duration{0, 3 * time.Second, 6 * time.Second} {
+		if got := h.reserve("polite.test", start); got != want {
+			t.Errorf("crawl-delayed request %d: got wait %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+// The page of a password protected WordPress post.
+const testPasswordForm = `<html><body><article>
+<form action="/wp-login.php?action=postpass" class="post-password-form" method="post">
+<p>This content is password protected.</p>
+<p><label for="pwbox-1">Password: <input name="post_password" id="pwbox-1" type="password"/></label>
+<input type="submit" name="Submit" value="Enter"/></p>
+</form></article></body></html>`
+
+func TestWpUnlock(t *testing.T) {
+	saved, savedJar := config.Config, Client.Jar
+	defer func() { config.Config, Client.Jar = saved, savedJar }()
+	config.Config.IgnoreRobots = true
+	config.Config.Rate, config.Config.Delay = 0, 0
+	config.Config.Proxy = "direct"
+	Client.Jar = NewCookieJar()
+
+	posts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wp-login.php" {
+			posts++
+			if r.URL.Query().Get("action") == "postpass" && r.PostFormValue("post_password") == "hunter2" {
+				http.SetCookie(w, &http.Cookie{Name: "wp-postpass_1", Value: "hash", Path: "/"})
+			}
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		if c, err := r.Cookie("wp-postpass_1"); err != nil || c.Value != "hash" {
+			w.Write([]byte(testPasswordForm))
+			return
+		}
+		w.Write([]byte("<p>Chapter " + r.URL.Path + "</p>"))
+	}))
+	defer srv.Close()
+
+	if _, err := Request(srv.URL + "/1"); err == nil || !strings.Contains(err.Error(), "no password") {
+		t.Errorf("got %v without a password", err)
+	}
+	if _, err := WpUnlock(srv.URL+"/1", "/wp-login.php?action=postpass", "hunter1"); err == nil ||
+		!strings.Contains(err.Error(), "wrong password") {
+		t.Errorf("got %v with a wrong password", err)
+	}
+
+	restore := WpUsePassword("hunter2")
+	defer restore()
+	posts = 0
+	for _, path := range []string{"/1", "/2"} {
+		body, err := Request(srv.URL + path)
+		if err != nil || body != "<p>Chapter "+path+"</p>" {
+			t.Errorf("got %q, %v for %s", body, err, path)
+		}
+	}
+	// The cookie unlocks the second post.
+	if posts != 1 {
+		t.Errorf("posted the password %d times", posts)
+	}
+	restore()
+	if got := wpCurrentPassword(); got != "" {
+		t.Errorf("got password %q after restoring", got)
+	}
+}
+
+func TestRecordRedact(t *testing.T) {
+	got := RecordRedact("post_password=hunter2&Submit=Enter")
+	if want := "Submit=Enter&post_password=REDACTED"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	txt := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tTRUE\t" + strconv.FormatInt(exp, 10) + "\tsession\tabc\n" +
+		"#HttpOnly_blog.example.org\tFALSE\t/\tFALSE\t0\twp-postpass\txyz\n" +
+		"old.example.com\tFALSE\t/\tFALSE\t1\tstale\tgone\n"
+	j := NewCookieJar()
+	if err := j.Load(strings.NewReader(txt)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct{ url, want string }{
+		{"https://www.example.com/foo", "session=abc"},
+		{"http://www.example.com/foo", ""},
+		{"http://blog.example.org/", "wp-postpass=xyz"},
+		{"http://sub.blog.example.org/", ""},
+		{"http://old.example.com/", ""},
+	} {
+		u, _ := nurl.Parse(c.url)
+		var got []string
+		for _, k := range j.Cookies(u) {
+			got = append(got, k.Name+"="+k.Value)
+		}
+		if strings.Join(got, "; ") != c.want {
+			t.Errorf("cookies for %s are %q, want %q", c.url, got, c.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := j.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tTRUE\t" + strconv.FormatInt(exp, 10) + "\tsession\tabc\n" +
+		"#HttpOnly_blog.example.org\tFALSE\t/\tFALSE\t0\twp-postpass\txyz\n"
+	if buf.String() != want {
+		t.Errorf("saved\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestImageAspect(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 200, 100))
+	for _, test := range []struct {
+		src  image.Image
+		crop bool
+		w, h int
+	}{
+		{src, false, 200, 267},
+		{src, true, 75, 100},
+		{src.SubImage(image.Rect(50, 0, 100, 100)), false, 75, 100},
+		{src.SubImage(image.Rect(50, 0, 100, 100)), true, 50, 67},
+		{image.NewGray(image.Rect(0, 0, 75, 100)), true, 75, 100},
+	} {
+		b := ImageAspect(test.src, 0.75, test.crop).Bounds()
+		if b.Dx() != test.w || b.Dy() != test.h {
+			t.Errorf("got %dx%d for %v, want %dx%d", b.Dx(), b.Dy(), test.src.Bounds(), test.w, test.h)
+		}
+	}
+	// Padding is white.
+	if c := color.GrayModel.Convert(ImageAspect(src, 0.75, false).At(0, 0)); c != (color.Gray{255}) {
+		t.Errorf("got padding %v", c)
+	}
+	if c := color.GrayModel.Convert(ImageAspect(src, 0.75, false).At(0, 134)); c != (color.Gray{0}) {
+		t.Errorf("got image %v", c)
+	}
+
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.Images = config.Images{CoverAspect: 0.75, CoverFit: config.CoverCrop}
+	var buf bytes.Buffer
+	png.Encode(&buf, src)
+	if img, _ := ImageProcess(buf.Bytes(), "image/png"); !bytes.Equal(img, buf.Bytes()) {
+		t.Error("the aspect of an image changed")
+	}
+	img, mimetype := CoverProcess(buf.Bytes(), "image/png")
+	cover, err := png.Decode(bytes.NewReader(img))
+	if err != nil || mimetype != "image/png" {
+		t.Fatal(err, mimetype)
+	}
+	if b := cover.Bounds(); b.Dx() != 75 || b.Dy() != 100 {
+		t.Errorf("got a %dx%d cover", b.Dx(), b.Dy())
+	}
+}
+
+func TestImageGrayscale(t *testing.T) {
+	saved := config.Config
+	defer func() { config.Config = saved }()
+	config.Config.Images = config.Images{Grayscale: true}
+
+	// Transparent on the left, opaque black on the right.
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(1, 0, color.Black)
+	var buf bytes.Buffer
+	png.Encode(&buf, src)
+	img, _ := ImageProcess(buf.Bytes(), "image/png")
+	gray, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, want := range []color.Gray{{255}, {0}} {
+		if c := color.GrayModel.Convert(gray.At(x, 0)); c != want {
+			t.Errorf("got %v at %d, want %v", c, x, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package fetch
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/progress"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+)
+
+// Return IMG with mimetype MIMETYPE processed according to
+// config.Config.Images, and its new mimetype.
+// Only JPEG and PNG images are processed, the rest are returned as-is.
+// IMG is also returned as-is if it cannot be decoded.
+func ImageProcess(img []byte, mimetype string) ([]byte, string) {
+	return imageProcess(img, mimetype, false)
+}
+
+// Return the cover image IMG with mimetype MIMETYPE processed like
+// ImageProcess, after making it fit config.Config.Images.CoverAspect,
+// and its new mimetype.
+func CoverProcess(img []byte, mimetype string) ([]byte, string) {
+	return imageProcess(img, mimetype, true)
+}
+
+// Return IMG with mimetype MIMETYPE processed according to
+// config.Config.Images, and its new mimetype.  If COVER is true, the
+// cover settings apply too.
+func imageProcess(img []byte, mimetype string, cover bool) ([]byte, string) {
+	conf := config.Config.Images
+	aspect := conf.CoverAspect > 0 && cover
+	if conf == (config.Images{}) ||
+		(mimetype != "image/jpeg" && mimetype != "image/png") {
+		return img, mimetype
+	}
+	if mimetype == "image/png" && conf.MaxWidth == 0 &&
+		conf.MaxHeight == 0 && !conf.Grayscale && !aspect {
+		return img, mimetype
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(img))
+	if err != nil {
+		progress.Verbosef("Cannot process image: %v", err)
+		return img, mimetype
+	}
+	if aspect {
+		src = ImageAspect(src, conf.CoverAspect, conf.CoverFit == config.CoverCrop)
+	}
+
+	w, h := ImageFit(src.Bounds().Dx(), src.Bounds().Dy(),
+		conf.MaxWidth, conf.MaxHeight)
+	if w != src.Bounds().Dx() || h != src.Bounds().Dy() {
+		src = ImageResize(src, w, h)
+	}
+	if conf.Grayscale {
+		// Transparent pixels would be black without the white
+		// underneath.
+		gray := image.NewGray(src.Bounds())
+		draw.Draw(gray, gray.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(gray, gray.Bounds(), src, src.Bounds().Min, draw.Over)
+		src = gray
+	}
+
+	var buf bytes.Buffer
+	if mimetype == "image/png" {
+		err = png.Encode(&buf, src)
+	} else {
+		quality := conf.JpegQuality
+		if quality == 0 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, src, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		progress.Verbosef("Cannot process image: %v", err)
+		return img, mimetype
+	}
+	return buf.Bytes(), mimetype
+}
+
+// Return SRC made to have the width to height ratio ASPECT, by cutting
+// off its sides if CROP is true, or by adding white borders otherwise.
+// SRC is returned as-is if it is close enough.
+func ImageAspect(src image.Image, aspect float64, crop bool) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 || math.Abs(float64(w)/float64(h)-aspect) < aspect/100 {
+		return src
+	}
+	wide := float64(w)/float64(h) > aspect
+	var r image.Rectangle
+	switch {
+	case crop && wide:
+		nw := int(math.Round(float64(h) * aspect))
+		r = image.Rect(0, 0, nw, h).Add(b.Min.Add(image.Pt((w-nw)/2, 0)))
+	case crop:
+		nh := int(math.Round(float64(w) / aspect))
+		r = image.Rect(0, 0, w, nh).Add(b.Min.Add(image.Pt(0, (h-nh)/2)))
+	case wide:
+		nh := int(math.Round(float64(w) / aspect))
+		r = image.Rect(0, 0, w, nh).Add(b.Min.Sub(image.Pt(0, (nh-h)/2)))
+	default:
+		nw := int(math.Round(float64(h) * aspect))
+		r = image.Rect(0, 0, nw, h).Add(b.Min.Sub(image.Pt((nw-w)/2, 0)))
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, r.Min, draw.Over)
+	return dst
+}
+
+// Return the size of a W x H image scaled down to fit in MAXW x MAXH
+// keeping the aspect ratio.
+// A zero MAXW or MAXH means no limit in that dimension.
+func ImageFit(w, h, maxw, maxh int) (int, int) {
+	if maxw > 0 && w > maxw {
+		w, h = maxw, h*maxw/w
+	}
+	if maxh > 0 && h > maxh {
+		w, h = w*maxh/h, maxh
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// Return SRC scaled down to W x H.
+// Each pixel is the average of the pixels it covers in SRC, which is
+// good enough for making images smaller.
+func ImageResize(src image.Image, w, h int) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := b.Min.Y + (y+1)*b.Dy()/h
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := b.Min.X + (x+1)*b.Dx()/w
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,248 @@
+package fetch
+
+import (
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/progress"
+	"io"
+	"io/ioutil"
+	"net/http"
+	nurl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Robots is the rules for us in a robots.txt file.
+type Robots struct {
+	rules []robotsRule
+
+	// Delay is the Crawl-delay, zero if none.
+	Delay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// Parse robots.txt file BODY for user agent AGENT.
+// The groups for AGENT are used if there are any, otherwise the
+// groups for "*" are used.  Rules are matched as described in RFC
+// 9309, with the longest matching rule winning.
+func ParseRobots(body, agent string) *Robots {
+	var mine, any Robots
+	// The groups the current rules belong to.
+	var forMe, forAny bool
+	// Whether the last line was a User-agent line.
+	agents := false
+
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+
+		if key == "user-agent" {
+			if !agents {
+				forMe, forAny = false, false
+			}
+			agents = true
+			val = strings.ToLower(val)
+			if val == "" {
+				continue
+			}
+			forMe = forMe || strings.Contains(strings.ToLower(agent), val) && val != "*"
+			forAny = forAny || val == "*"
+			continue
+		}
+		agents = false
+
+		var r *Robots
+		switch {
+		case forMe:
+			r = &mine
+		case forAny:
+			r = &any
+		default:
+			continue
+		}
+		switch key {
+		case "allow", "disallow":
+			if val == "" {
+				continue
+			}
+			re := "^" + strings.ReplaceAll(regexp.QuoteMeta(val), `\*`, ".*")
+			if strings.HasSuffix(re, `\$`) {
+				re = strings.TrimSuffix(re, `\$`) + "$"
+			}
+			r.rules = append(r.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: val,
+				re:      regexp.MustCompile(re),
+			})
+		case "crawl-delay":
+			if d, err := strconv.ParseFloat(val, 64); err == nil && d > 0 {
+				r.Delay = time.Duration(d * float64(time.Second))
+			}
+		}
+	}
+
+	if len(mine.rules) > 0 || mine.Delay > 0 {
+		return &mine
+	}
+	return &any
+}
+
+// Return true if PATH is allowed by R.
+// PATH should include the query string, if any.
+func (r *Robots) Allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			allowed, longest = rule.allow, n
+		}
+	}
+	return allowed
+}
+
+// politeHost is the state kept for requests to a host.
+type politeHost struct {
+	mu sync.Mutex
+	// Available requests, refilled at the rate for the host.
+	tokens float64
+	// Time of the last refill.
+	last time.Time
+	// Earliest time of the next request.
+	next time.Time
+
+	robotsOnce sync.Once
+	robots     *Robots
+}
+
+var politeHosts = struct {
+	sync.Mutex
+	m map[string]*politeHost
+}{m: make(map[string]*politeHost)}
+
+// Return the rate, burst and minimum delay for requests to HOST.
+func PoliteLimits(host string) (float64, int, time.Duration) {
+	c := config.HostFor(host)
+	rate, burst, delay := config.Config.Rate, config.Config.Burst, config.Config.Delay
+	if c.Rate != 0 {
+		rate = c.Rate
+	}
+	if c.Burst != 0 {
+		burst = c.Burst
+	}
+	if c.Delay != 0 {
+		delay = c.Delay
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate, burst, time.Duration(delay * float64(time.Second))
+}
+
+// Return the state for HOST.
+func politeHostFor(host string) *politeHost {
+	politeHosts.Lock()
+	defer politeHosts.Unlock()
+	h, ok := politeHosts.m[host]
+	if !ok {
+		_, burst, _ := PoliteLimits(host)
+		h = &politeHost{tokens: float64(burst), last: time.Now()}
+		politeHosts.m[host] = h
+	}
+	return h
+}
+
+// Return how long to wait from NOW before making a request to HOST.
+// The request is accounted for, so the caller should make the request
+// after waiting.
+func (h *politeHost) reserve(host string, now time.Time) time.Duration {
+	rate, burst, delay := PoliteLimits(host)
+	if h.robots != nil && h.robots.Delay > delay {
+		delay = h.robots.Delay
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var wait time.Duration
+	if rate > 0 {
+		h.tokens += now.Sub(h.last).Seconds() * rate
+		if h.tokens > float64(burst) {
+			h.tokens = float64(burst)
+		}
+		h.tokens--
+		if h.tokens < 0 {
+			wait = time.Duration(-h.tokens / rate * float64(time.Second))
+		}
+	}
+	h.last = now
+
+	at := now.Add(wait)
+	if at.Before(h.next) {
+		at = h.next
+	}
+	h.next = at.Add(delay)
+	return at.Sub(now)
+}
+
+// Fetch the robots.txt of the host of U.
+// If it cannot be fetched, everything is allowed.
+func politeFetchRobots(h *politeHost, u *nurl.URL) *Robots {
+	ru := &nurl.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	time.Sleep(h.reserve(u.Hostname(), time.Now()))
+	req, _ := http.NewRequest("GET", ru.String(), nil)
+	req.Header = fetchHeaders(ru.String())
+	resp, err := Client.Do(req)
+	if err != nil {
+		progress.Verbosef("Cannot fetch %s: %v", ru, err)
+		return &Robots{}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &Robots{}
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512*1024))
+	return ParseRobots(string(body), Agent)
+}
+
+// Wait until a request to U is allowed.
+// An error is returned if robots.txt disallows U, unless
+// config.Config.IgnoreRobots is true.
+func PoliteWait(u *nurl.URL) error {
+	h := politeHostFor(u.Hostname())
+	if !config.Config.IgnoreRobots {
+		h.robotsOnce.Do(func() {
+			h.robots = politeFetchRobots(h, u)
+		})
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		if !h.robots.Allowed(path) {
+			return fmt.Errorf("%s is disallowed by robots.txt, use -ignore-robots to fetch it anyway", u)
+		}
+	}
+	time.Sleep(h.reserve(u.Hostname(), time.Now()))
+	return nil
+}
@@ -0,0 +1,347 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	nurl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The archives written by RecordTransport are a subset of HAR 1.2, so
+// that they can also be opened with the network panel of browsers.
+type har struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method   string       `json:"method"`
+	Url      string       `json:"url"`
+	Headers  []harHeader  `json:"headers"`
+	PostData *harPostData `json:"postData,omitempty"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status  int         `json:"status"`
+	Headers []harHeader `json:"headers"`
+	Content harContent  `json:"content"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Headers that are not recorded since they could give away the
+// session of the user.
+var RecordSecretHeaders = map[string]bool{
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+}
+
+// Form fields whose values are replaced before recording.
+var RecordSecretFields = []string{"post_password", "password", "pwd"}
+
+// Return the form BODY with the values of RecordSecretFields
+// replaced.
+func RecordRedact(body string) string {
+	form, err := nurl.ParseQuery(body)
+	if err != nil {
+		return body
+	}
+	for _, f := range RecordSecretFields {
+		if _, ok := form[f]; ok {
+			form.Set(f, "REDACTED")
+		}
+	}
+	return form.Encode()
+}
+
+// Return the key used to match the request with METHOD, URL, and
+// POST form BODY when replaying.
+func recordKey(method, url, body string) string {
+	if body == "" {
+		return method + " " + url
+	}
+	return method + " " + url + "\n" + RecordRedact(body)
+}
+
+func recordHeaders(h http.Header) []harHeader {
+	var ret []harHeader
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if RecordSecretHeaders[k] {
+			continue
+		}
+		for _, v := range h[k] {
+			ret = append(ret, harHeader{k, v})
+		}
+	}
+	return ret
+}
+
+// Placeholder stored in place of images, a grey 1x1 PNG image.
+var RecordPlaceholder = func() []byte {
+	var buf bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 1, 1))
+	img.SetGray(0, 0, color.Gray{0x80})
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}()
+
+// RecordTransport records every request made with Base and its
+// response.
+type RecordTransport struct {
+	Base http.RoundTripper
+
+	// Placeholders is true if images are replaced by
+	// RecordPlaceholder.
+	Placeholders bool
+
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := &harEntry{
+		StartedDateTime: time.Now().UTC(),
+		Request: harRequest{
+			Method:  req.Method,
+			Url:     req.URL.String(),
+			Headers: recordHeaders(req.Header),
+		},
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		e.Request.PostData = &harPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     RecordRedact(string(body)),
+		}
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	e.Time = float64(time.Since(e.StartedDateTime).Milliseconds())
+	e.Response.Status = resp.StatusCode
+	e.Response.Headers = recordHeaders(resp.Header)
+	mimetype := resp.Header.Get("Content-Type")
+	if mimetype == "" {
+		mimetype = http.DetectContentType(body)
+	}
+	if t.Placeholders && strings.HasPrefix(mimetype, "image/") {
+		body, mimetype = RecordPlaceholder, "image/png"
+		for i, h := range e.Response.Headers {
+			if http.CanonicalHeaderKey(h.Name) == "Content-Type" {
+				e.Response.Headers[i].Value = mimetype
+			}
+		}
+	}
+	e.Response.Content = harContent{Size: len(body), MimeType: mimetype}
+	if strings.HasPrefix(mimetype, "image/") || !utf8.Valid(body) {
+		e.Response.Content.Text = base64.StdEncoding.EncodeToString(body)
+		e.Response.Content.Encoding = "base64"
+	} else {
+		e.Response.Content.Text = string(body)
+	}
+
+	t.mu.Lock()
+	t.entries = append(t.entries, e)
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// Return the number of recorded requests.
+func (t *RecordTransport) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.entries)
+}
+
+// Write the recorded requests to FILENAME.
+func (t *RecordTransport) Save(filename string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, err := json.MarshalIndent(har{harLog{
+		Version: "1.2",
+		Creator: harCreator{Agent, "1"},
+		Entries: t.entries,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0644)
+}
+
+// ReplayTransport answers requests with the responses recorded in an
+// archive.  If a request was recorded more than once, the responses
+// are given in the recorded order, and the last one is repeated.
+type ReplayTransport struct {
+	mu      sync.Mutex
+	entries map[string][]*harEntry
+	served  map[string]int
+}
+
+// Return a ReplayTransport for the archive FILENAME.
+func NewReplayTransport(filename string) (*ReplayTransport, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var h har
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	t := &ReplayTransport{
+		entries: make(map[string][]*harEntry),
+		served:  make(map[string]int),
+	}
+	for _, e := range h.Log.Entries {
+		var body string
+		if e.Request.PostData != nil {
+			body = e.Request.PostData.Text
+		}
+		k := recordKey(e.Request.Method, e.Request.Url, body)
+		t.entries[k] = append(t.entries[k], e)
+	}
+	return t, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	k := recordKey(req.Method, req.URL.String(), string(body))
+
+	t.mu.Lock()
+	es := t.entries[k]
+	i := t.served[k]
+	if i < len(es)-1 {
+		t.served[k]++
+	}
+	t.mu.Unlock()
+	if len(es) == 0 {
+		return nil, fmt.Errorf("%s %s is not in the archive", req.Method, req.URL)
+	}
+	e := es[i]
+
+	content := []byte(e.Response.Content.Text)
+	if e.Response.Content.Encoding == "base64" {
+		var err error
+		content, err = base64.StdEncoding.DecodeString(e.Response.Content.Text)
+		if err != nil {
+			return nil, err
+		}
+	}
+	header := make(http.Header)
+	for _, h := range e.Response.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	// The body is not encoded any more.
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Response.Status, http.StatusText(e.Response.Status)),
+		StatusCode:    e.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+		Request:       req,
+	}, nil
+}
+
+// Recorder records the requests made by Client when not nil.
+var Recorder *RecordTransport
+
+// Archive written by `ln2epub record'.
+var RecordDefaultFile = "ln2epub.har"
+
+// Record the requests made by Client from now on.
+// Images are replaced by placeholders if PLACEHOLDERS is true.
+func RecordStart(placeholders bool) {
+	Recorder = &RecordTransport{Base: Client.Transport, Placeholders: placeholders}
+	Client.Transport = Recorder
+}
+
+// Answer the requests made by Client from the archive FILENAME.
+// Requests are not rate limited since the network is not used.
+func ReplayStart(filename string) error {
+	t, err := NewReplayTransport(filename)
+	if err != nil {
+		return err
+	}
+	Client.Transport = t
+	config.Config.Rate = 0
+	config.Config.Delay = 0
+	return nil
+}
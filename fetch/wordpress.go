@@ -0,0 +1,87 @@
+package fetch
+
+import (
+	"fmt"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	nurl "net/url"
+	"strings"
+	"sync"
+)
+
+// The password Request unlocks password protected posts with, see
+// WpUsePassword.
+var wpPassword struct {
+	sync.Mutex
+	password string
+}
+
+// Unlock the password protected posts Request comes across with
+// PASSWORD, the password of the series being fetched, until the
+// returned function is called.
+func WpUsePassword(password string) func() {
+	wpPassword.Lock()
+	defer wpPassword.Unlock()
+	saved := wpPassword.password
+	wpPassword.password = password
+	return func() {
+		wpPassword.Lock()
+		defer wpPassword.Unlock()
+		wpPassword.password = saved
+	}
+}
+
+// Return the password given to WpUsePassword.
+func wpCurrentPassword() string {
+	wpPassword.Lock()
+	defer wpPassword.Unlock()
+	return wpPassword.password
+}
+
+// Return the action URL of the post password form in page H.
+// An empty string is returned if the post is not password protected.
+func WpPasswordForm(h string) string {
+	if !strings.Contains(h, "post-password-form") {
+		return ""
+	}
+	form := soup.HTMLParse(h).Find("form", "class", "post-password-form")
+	if form.Pointer == nil {
+		return ""
+	}
+	return form.Attrs()["action"]
+}
+
+// Return the page of the password protected post URL after unlocking
+// it with PASSWORD.
+// ACTION is the action URL of the post password form, usually
+// wp-login.php?action=postpass.  WordPress sets a cookie after the
+// password is posted that lets us see the post, and the other posts
+// with the same password.
+func WpUnlock(url, action, password string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("%s is password protected, but there is no password for its series", url)
+	}
+	if u, err := nurl.Parse(url); err == nil {
+		if a, err := u.Parse(action); err == nil {
+			action = a.String()
+		}
+	}
+
+	progress.Verbosef("Unlocking password protected %s", url)
+	form := nurl.Values{}
+	form.Set("post_password", password)
+	form.Set("Submit", "Enter")
+	if _, err := PostForm(action, form); err != nil {
+		return "", err
+	}
+
+	PageCacheForget(url)
+	b, err := fetch(url, nil)
+	if err != nil {
+		return "", err
+	}
+	if WpPasswordForm(string(b)) != "" {
+		return "", fmt.Errorf("wrong password for %s", url)
+	}
+	return string(b), nil
+}
@@ -1,8 +1,9 @@
-module ln2epub
+module github.com/9viz/ln2epub
 
 go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/anaskhan96/soup v1.2.5
 	golang.org/x/net v0.10.0
 )
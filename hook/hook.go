@@ -0,0 +1,133 @@
+// Licensed under BSD 2-Clause License.
+
+// Package hook runs the commands in config.Config.Hooks after a book
+// is created, e.g., to copy it to an e-reader or to convert it with
+// calibre's ebook-convert.
+//
+// Each {FIELD} in the arguments of a command is replaced by the value
+// of FIELD.  The fields are those of sites.BookNameFields and,
+//
+//	file    the created file
+//	dir     the directory of the file
+//	name    the name of the file without the directory and extension
+//	format  the output format
+//	url     the URL of the series
+//
+// The fields are also in the environment of the command as
+// LN2EPUB_FIELD, e.g., LN2EPUB_FILE and LN2EPUB_CHAPTERS.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/export"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/sites"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Return the fields of book B built on DATE and written to FILE in
+// FORMAT.
+func Fields(b sites.Book, date time.Time, file, format string) map[string]string {
+	fields := sites.BookNameFields(b, date)
+	name := filepath.Base(file)
+	if ext := export.Extension(format); strings.HasSuffix(name, ext) {
+		name = strings.TrimSuffix(name, ext)
+	} else {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	fields["file"] = file
+	fields["dir"] = filepath.Dir(file)
+	fields["name"] = name
+	fields["format"] = format
+	fields["url"] = b.Url
+	return fields
+}
+
+// Match a field in the arguments of a command.
+var fieldRe = regexp.MustCompile(`\{[a-z]+\}`)
+
+// Return ARGS with each {FIELD} replaced by its value in FIELDS.
+// An error is returned if a field is unknown.
+func Expand(args []string, fields map[string]string) ([]string, error) {
+	var err error
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = fieldRe.ReplaceAllStringFunc(a, func(f string) string {
+			v, ok := fields[f[1:len(f)-1]]
+			if !ok {
+				err = fmt.Errorf("unknown field %s in hook %s", f, strings.Join(args, " "))
+			}
+			return v
+		})
+	}
+	return out, err
+}
+
+// Return an error if the command of hook H has an unknown field.
+func Check(h config.Hook) error {
+	_, err := Expand(h.Command, Fields(sites.Book{}, time.Time{}, "", ""))
+	return err
+}
+
+// Return FIELDS as environment variables.
+func environ(fields map[string]string) []string {
+	var env []string
+	for k, v := range fields {
+		env = append(env, "LN2EPUB_"+strings.ToUpper(k)+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// Run the command of hook H for the book with FIELDS.
+func Run(h config.Hook, fields map[string]string) error {
+	args, err := Expand(h.Command, fields)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(h.Timeout*float64(time.Second)))
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), environ(fields)...)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		progress.Verbosef("%s", bytes.TrimRight(out, "\n"))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// Run every hook in config.Config.Hooks for book B built on DATE and
+// written to FILE.  A failed hook is handled according to its OnError,
+// and the error of the first one with config.HookAbort is returned.
+func All(b sites.Book, date time.Time, file string) error {
+	fields := Fields(b, date, file, config.Config.Format)
+	for _, h := range config.Config.Hooks {
+		err := Run(h, fields)
+		switch {
+		case err == nil:
+		case h.OnError == config.HookAbort:
+			return fmt.Errorf("hook: %v", err)
+		case h.OnError == config.HookIgnore:
+			progress.Verbosef("hook: %v", err)
+		default:
+			progress.Error(fmt.Errorf("hook: %v", err))
+		}
+	}
+	return nil
+}
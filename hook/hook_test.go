@@ -0,0 +1,120 @@
+package hook
+
+import (
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/sites"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testBook = sites.Book{
+	Site:   "soafp",
+	Series: "Foo",
+	Volume: "Volume 2",
+	Url:    "https://soafp.com/foo/",
+}
+
+var testDate = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFields(t *testing.T) {
+	for file, want := range map[string]string{
+		"/books/Foo - Volume 2.epub":       "Foo - Volume 2",
+		"/books/Foo - Volume 2.kepub.epub": "Foo - Volume 2",
+		"/books/Foo - Volume 2.md":         "Foo - Volume 2",
+	} {
+		format := "epub"
+		if strings.HasSuffix(file, ".kepub.epub") {
+			format = "kepub"
+		}
+		fields := Fields(testBook, testDate, file, format)
+		if fields["name"] != want || fields["dir"] != "/books" {
+			t.Errorf("got name %q in %q for %s", fields["name"], fields["dir"], file)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	fields := Fields(testBook, testDate, "/books/Foo - Volume 2.epub", "epub")
+	got, err := Expand([]string{"cp", "{file}", "/mnt/{series}/{name}.{format}"}, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "cp|/books/Foo - Volume 2.epub|/mnt/Foo/Foo - Volume 2.epub"
+	if strings.Join(got, "|") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, "|"), want)
+	}
+	if _, err := Expand([]string{"cp", "{flie}"}, fields); err == nil || !strings.Contains(err.Error(), "{flie}") {
+		t.Errorf("got error %v", err)
+	}
+	if err := Check(config.Hook{Command: []string{"echo", "{url}", "{date}"}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	fields := Fields(testBook, testDate, "/books/Foo - Volume 2.epub", "epub")
+	h := config.Hook{Command: []string{"sh", "-c",
+		`printf '%s\n%s\n%s\n' "$1" "$LN2EPUB_TITLE" "$LN2EPUB_URL" > ` + out, "sh", "{name}"}}
+	if err := Run(h, fields); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Foo - Volume 2\nFoo - Volume 2\nhttps://soafp.com/foo/\n"
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+
+	err = Run(config.Hook{Command: []string{"sh", "-c", "exit 3"}}, fields)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("got error %v", err)
+	}
+	err = Run(config.Hook{Command: []string{"sleep", "5"}, Timeout: 0.1}, fields)
+	if err == nil {
+		t.Error("command did not time out")
+	}
+}
+
+func TestAll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	defer func(hooks []config.Hook) { config.Config.Hooks = hooks }(config.Config.Hooks)
+	out := filepath.Join(t.TempDir(), "out")
+	fail := []string{"sh", "-c", "exit 1"}
+	touch := []string{"touch", out}
+
+	config.Config.Hooks = []config.Hook{
+		{Command: fail},
+		{Command: fail, OnError: config.HookIgnore},
+		{Command: touch},
+	}
+	if err := All(testBook, testDate, "/books/Foo - Volume 2.epub"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Error("the hooks after a failed one did not run")
+	}
+	os.Remove(out)
+
+	config.Config.Hooks = []config.Hook{
+		{Command: fail, OnError: config.HookAbort},
+		{Command: touch},
+	}
+	if err := All(testBook, testDate, "/books/Foo - Volume 2.epub"); err == nil {
+		t.Error("a failed hook with on_error abort did not fail")
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("the hooks after an aborting one ran")
+	}
+}
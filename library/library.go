@@ -0,0 +1,194 @@
+// Licensed under BSD 2-Clause License.
+
+// Package library keeps the ongoing series the user is subscribed to,
+// together with the chapters last seen in their table of contents, so
+// that new chapters can be found and made into epub files.
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/sites"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Options are the settings used to build the books of a series.
+// Empty values mean the value in the configuration.
+type Options struct {
+	OutputDir    string `json:"output_dir,omitempty"`
+	NameTemplate string `json:"name_template,omitempty"`
+	EpubVersion  int    `json:"epub_version,omitempty"`
+	Format       string `json:"format,omitempty"`
+
+	// Profile is the device profile, see config.ApplyProfile.
+	Profile string `json:"profile,omitempty"`
+}
+
+// Series is a series in the library.
+type Series struct {
+	Url string `json:"url"`
+
+	// Site is the name of the site the series is from, see
+	// sites.All.
+	Site string `json:"site"`
+
+	// Title is the title of the series as last seen.
+	Title string `json:"title"`
+
+	Options Options `json:"options"`
+
+	// Toc is the table of contents as of the last sync.
+	Toc sites.Toc `json:"toc"`
+
+	Subscribed time.Time `json:"subscribed"`
+	Synced     time.Time `json:"synced"`
+}
+
+// Library is the subscribed series.
+type Library struct {
+	// File is where the library is saved.
+	File string `json:"-"`
+
+	Series []Series `json:"series"`
+}
+
+// Return the default path of the library file.
+// It is kept next to the configuration file, see config.Path.
+func DefaultFile() string {
+	p := config.Path()
+	if p == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(p), "library.json")
+}
+
+// Return the library saved in FILENAME.
+// The library is empty if FILENAME does not exist.
+func Load(filename string) (*Library, error) {
+	l := &Library{File: filename}
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return l, nil
+}
+
+// Save the library L to L.File.
+// The file is replaced atomically so that an interrupted sync does not
+// lose the library.
+func (l *Library) Save() error {
+	if l.Series == nil {
+		l.Series = []Series{}
+	}
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.File), 0755); err != nil {
+		return err
+	}
+	tmp := l.File + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.File)
+}
+
+// Return the index of the series URL in L, or -1 if L has no such
+// series.
+func (l *Library) Find(url string) int {
+	for i, s := range l.Series {
+		if s.Url == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add series S to L.
+// S.Toc is what the next sync compares against, so only chapters
+// added after it count as new.
+func (l *Library) Subscribe(s Series) error {
+	if l.Find(s.Url) >= 0 {
+		return fmt.Errorf("already subscribed to %s", s.Url)
+	}
+	if s.Subscribed.IsZero() {
+		s.Subscribed = time.Now().UTC().Truncate(time.Second)
+	}
+	if s.Synced.IsZero() {
+		s.Synced = s.Subscribed
+	}
+	l.Series = append(l.Series, s)
+	return nil
+}
+
+// Remove the series URL from L.
+func (l *Library) Unsubscribe(url string) error {
+	i := l.Find(url)
+	if i < 0 {
+		return fmt.Errorf("not subscribed to %s", url)
+	}
+	l.Series = append(l.Series[:i], l.Series[i+1:]...)
+	return nil
+}
+
+// Change is the new chapters of a volume.
+type Change struct {
+	// Volume is the title of the volume, see sites.TocVolume.
+	Volume string `json:"volume"`
+
+	// New is true if the volume was not in the old table of
+	// contents.
+	New bool `json:"new,omitempty"`
+
+	Chapters []sites.TocChapter `json:"chapters"`
+}
+
+// Return the changes from table of contents OLD to NEW.
+// Chapters are compared by URL and volumes by title.  Removed chapters
+// and volumes are not reported, they are usually moved elsewhere or
+// taken down after a licence.
+func Diff(old, new sites.Toc) []Change {
+	seen := make(map[string]bool)
+	vols := make(map[string]bool)
+	for _, v := range old.Volumes {
+		vols[v.Title] = true
+		for _, ch := range v.Chapters {
+			seen[ch.Url] = true
+		}
+	}
+	var changes []Change
+	for _, v := range new.Volumes {
+		c := Change{Volume: v.Title, New: !vols[v.Title]}
+		for _, ch := range v.Chapters {
+			if !seen[ch.Url] {
+				c.Chapters = append(c.Chapters, ch)
+			}
+		}
+		if len(c.Chapters) > 0 {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// Update is a book built by a sync because of new chapters.
+type Update struct {
+	Series string `json:"series"`
+	Url    string `json:"url"`
+	Volume string `json:"volume,omitempty"`
+
+	// Chapters are the new chapters in the book.
+	Chapters []sites.TocChapter `json:"chapters"`
+
+	// File is the epub file.
+	File string `json:"file"`
+}
@@ -0,0 +1,126 @@
+package library
+
+import (
+	"github.com/9viz/ln2epub/sites"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Return a table of contents with VOLS, each a title followed by the
+// chapter numbers.
+func testToc(vols ...[]string) sites.Toc {
+	toc := sites.Toc{Site: "soafp", Series: "Foo", Url: "https://soafp.com/foo/"}
+	for _, v := range vols {
+		vol := sites.TocVolume{Title: v[0]}
+		for _, n := range v[1:] {
+			vol.Chapters = append(vol.Chapters, sites.TocChapter{
+				Title: "Chapter " + n, Url: "https://soafp.com/foo/" + n,
+			})
+		}
+		toc.Volumes = append(toc.Volumes, vol)
+	}
+	return toc
+}
+
+func TestLibrary(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ln2epub", "library.json")
+	l, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Series) != 0 {
+		t.Fatalf("got %d series in a new library", len(l.Series))
+	}
+
+	date := time.Date(2023, time.January, 18, 0, 0, 0, 0, time.UTC)
+	foo := Series{
+		Url:        "https://soafp.com/foo/",
+		Site:       "soafp",
+		Title:      "Foo",
+		Options:    Options{EpubVersion: 3},
+		Toc:        testToc([]string{"Volume 1", "1", "2"}),
+		Subscribed: date,
+	}
+	if err := l.Subscribe(foo); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Subscribe(Series{Url: "https://soafp.com/bar/", Title: "Bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Subscribe(foo); err == nil {
+		t.Error("subscribed twice to the same series")
+	}
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Series) != 2 {
+		t.Fatalf("got %d series", len(l.Series))
+	}
+	foo.Synced = date
+	if !reflect.DeepEqual(l.Series[0], foo) {
+		t.Errorf("got\n%+v\nwant\n%+v", l.Series[0], foo)
+	}
+	if l.Series[1].Subscribed.IsZero() {
+		t.Error("subscription date is not set")
+	}
+
+	if err := l.Unsubscribe("https://soafp.com/foo/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unsubscribe("https://soafp.com/foo/"); err == nil {
+		t.Error("unsubscribed twice from the same series")
+	}
+	if l.Find("https://soafp.com/bar/") != 0 {
+		t.Error("lost the other series")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := testToc([]string{"Volume 1", "1", "2"}, []string{"Volume 2", "3"})
+	for _, test := range []struct {
+		name string
+		new  sites.Toc
+		want []Change
+	}{
+		{"unchanged", old, nil},
+		{
+			"new chapter",
+			testToc([]string{"Volume 1", "1", "2"}, []string{"Volume 2", "3", "4"}),
+			[]Change{{Volume: "Volume 2", Chapters: testToc([]string{"", "4"}).Volumes[0].Chapters}},
+		},
+		{
+			"new volume",
+			testToc([]string{"Volume 1", "1", "2"}, []string{"Volume 2", "3"}, []string{"Volume 3", "4", "5"}),
+			[]Change{{Volume: "Volume 3", New: true, Chapters: testToc([]string{"", "4", "5"}).Volumes[0].Chapters}},
+		},
+		{
+			// A chapter moved to another volume is not new.
+			"moved and removed",
+			testToc([]string{"Volume 1", "1"}, []string{"Volume 2", "2", "3"}),
+			nil,
+		},
+		{
+			"renamed volume",
+			testToc([]string{"Volume 1", "1", "2"}, []string{"Volume 2: The End", "3", "4"}),
+			[]Change{{Volume: "Volume 2: The End", New: true, Chapters: testToc([]string{"", "4"}).Volumes[0].Chapters}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Diff(old, test.new); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	all := Diff(sites.Toc{}, old)
+	if len(all) != 2 || len(all[0].Chapters) != 2 || !all[0].New {
+		t.Errorf("got %+v for an empty table of contents", all)
+	}
+}
@@ -0,0 +1,184 @@
+// Licensed under BSD 2-Clause License.
+
+// Package notify tells the user when a sync builds a book with new
+// chapters, by POSTing to a webhook or running a local command as
+// given by config.Config.Notify.
+//
+// The webhook gets the Payload as JSON.  The command is run by the
+// shell with the following environment variables,
+//
+//	LN2EPUB_EVENT           the event, "book"
+//	LN2EPUB_TITLE           the title of the book
+//	LN2EPUB_SERIES          the title of the series
+//	LN2EPUB_VOLUME          the title of the volume, if any
+//	LN2EPUB_URL             the URL of the series
+//	LN2EPUB_FILE            the epub file
+//	LN2EPUB_CHAPTERS        the number of new chapters
+//	LN2EPUB_CHAPTER_TITLES  the titles of the new chapters, one per line
+//	LN2EPUB_CHAPTER_URLS    the URLs of the new chapters, one per line
+//	LN2EPUB_JSON            the payload as JSON
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/library"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/sites"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payload is the notification.
+type Payload struct {
+	// Event is "book" for a book built with new chapters.
+	Event string `json:"event"`
+
+	// Title is the title of the book.
+	Title string `json:"title"`
+
+	library.Update
+}
+
+// Return the payload for UPDATE.
+func NewPayload(u library.Update) Payload {
+	title := sites.Book{Series: u.Series, Volume: u.Volume}.Title()
+	return Payload{Event: "book", Title: title, Update: u}
+}
+
+// RetryDelay is the time to wait before the first retry of a failed
+// webhook request.  It is doubled for each retry after.
+var RetryDelay = 2 * time.Second
+
+// Return the timeout for notifier N.
+func timeout(n config.Notifier) time.Duration {
+	if n.Timeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(n.Timeout * float64(time.Second))
+}
+
+// Return whether a request that failed with status code CODE should be
+// tried again.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// POST payload P to the webhook of notifier N.
+// Failed requests are tried again N.Retries times, except those that
+// the webhook refuses with a 4xx status code.
+func Webhook(n config.Notifier, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	retries := n.Retries
+	if retries == 0 {
+		retries = 3
+	}
+	client := &http.Client{Timeout: timeout(n)}
+	delay := RetryDelay
+	for try := 0; ; try++ {
+		req, err := http.NewRequest(http.MethodPost, n.Webhook, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", fetch.UserAgent(config.Config.Contact))
+		for k, v := range n.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		retry := true
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode/100 == 2 {
+				return nil
+			}
+			err = fmt.Errorf("%s: %s", n.Webhook, resp.Status)
+			retry = retryable(resp.StatusCode)
+		}
+		if !retry || try >= retries {
+			return err
+		}
+		progress.Verbosef("Webhook failed, trying again in %v: %v", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Return the environment variables for payload P.
+func environ(p Payload) []string {
+	var titles, urls []string
+	for _, ch := range p.Chapters {
+		titles = append(titles, ch.Title)
+		urls = append(urls, ch.Url)
+	}
+	b, _ := json.Marshal(p)
+	return []string{
+		"LN2EPUB_EVENT=" + p.Event,
+		"LN2EPUB_TITLE=" + p.Title,
+		"LN2EPUB_SERIES=" + p.Series,
+		"LN2EPUB_VOLUME=" + p.Volume,
+		"LN2EPUB_URL=" + p.Url,
+		"LN2EPUB_FILE=" + p.File,
+		"LN2EPUB_CHAPTERS=" + strconv.Itoa(len(p.Chapters)),
+		"LN2EPUB_CHAPTER_TITLES=" + strings.Join(titles, "\n"),
+		"LN2EPUB_CHAPTER_URLS=" + strings.Join(urls, "\n"),
+		"LN2EPUB_JSON=" + string(b),
+	}
+}
+
+// Run the command of notifier N with payload P in the environment.
+func Command(n config.Notifier, p Payload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout(n))
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", n.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", n.Command)
+	}
+	cmd.Env = append(os.Environ(), environ(p)...)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		progress.Verbosef("%s", bytes.TrimRight(out, "\n"))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", n.Command, err)
+	}
+	return nil
+}
+
+// Send payload P with notifier N.
+func Send(n config.Notifier, p Payload) error {
+	if n.Command != "" {
+		return Command(n, p)
+	}
+	return Webhook(n, p)
+}
+
+// Notify every notifier in config.Config.Notify of UPDATE.
+// Errors are reported, and false returned if any notifier failed.
+func All(u library.Update) bool {
+	ok := true
+	p := NewPayload(u)
+	for _, n := range config.Config.Notify {
+		if err := Send(n, p); err != nil {
+			progress.Error(fmt.Errorf("notify: %v", err))
+			ok = false
+		}
+	}
+	return ok
+}
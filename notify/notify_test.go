@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"encoding/json"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/library"
+	"github.com/9viz/ln2epub/sites"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testUpdate = library.Update{
+	Series: "Foo",
+	Url:    "https://soafp.com/foo/",
+	Volume: "Volume 2",
+	Chapters: []sites.TocChapter{
+		{Title: "Chapter 3", Url: "https://soafp.com/foo/3"},
+		{Title: "Chapter 4", Url: "https://soafp.com/foo/4"},
+	},
+	File: "/books/Foo - Volume 2.epub",
+}
+
+// A webhook stand-in failing with the status codes in FAIL before
+// succeeding.
+type testHook struct {
+	mu       sync.Mutex
+	fail     []int
+	requests int
+	payload  Payload
+	auth     string
+}
+
+func (h *testHook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests++
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "not JSON", http.StatusUnsupportedMediaType)
+		return
+	}
+	h.auth = r.Header.Get("Authorization")
+	if err := json.NewDecoder(r.Body).Decode(&h.payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(h.fail) > 0 {
+		code := h.fail[0]
+		h.fail = h.fail[1:]
+		w.WriteHeader(code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestWebhook(t *testing.T) {
+	RetryDelay = 0
+	hook := &testHook{fail: []int{http.StatusBadGateway, http.StatusServiceUnavailable}}
+	ts := httptest.NewServer(hook)
+	defer ts.Close()
+
+	n := config.Notifier{Webhook: ts.URL, Headers: map[string]string{"Authorization": "Bearer foo"}}
+	if err := Send(n, NewPayload(testUpdate)); err != nil {
+		t.Fatal(err)
+	}
+	if hook.requests != 3 {
+		t.Errorf("got %d requests, want 3", hook.requests)
+	}
+	want := Payload{Event: "book", Title: "Foo - Volume 2", Update: testUpdate}
+	if hook.payload.Title != want.Title || hook.payload.File != want.File ||
+		len(hook.payload.Chapters) != 2 || hook.payload.Chapters[1] != testUpdate.Chapters[1] {
+		t.Errorf("got payload %+v, want %+v", hook.payload, want)
+	}
+	if hook.auth != "Bearer foo" {
+		t.Errorf("got Authorization %q", hook.auth)
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	RetryDelay = 0
+	for _, test := range []struct {
+		name     string
+		retries  int
+		fail     []int
+		requests int
+	}{
+		{"retries", 2, []int{500, 500, 500, 500}, 3},
+		{"no retries", -1, []int{500}, 1},
+		{"refused", 3, []int{http.StatusForbidden}, 1},
+		{"too many requests", 1, []int{http.StatusTooManyRequests, http.StatusTooManyRequests}, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			hook := &testHook{fail: test.fail}
+			ts := httptest.NewServer(hook)
+			defer ts.Close()
+			err := Webhook(config.Notifier{Webhook: ts.URL, Retries: test.retries}, NewPayload(testUpdate))
+			if err == nil {
+				t.Error("no error")
+			}
+			if hook.requests != test.requests {
+				t.Errorf("got %d requests, want %d", hook.requests, test.requests)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	n := config.Notifier{
+		Command: `printf '%s\n%s\n%s\n%s\n' "$LN2EPUB_TITLE" "$LN2EPUB_CHAPTERS" "$LN2EPUB_CHAPTER_URLS" "$LN2EPUB_FILE" > ` + out,
+	}
+	if err := Send(n, NewPayload(testUpdate)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Foo - Volume 2\n2\nhttps://soafp.com/foo/3\nhttps://soafp.com/foo/4\n/books/Foo - Volume 2.epub\n"
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+
+	err = Command(config.Notifier{Command: "exit 3"}, NewPayload(testUpdate))
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("got error %v", err)
+	}
+	err = Command(config.Notifier{Command: "exec sleep 5", Timeout: 0.1}, NewPayload(testUpdate))
+	if err == nil {
+		t.Error("command did not time out")
+	}
+}
@@ -0,0 +1,166 @@
+package opds
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Book is an epub file in the catalog.
+type Book struct {
+	// Path is the slash-separated path of the file in the catalog
+	// directory.
+	Path string
+
+	Title      string
+	Author     string
+	Language   string
+	Identifier string
+	Series     string
+
+	// Source is the URL the book was made from, and Site the name of
+	// the site, see sites.All.
+	Source string
+	Site   string
+
+	// Updated is the modification date in content.opf, or the
+	// modification time of the file if there is none.
+	Updated time.Time
+
+	// Cover is the path of the cover image in the epub archive, ""
+	// if there is none.
+	Cover     string
+	CoverType string
+
+	// Size and ModTime of the file, to tell when it changes.
+	Size    int64
+	ModTime time.Time
+}
+
+// The parts of content.opf we need.
+type opfPackage struct {
+	Metadata struct {
+		Titles      []string `xml:"title"`
+		Creators    []string `xml:"creator"`
+		Languages   []string `xml:"language"`
+		Identifiers []string `xml:"identifier"`
+		Sources     []string `xml:"source"`
+		Dates       []string `xml:"date"`
+		Meta        []struct {
+			Name     string `xml:"name,attr"`
+			Content  string `xml:"content,attr"`
+			Property string `xml:"property,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Items []struct {
+		Id         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+// Return the file NAME in archive Z.
+func zipRead(z *zip.Reader, name string) ([]byte, error) {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("no %s in the epub file", name)
+}
+
+// Return file NAME in the epub file R of SIZE bytes.
+func readFile(r io.ReaderAt, size int64, name string) ([]byte, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return zipRead(z, name)
+}
+
+// Return the first of VS, or "" if none.
+func first(vs []string) string {
+	if len(vs) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(vs[0])
+}
+
+// Read the metadata of the epub file R of SIZE bytes into B.
+// The metadata is taken from the root file given in
+// META-INF/container.xml.
+func readBook(r io.ReaderAt, size int64, b *Book) error {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	c, err := zipRead(z, "META-INF/container.xml")
+	if err != nil {
+		return err
+	}
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(c, &container); err != nil {
+		return fmt.Errorf("container.xml: %v", err)
+	}
+	if len(container.Rootfiles) == 0 {
+		return fmt.Errorf("container.xml has no root file")
+	}
+	root := container.Rootfiles[0].FullPath
+	o, err := zipRead(z, root)
+	if err != nil {
+		return err
+	}
+	var opf opfPackage
+	if err := xml.Unmarshal(o, &opf); err != nil {
+		return fmt.Errorf("%s: %v", root, err)
+	}
+
+	md := opf.Metadata
+	b.Title = first(md.Titles)
+	b.Author = first(md.Creators)
+	b.Language = first(md.Languages)
+	b.Identifier = first(md.Identifiers)
+	b.Source = first(md.Sources)
+	if t, err := time.Parse(time.RFC3339, first(md.Dates)); err == nil {
+		b.Updated = t
+	}
+	var coverId string
+	for _, m := range md.Meta {
+		switch {
+		case m.Name == "calibre:series":
+			b.Series = m.Content
+		case m.Property == "belongs-to-collection" && b.Series == "":
+			b.Series = strings.TrimSpace(m.Value)
+		case m.Property == "dcterms:modified":
+			if t, err := time.Parse(time.RFC3339, strings.TrimSpace(m.Value)); err == nil {
+				b.Updated = t
+			}
+		case m.Name == "cover":
+			coverId = m.Content
+		}
+	}
+	for _, i := range opf.Items {
+		if strings.Contains(" "+i.Properties+" ", " cover-image ") ||
+			(i.Id == coverId && b.Cover == "") {
+			b.Cover = path.Join(path.Dir(root), i.Href)
+			b.CoverType = i.MediaType
+		}
+	}
+	return nil
+}
@@ -0,0 +1,552 @@
+// Licensed under BSD 2-Clause License.
+
+// Package opds publishes the epub files in a directory as an OPDS 1.2
+// catalog, so that e-readers can browse and download them.
+// The books are grouped by series and by the site they were made from,
+// as given by the metadata in their content.opf.
+package opds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/sites"
+	"io/fs"
+	"net/http"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of the feeds.
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	SearchType      = "application/opensearchdescription+xml"
+)
+
+// Catalog is an OPDS catalog of the epub files in Dir and its
+// subdirectories.  The files are read again when they change.
+type Catalog struct {
+	// Dir is the directory with the epub files.
+	Dir string
+
+	// Prefix is the path the catalog is served under, e.g.,
+	// "/opds".
+	Prefix string
+
+	// Title is the title of the catalog.
+	Title string
+
+	// PageSize is the number of books in each page of the feeds.
+	PageSize int
+
+	mu    sync.Mutex
+	books map[string]*Book
+}
+
+// Return a new Catalog of the epub files in DIR served under PREFIX.
+func NewCatalog(dir, prefix string) *Catalog {
+	return &Catalog{
+		Dir:      dir,
+		Prefix:   strings.TrimSuffix(prefix, "/"),
+		Title:    "ln2epub",
+		PageSize: 25,
+		books:    make(map[string]*Book),
+	}
+}
+
+// Return the books in the catalog sorted by series and title.
+// Files that cannot be read are left out.
+func (c *Catalog) Books() ([]Book, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(c.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(strings.ToLower(p), ".epub") {
+			return nil
+		}
+		rel, err := filepath.Rel(c.Dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		seen[rel] = true
+		if b, ok := c.books[rel]; ok && b.Size == info.Size() && b.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+		b, err := c.read(p, rel, info)
+		if err != nil {
+			progress.Verbosef("Cannot read %s: %v", p, err)
+			delete(c.books, rel)
+			return nil
+		}
+		c.books[rel] = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	books := make([]Book, 0, len(c.books))
+	for rel, b := range c.books {
+		if !seen[rel] {
+			delete(c.books, rel)
+			continue
+		}
+		books = append(books, *b)
+	}
+	sort.Slice(books, func(i, j int) bool {
+		if books[i].Series != books[j].Series {
+			return books[i].Series < books[j].Series
+		}
+		if books[i].Title != books[j].Title {
+			return books[i].Title < books[j].Title
+		}
+		return books[i].Path < books[j].Path
+	})
+	return books, nil
+}
+
+// Read the epub file P, REL in the catalog, with file info INFO.
+func (c *Catalog) read(p, rel string, info fs.FileInfo) (*Book, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := &Book{
+		Path:    rel,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Updated: info.ModTime(),
+	}
+	if err := readBook(f, info.Size(), b); err != nil {
+		return nil, err
+	}
+	if b.Title == "" {
+		b.Title = strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+	}
+	if b.Series == "" {
+		b.Series = b.Title
+	}
+	if b.Identifier == "" {
+		b.Identifier = "urn:ln2epub:file:" + rel
+	}
+	b.Site = "other"
+	if s, ok := sites.For(b.Source); ok && b.Source != "" {
+		b.Site = s.Name
+	} else if u, err := nurl.Parse(b.Source); err == nil && u.Host != "" {
+		b.Site = u.Host
+	}
+	return b, nil
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	Id         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Source     string         `xml:"dc:source,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Content    *atomContent   `xml:"content"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomFeed struct {
+	XMLName         xml.Name    `xml:"feed"`
+	Xmlns           string      `xml:"xmlns,attr"`
+	XmlnsDc         string      `xml:"xmlns:dc,attr"`
+	XmlnsOpds       string      `xml:"xmlns:opds,attr"`
+	XmlnsOpenSearch string      `xml:"xmlns:opensearch,attr"`
+	Id              string      `xml:"id"`
+	Title           string      `xml:"title"`
+	Updated         string      `xml:"updated"`
+	Author          atomAuthor  `xml:"author"`
+	TotalResults    int         `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage    int         `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex      int         `xml:"opensearch:startIndex,omitempty"`
+	Links           []atomLink  `xml:"link"`
+	Entries         []atomEntry `xml:"entry"`
+}
+
+// Return a new feed at path P under the prefix with TITLE and type
+// TYP.  The feed is updated on UPDATED.
+func (c *Catalog) feed(p, title, typ string, updated time.Time) *atomFeed {
+	return &atomFeed{
+		Xmlns:           "http://www.w3.org/2005/Atom",
+		XmlnsDc:         "http://purl.org/dc/terms/",
+		XmlnsOpds:       "http://opds-spec.org/2010/catalog",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		Id:              "urn:ln2epub:catalog" + p,
+		Title:           title,
+		Updated:         updated.UTC().Format(time.RFC3339),
+		Author:          atomAuthor{c.Title},
+		Links: []atomLink{
+			{Rel: "self", Href: c.Prefix + p, Type: typ},
+			{Rel: "start", Href: c.Prefix + "/", Type: NavigationType},
+			{Rel: "search", Href: c.Prefix + "/opensearch.xml", Type: SearchType},
+		},
+	}
+}
+
+// Return the time the last of BOOKS was updated.
+func lastUpdated(books []Book) time.Time {
+	var t time.Time
+	for _, b := range books {
+		if b.Updated.After(t) {
+			t = b.Updated
+		}
+	}
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// Return the path of the catalog file P with every element escaped.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, s := range parts {
+		parts[i] = nurl.PathEscape(s)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Return the entry for book B.
+func (c *Catalog) entry(b Book) atomEntry {
+	e := atomEntry{
+		Title:    b.Title,
+		Id:       b.Identifier,
+		Updated:  b.Updated.UTC().Format(time.RFC3339),
+		Language: b.Language,
+		Source:   b.Source,
+		Categories: []atomCategory{
+			{Term: b.Site, Label: b.Site},
+		},
+		Content: &atomContent{Type: "text", Text: "Series: " + b.Series},
+		Links: []atomLink{
+			{
+				Rel:  "http://opds-spec.org/acquisition",
+				Href: c.Prefix + "/files/" + escapePath(b.Path),
+				Type: "application/epub+zip",
+			},
+			{
+				Rel:  "related",
+				Href: c.Prefix + "/series/" + nurl.PathEscape(b.Series),
+				Type: AcquisitionType, Title: "All books in " + b.Series,
+			},
+		},
+	}
+	if b.Author != "" {
+		e.Authors = []atomAuthor{{b.Author}}
+	}
+	if b.Cover != "" {
+		href := c.Prefix + "/covers/" + escapePath(b.Path)
+		e.Links = append(e.Links,
+			atomLink{Rel: "http://opds-spec.org/image", Href: href, Type: b.CoverType},
+			atomLink{Rel: "http://opds-spec.org/image/thumbnail", Href: href, Type: b.CoverType})
+	}
+	return e
+}
+
+// Return a navigation entry titled TITLE for the feed at path P.
+// CONTENT describes it.
+func (c *Catalog) navEntry(p, title, content string, updated time.Time) atomEntry {
+	return atomEntry{
+		Title:   title,
+		Id:      "urn:ln2epub:catalog" + p,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Content: &atomContent{Type: "text", Text: content},
+		Links: []atomLink{
+			{Rel: "subsection", Href: c.Prefix + p, Type: AcquisitionType},
+		},
+	}
+}
+
+// Fill feed F at path P with page no. PAGE of BOOKS.
+// QUERY are the query parameters of the feed other than page.
+func (c *Catalog) page(f *atomFeed, p string, query nurl.Values, books []Book, page int) {
+	size := c.PageSize
+	if size < 1 {
+		size = len(books) + 1
+	}
+	pages := (len(books) + size - 1) / size
+	if pages == 0 {
+		pages = 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * size
+	for i := start; i < start+size && i < len(books); i++ {
+		f.Entries = append(f.Entries, c.entry(books[i]))
+	}
+	f.TotalResults = len(books)
+	f.ItemsPerPage = size
+	f.StartIndex = start + 1
+
+	link := func(rel string, n int) {
+		q := nurl.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if n > 1 {
+			q.Set("page", strconv.Itoa(n))
+		}
+		href := c.Prefix + p
+		if len(q) > 0 {
+			href += "?" + q.Encode()
+		}
+		f.Links = append(f.Links, atomLink{Rel: rel, Href: href, Type: AcquisitionType})
+	}
+	link("first", 1)
+	if page > 1 {
+		link("previous", page-1)
+	}
+	if page < pages {
+		link("next", page+1)
+	}
+	link("last", pages)
+}
+
+// Return the groups of BOOKS by KEY, sorted by name.
+func group(books []Book, key func(Book) string) ([]string, map[string][]Book) {
+	groups := make(map[string][]Book)
+	var names []string
+	for _, b := range books {
+		k := key(b)
+		if _, ok := groups[k]; !ok {
+			names = append(names, k)
+		}
+		groups[k] = append(groups[k], b)
+	}
+	sort.Strings(names)
+	return names, groups
+}
+
+// Return the books in BOOKS matching all the words of QUERY in their
+// title, author, series or site.
+func search(books []Book, query string) []Book {
+	words := strings.Fields(strings.ToLower(query))
+	var found []Book
+	for _, b := range books {
+		s := strings.ToLower(strings.Join([]string{b.Title, b.Author, b.Series, b.Site}, " "))
+		match := true
+		for _, w := range words {
+			match = match && strings.Contains(s, w)
+		}
+		if match {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+// Write feed F to W.
+func writeFeed(w http.ResponseWriter, typ string, f *atomFeed) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf.WriteString("\n")
+	w.Header().Set("Content-Type", typ+";charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// Serve the catalog.
+// The feeds are,
+//
+//	PREFIX/                 the root navigation feed
+//	PREFIX/books            all the books
+//	PREFIX/series           the series
+//	PREFIX/series/NAME      the books of series NAME
+//	PREFIX/sites            the sites
+//	PREFIX/sites/NAME       the books from site NAME
+//	PREFIX/search?q=QUERY   the books matching QUERY
+//	PREFIX/opensearch.xml   the OpenSearch description
+//
+// The acquisition feeds are split into pages of PageSize books, given
+// by the page query parameter.
+func (c *Catalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, c.Prefix)
+	if p == "" {
+		p = "/"
+	}
+	if p == "/opensearch.xml" {
+		c.serveOpenSearch(w)
+		return
+	}
+
+	books, err := c.Books()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pageNo, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	updated := lastUpdated(books)
+
+	switch {
+	case p == "/":
+		f := c.feed(p, c.Title, NavigationType, updated)
+		f.Entries = []atomEntry{
+			c.navEntry("/books", "All books", fmt.Sprintf("%d books", len(books)), updated),
+			c.navEntry("/series", "By series", "Books grouped by series", updated),
+			c.navEntry("/sites", "By site", "Books grouped by the site they are from", updated),
+		}
+		f.Entries[1].Links[0].Type = NavigationType
+		f.Entries[2].Links[0].Type = NavigationType
+		writeFeed(w, NavigationType, f)
+
+	case p == "/books":
+		f := c.feed(p, "All books", AcquisitionType, updated)
+		c.page(f, p, nil, books, pageNo)
+		writeFeed(w, AcquisitionType, f)
+
+	case p == "/search":
+		q := r.URL.Query().Get("q")
+		found := search(books, q)
+		f := c.feed(p, "Search results for "+q, AcquisitionType, lastUpdated(found))
+		c.page(f, p, nurl.Values{"q": {q}}, found, pageNo)
+		writeFeed(w, AcquisitionType, f)
+
+	case p == "/series" || p == "/sites":
+		key := func(b Book) string { return b.Series }
+		title := "By series"
+		if p == "/sites" {
+			key = func(b Book) string { return b.Site }
+			title = "By site"
+		}
+		names, groups := group(books, key)
+		f := c.feed(p, title, NavigationType, updated)
+		for _, n := range names {
+			f.Entries = append(f.Entries, c.navEntry(p+"/"+nurl.PathEscape(n), n,
+				fmt.Sprintf("%d books", len(groups[n])), lastUpdated(groups[n])))
+		}
+		writeFeed(w, NavigationType, f)
+
+	case strings.HasPrefix(p, "/series/") || strings.HasPrefix(p, "/sites/"):
+		kind, name, _ := strings.Cut(p[1:], "/")
+		var found []Book
+		for _, b := range books {
+			if (kind == "series" && b.Series == name) || (kind == "sites" && b.Site == name) {
+				found = append(found, b)
+			}
+		}
+		if len(found) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		self := "/" + kind + "/" + nurl.PathEscape(name)
+		f := c.feed(self, name, AcquisitionType, lastUpdated(found))
+		c.page(f, self, nil, found, pageNo)
+		writeFeed(w, AcquisitionType, f)
+
+	case strings.HasPrefix(p, "/files/") || strings.HasPrefix(p, "/covers/"):
+		kind, name, _ := strings.Cut(p[1:], "/")
+		for _, b := range books {
+			if b.Path != name {
+				continue
+			}
+			if kind == "files" {
+				w.Header().Set("Content-Type", "application/epub+zip")
+				http.ServeFile(w, r, filepath.Join(c.Dir, filepath.FromSlash(b.Path)))
+			} else {
+				c.serveCover(w, r, b)
+			}
+			return
+		}
+		http.NotFound(w, r)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Serve the cover image of book B.
+func (c *Catalog) serveCover(w http.ResponseWriter, r *http.Request, b Book) {
+	if b.Cover == "" {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(c.Dir, filepath.FromSlash(b.Path)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	img, err := readFile(f, b.Size, b.Cover)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", b.CoverType)
+	w.Write(img)
+}
+
+// Serve the OpenSearch description of the catalog.
+func (c *Catalog) serveOpenSearch(w http.ResponseWriter) {
+	type url struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	}
+	desc := struct {
+		XMLName     xml.Name `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+		ShortName   string   `xml:"ShortName"`
+		Description string   `xml:"Description"`
+		InputEnc    string   `xml:"InputEncoding"`
+		OutputEnc   string   `xml:"OutputEncoding"`
+		Url         url      `xml:"Url"`
+	}{
+		ShortName:   c.Title,
+		Description: "Search the books by title, author, series or site",
+		InputEnc:    "UTF-8",
+		OutputEnc:   "UTF-8",
+		Url:         url{AcquisitionType, c.Prefix + "/search?q={searchTerms}"},
+	}
+	b, _ := xml.MarshalIndent(desc, "", "  ")
+	w.Header().Set("Content-Type", SearchType+";charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+	w.Write([]byte("\n"))
+}
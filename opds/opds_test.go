@@ -0,0 +1,294 @@
+package opds
+
+import (
+	"encoding/xml"
+	"github.com/9viz/ln2epub/epub"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Make the epub file NAME in DIR.
+func testEpub(t *testing.T, dir, name string, meta epub.Metadata, cover bool) {
+	t.Helper()
+	b := epub.NewBuilder(meta)
+	if cover {
+		b.SetCover([]byte("cover of "+meta.Title), "image/jpeg")
+	}
+	b.AddChapter("Chapter 1", "<p>Hello.</p>")
+	f := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.BuildFile(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Return a catalog with three books in two series from two sites.
+func testCatalog(t *testing.T) (*Catalog, *httptest.Server) {
+	dir := t.TempDir()
+	date := time.Date(2023, time.January, 18, 0, 0, 0, 0, time.UTC)
+	vol := func(n string) epub.Metadata {
+		return epub.Metadata{
+			Title:      "The Wandering Sage - Volume " + n,
+			Author:     "CClaw Translations",
+			Identifier: epub.Uuid("sage" + n),
+			Date:       date,
+			Series:     "The Wandering Sage",
+			Source:     "https://cclawtranslations.home.blog/the-wandering-sage-toc/",
+		}
+	}
+	testEpub(t, dir, "sage/Volume 1.epub", vol("1"), true)
+	testEpub(t, dir, "sage/Volume 2.epub", vol("2"), false)
+	testEpub(t, dir, "hourglass.epub", epub.Metadata{
+		Title:      "The Villainess Reverses the Hourglass",
+		Identifier: epub.Uuid("hourglass"),
+		Date:       date.Add(time.Hour),
+		Version:    3,
+		Series:     "The Villainess Reverses the Hourglass",
+		Source:     "https://soafp.com/series/the-villainess-reverses-the-hourglass/",
+	}, true)
+	os.WriteFile(filepath.Join(dir, "broken.epub"), []byte("not a zip"), 0644)
+
+	c := NewCatalog(dir, "/opds")
+	ts := httptest.NewServer(c)
+	t.Cleanup(ts.Close)
+	return c, ts
+}
+
+// The parts of a feed we check.
+type testFeed struct {
+	Title        string `xml:"title"`
+	TotalResults int    `xml:"totalResults"`
+	Links        []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+	Entries []struct {
+		Title   string `xml:"title"`
+		Id      string `xml:"id"`
+		Updated string `xml:"updated"`
+		Author  string `xml:"author>name"`
+		Content string `xml:"content"`
+		Links   []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Return the link of feed F with REL.
+func (f testFeed) link(rel string) string {
+	for _, l := range f.Links {
+		if l.Rel == rel {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// Get the feed at path P from TS.
+func testGet(t *testing.T, ts *httptest.Server, p, typ string) testFeed {
+	t.Helper()
+	resp, err := http.Get(ts.URL + p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: got status %s", p, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, typ) {
+		t.Errorf("%s: got content type %s, want %s", p, ct, typ)
+	}
+	var f testFeed
+	if err := xml.NewDecoder(resp.Body).Decode(&f); err != nil {
+		t.Fatalf("%s: %v", p, err)
+	}
+	return f
+}
+
+func TestBooks(t *testing.T) {
+	c, _ := testCatalog(t)
+	books, err := c.Books()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 3 {
+		t.Fatalf("got %d books", len(books))
+	}
+	// Sorted by series, The Villainess comes first.
+	if books[0].Path != "hourglass.epub" || books[0].Site != "soafp" {
+		t.Errorf("got first book %+v", books[0])
+	}
+	b := books[1]
+	want := Book{
+		Path:       "sage/Volume 1.epub",
+		Title:      "The Wandering Sage - Volume 1",
+		Author:     "CClaw Translations",
+		Language:   "en",
+		Identifier: epub.Uuid("sage1"),
+		Series:     "The Wandering Sage",
+		Source:     "https://cclawtranslations.home.blog/the-wandering-sage-toc/",
+		Site:       "cclaw",
+		Updated:    time.Date(2023, time.January, 18, 0, 0, 0, 0, time.UTC),
+		Cover:      "OEBPS/Images/cover",
+		CoverType:  "image/jpeg",
+		Size:       b.Size,
+		ModTime:    b.ModTime,
+	}
+	if b != want {
+		t.Errorf("got\n%+v\nwant\n%+v", b, want)
+	}
+	if books[2].Cover != "" {
+		t.Errorf("got cover %s for a book without one", books[2].Cover)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	_, ts := testCatalog(t)
+
+	root := testGet(t, ts, "/opds", NavigationType)
+	if len(root.Entries) != 3 || root.link("search") != "/opds/opensearch.xml" {
+		t.Fatalf("got root feed %+v", root)
+	}
+
+	all := testGet(t, ts, "/opds/books", AcquisitionType)
+	if all.TotalResults != 3 || len(all.Entries) != 3 {
+		t.Fatalf("got %d of %d books", len(all.Entries), all.TotalResults)
+	}
+	e := all.Entries[0]
+	if e.Title != "The Villainess Reverses the Hourglass" || e.Updated != "2023-01-18T01:00:00Z" {
+		t.Errorf("got entry %+v", e)
+	}
+	links := make(map[string]string)
+	for _, l := range e.Links {
+		links[l.Rel] = l.Href
+	}
+	if links["http://opds-spec.org/acquisition"] != "/opds/files/hourglass.epub" ||
+		links["http://opds-spec.org/image"] != "/opds/covers/hourglass.epub" {
+		t.Errorf("got links %v", links)
+	}
+
+	series := testGet(t, ts, "/opds/series", NavigationType)
+	if len(series.Entries) != 2 || series.Entries[1].Title != "The Wandering Sage" ||
+		series.Entries[1].Content != "2 books" {
+		t.Fatalf("got series feed %+v", series)
+	}
+	sage := testGet(t, ts, series.Entries[1].Links[0].Href, AcquisitionType)
+	if len(sage.Entries) != 2 || sage.Entries[0].Author != "CClaw Translations" {
+		t.Errorf("got series %+v", sage)
+	}
+
+	bySite := testGet(t, ts, "/opds/sites", NavigationType)
+	if len(bySite.Entries) != 2 || bySite.Entries[0].Title != "cclaw" || bySite.Entries[1].Title != "soafp" {
+		t.Errorf("got sites feed %+v", bySite)
+	}
+	soafp := testGet(t, ts, "/opds/sites/soafp", AcquisitionType)
+	if len(soafp.Entries) != 1 {
+		t.Errorf("got %d books from soafp", len(soafp.Entries))
+	}
+
+	found := testGet(t, ts, "/opds/search?q=sage+volume+2", AcquisitionType)
+	if len(found.Entries) != 1 || found.Entries[0].Title != "The Wandering Sage - Volume 2" {
+		t.Errorf("got search results %+v", found)
+	}
+}
+
+func TestCatalogPages(t *testing.T) {
+	c, ts := testCatalog(t)
+	c.PageSize = 2
+
+	p1 := testGet(t, ts, "/opds/books", AcquisitionType)
+	if len(p1.Entries) != 2 || p1.link("previous") != "" || p1.link("next") != "/opds/books?page=2" {
+		t.Fatalf("got first page %+v", p1)
+	}
+	p2 := testGet(t, ts, p1.link("next"), AcquisitionType)
+	if len(p2.Entries) != 1 || p2.link("next") != "" || p2.link("previous") != "/opds/books" {
+		t.Fatalf("got second page %+v", p2)
+	}
+	if p2.Entries[0].Id == p1.Entries[0].Id || p2.Entries[0].Id == p1.Entries[1].Id {
+		t.Error("pages overlap")
+	}
+
+	q := testGet(t, ts, "/opds/search?q=the", AcquisitionType)
+	want := nurl.Values{"page": {"2"}, "q": {"the"}}
+	if next := q.link("next"); next != "/opds/search?"+want.Encode() {
+		t.Errorf("got next page %s of search results", next)
+	}
+}
+
+func TestCatalogFiles(t *testing.T) {
+	_, ts := testCatalog(t)
+
+	for p, want := range map[string]string{
+		"/opds/covers/sage/Volume%201.epub": "cover of The Wandering Sage - Volume 1",
+		"/opds/covers/hourglass.epub":       "cover of The Villainess Reverses the Hourglass",
+	} {
+		resp, err := http.Get(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != want || resp.Header.Get("Content-Type") != "image/jpeg" {
+			t.Errorf("%s: got %q of type %s", p, b, resp.Header.Get("Content-Type"))
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/opds/files/sage/Volume%202.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(string(b), "PK") || resp.Header.Get("Content-Type") != "application/epub+zip" {
+		t.Errorf("got %d bytes of type %s", len(b), resp.Header.Get("Content-Type"))
+	}
+
+	for _, p := range []string{
+		"/opds/covers/sage/Volume%202.epub",
+		"/opds/files/broken.epub",
+		"/opds/files/../opds_test.go",
+		"/opds/series/nothing",
+	} {
+		resp, err := http.Get(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: got status %s", p, resp.Status)
+		}
+	}
+}
+
+func TestOpenSearch(t *testing.T) {
+	_, ts := testCatalog(t)
+	resp, err := http.Get(ts.URL + "/opds/opensearch.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var desc struct {
+		Url struct {
+			Type     string `xml:"type,attr"`
+			Template string `xml:"template,attr"`
+		}
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		t.Fatal(err)
+	}
+	if desc.Url.Template != "/opds/search?q={searchTerms}" || desc.Url.Type != AcquisitionType {
+		t.Errorf("got %+v", desc.Url)
+	}
+}
@@ -0,0 +1,283 @@
+// Licensed under BSD 2-Clause License.
+
+// Package progress reports the progress of fetching books, either as
+// plain lines, a progress bar or JSON events.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log levels.
+const (
+	// Only errors are reported.
+	Quiet = iota
+	// Books and chapters are reported.
+	Normal
+	// Every request is also reported.
+	Verbose
+)
+
+// Event is a progress report.
+// These are written one per line as JSON objects with -json.
+type Event struct {
+	Time time.Time `json:"time"`
+
+	// Event is one of "book", "chapter", "fetch", "created",
+	// "skipped", "mailed", "message" or "error".
+	Event string `json:"event"`
+
+	// Book is the title of the book being built.
+	Book string `json:"book,omitempty"`
+
+	// Title is the title of the chapter for "chapter" events.
+	Title string `json:"title,omitempty"`
+
+	Url string `json:"url,omitempty"`
+
+	// N is the number of the chapter being fetched, out of Total.
+	N     int `json:"n,omitempty"`
+	Total int `json:"total,omitempty"`
+
+	// Bytes is the size of the response for "fetch" events, and
+	// the bytes fetched so far for the book otherwise.
+	Bytes int64 `json:"bytes,omitempty"`
+
+	// Eta is the estimated number of seconds left for the book.
+	Eta float64 `json:"eta,omitempty"`
+
+	// File is the epub file for "created", "skipped" and "mailed"
+	// events.
+	File string `json:"file,omitempty"`
+
+	Message string `json:"message,omitempty"`
+}
+
+// Reporter is the progress reporting state.
+type Reporter struct {
+	mu sync.Mutex
+
+	// Level is the log level.
+	Level int
+
+	// Json is true if events should be written as JSON to Out.
+	Json bool
+
+	// Bar is true if a progress bar should be drawn in Out.
+	Bar bool
+
+	Out io.Writer
+
+	// Result is where created and skipped files are reported to
+	// when not writing JSON.
+	Result io.Writer
+
+	// Log is where every event is written to at the verbose
+	// level, nil if none.
+	Log io.Writer
+
+	book  string
+	n     int
+	total int
+	bytes int64
+	start time.Time
+	// Whether the bar is currently drawn.
+	drawn bool
+}
+
+// Default is where the progress is reported to.
+var Default = &Reporter{
+	Level:  Normal,
+	Out:    os.Stderr,
+	Result: os.Stdout,
+	Bar:    IsTerminal(os.Stderr),
+}
+
+// Return true if F is an interactive terminal.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0 &&
+		os.Getenv("TERM") != "dumb"
+}
+
+// Return a human readable form of byte count N.
+func humanBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// Return the estimated time left for the current book.
+func (p *Reporter) eta() time.Duration {
+	if p.n <= 1 || p.total == 0 {
+		return 0
+	}
+	// The current chapter has only just started.
+	done := p.n - 1
+	per := time.Since(p.start) / time.Duration(done)
+	return per * time.Duration(p.total-done)
+}
+
+// Return the plain text form of event EV.
+func (p *Reporter) text(ev Event) string {
+	switch ev.Event {
+	case "book":
+		return fmt.Sprintf("Fetching %s (%d chapters)", ev.Book, ev.Total)
+	case "chapter":
+		return fmt.Sprintf("Fetching %d/%d %s %s", ev.N, ev.Total, ev.Title, ev.Url)
+	case "fetch":
+		return fmt.Sprintf("Fetched %s (%s)", ev.Url, humanBytes(ev.Bytes))
+	case "created":
+		return fmt.Sprintf("Created epub file %s for %s", ev.File, ev.Book)
+	case "skipped":
+		return fmt.Sprintf("Skipped existing epub file %s for %s", ev.File, ev.Book)
+	case "mailed":
+		return fmt.Sprintf("Mailed %s for %s to %s", ev.File, ev.Book, ev.Message)
+	case "error":
+		return "error: " + ev.Message
+	}
+	return ev.Message
+}
+
+// Draw the progress bar for the current book.
+func (p *Reporter) draw() {
+	const width = 24
+	if p.total == 0 {
+		return
+	}
+	fill := width * p.n / p.total
+	bar := strings.Repeat("=", fill) + strings.Repeat(" ", width-fill)
+	line := fmt.Sprintf("[%s] %d/%d %s", bar, p.n, p.total,
+		humanBytes(p.bytes))
+	if eta := p.eta(); eta >= time.Second {
+		line += " ETA " + eta.Round(time.Second).String()
+	}
+	line += " " + p.book
+	cols := 80
+	if c, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && c > 0 {
+		cols = c
+	}
+	if r := []rune(line); len(r) >= cols {
+		line = string(r[:cols-1])
+	}
+	fmt.Fprint(p.Out, "\r\033[K", line)
+	p.drawn = true
+}
+
+// Report event EV at log level LEVEL.
+func (p *Reporter) report(level int, ev Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ev.Time = time.Now()
+	if ev.Book == "" && ev.Event != "message" && ev.Event != "error" {
+		ev.Book = p.book
+	}
+	if p.Log != nil {
+		fmt.Fprintln(p.Log, ev.Time.Format(time.RFC3339), p.text(ev))
+	}
+	if level > p.Level {
+		return
+	}
+
+	switch {
+	case p.Json:
+		b, _ := json.Marshal(ev)
+		fmt.Fprintf(p.Out, "%s\n", b)
+	case p.Bar && (ev.Event == "chapter" || ev.Event == "fetch" || ev.Event == "book"):
+		p.draw()
+	default:
+		if p.drawn {
+			fmt.Fprint(p.Out, "\r\033[K")
+			p.drawn = false
+		}
+		out := p.Out
+		if ev.Event == "created" || ev.Event == "skipped" {
+			out = p.Result
+		}
+		fmt.Fprintln(out, p.text(ev))
+		if p.Bar && p.n < p.total {
+			p.draw()
+		}
+	}
+}
+
+// Start reporting the progress of book TITLE with TOTAL chapters.
+func Book(title string, total int) {
+	p := Default
+	p.mu.Lock()
+	p.book = title
+	p.n, p.total, p.bytes = 0, total, 0
+	p.start = time.Now()
+	p.mu.Unlock()
+	p.report(Normal, Event{Event: "book", Total: total})
+}
+
+// Report fetching of chapter no. N, titled TITLE, of the current
+// book from URL.
+func Chapter(n int, title, url string) {
+	p := Default
+	p.mu.Lock()
+	p.n = n
+	ev := Event{
+		Event: "chapter",
+		Title: title,
+		Url:   url,
+		N:     n,
+		Total: p.total,
+		Bytes: p.bytes,
+		Eta:   p.eta().Seconds(),
+	}
+	p.mu.Unlock()
+	p.report(Normal, ev)
+}
+
+// Report fetching of N bytes from URL.
+func Fetched(url string, n int) {
+	p := Default
+	p.mu.Lock()
+	p.bytes += int64(n)
+	p.mu.Unlock()
+	p.report(Verbose, Event{Event: "fetch", Url: url, Bytes: int64(n)})
+}
+
+// Report creation of FILE for book TITLE.
+func Created(file, title string) {
+	Default.report(Quiet, Event{Event: "created", File: file, Book: title})
+}
+
+// Report skipping of existing FILE for book TITLE.
+func Skipped(file, title string) {
+	Default.report(Normal, Event{Event: "skipped", File: file, Book: title})
+}
+
+// Report mailing FILE for book TITLE to the addresses TO.
+func Mailed(file, title, to string) {
+	Default.report(Normal, Event{Event: "mailed", File: file, Book: title, Message: to})
+}
+
+// Report a message formatted according to FORMAT.
+func Logf(format string, a ...interface{}) {
+	Default.report(Normal, Event{Event: "message", Message: fmt.Sprintf(format, a...)})
+}
+
+// Like Logf, but only report at the verbose log level.
+func Verbosef(format string, a ...interface{}) {
+	Default.report(Verbose, Event{Event: "message", Message: fmt.Sprintf(format, a...)})
+}
+
+// Report error ERR.  Errors are reported at all log levels.
+func Error(err error) {
+	Default.report(Quiet, Event{Event: "error", Message: err.Error()})
+}
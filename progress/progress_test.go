@@ -0,0 +1,108 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Make Default report to buffers at LEVEL for the rest of the test,
+// and return the buffers for Out, Result and Log.
+func testReporter(t *testing.T, level int, asJson bool) (*bytes.Buffer, *bytes.Buffer, *bytes.Buffer) {
+	saved := Default
+	t.Cleanup(func() { Default = saved })
+	var out, result, log bytes.Buffer
+	Default = &Reporter{Level: level, Json: asJson, Out: &out, Result: &result, Log: &log}
+	return &out, &result, &log
+}
+
+// Report a book with a chapter, and every other kind of event.
+func testEvents() {
+	Book("Foo", 2)
+	Chapter(1, "Prologue", "https://example.com/1")
+	Fetched("https://example.com/1", 2048)
+	Verbosef("Verbose %d", 1)
+	Logf("Normal %d", 2)
+	Skipped("old.epub", "Bar")
+	Created("foo.epub", "Foo")
+	Error(errors.New("oops"))
+}
+
+func TestLevels(t *testing.T) {
+	for _, c := range []struct {
+		level       int
+		out, result string
+	}{
+		{Quiet, "error: oops\n", "Created epub file foo.epub for Foo\n"},
+		{Normal, `Fetching Foo (2 chapters)
+Fetching 1/2 Prologue https://example.com/1
+Normal 2
+error: oops
+`, "Skipped existing epub file old.epub for Bar\nCreated epub file foo.epub for Foo\n"},
+		{Verbose, `Fetching Foo (2 chapters)
+Fetching 1/2 Prologue https://example.com/1
+Fetched https://example.com/1 (2.0 KiB)
+Verbose 1
+Normal 2
+error: oops
+`, "Skipped existing epub file old.epub for Bar\nCreated epub file foo.epub for Foo\n"},
+	} {
+		out, result, log := testReporter(t, c.level, false)
+		testEvents()
+		if out.String() != c.out || result.String() != c.result {
+			t.Errorf("level %d: got\n%s\nand\n%s", c.level, out, result)
+		}
+		// The log gets every event, whatever the level.
+		if n := strings.Count(log.String(), "\n"); n != 8 || !strings.Contains(log.String(), "Verbose 1") {
+			t.Errorf("level %d: got log\n%s", c.level, log)
+		}
+	}
+}
+
+func TestJson(t *testing.T) {
+	out, result, _ := testReporter(t, Verbose, true)
+	testEvents()
+	if result.Len() > 0 {
+		t.Errorf("got results %s", result)
+	}
+	var events []string
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		var ev Event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		if ev.Time.IsZero() {
+			t.Errorf("no time in %s", line)
+		}
+		events = append(events, ev.Event)
+		switch ev.Event {
+		case "chapter":
+			if ev.N != 1 || ev.Total != 2 || ev.Book != "Foo" || ev.Title != "Prologue" {
+				t.Errorf("got %+v", ev)
+			}
+		case "fetch":
+			if ev.Bytes != 2048 {
+				t.Errorf("got %+v", ev)
+			}
+		}
+	}
+	want := "book chapter fetch message message skipped created error"
+	if got := strings.Join(events, " "); got != want {
+		t.Errorf("got events %s, want %s", got, want)
+	}
+}
+
+func TestEta(t *testing.T) {
+	p := &Reporter{n: 3, total: 10, start: time.Now().Add(-10 * time.Second)}
+	// Two chapters in 10s, so 5s for each of the 8 left.
+	if eta := p.eta(); eta < 40*time.Second || eta > 41*time.Second {
+		t.Errorf("got %v, want 40s", eta)
+	}
+	p.n = 1
+	if eta := p.eta(); eta != 0 {
+		t.Errorf("got %v before the first chapter is done", eta)
+	}
+}
@@ -0,0 +1,216 @@
+package serve
+
+import (
+	"encoding/json"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/export"
+	"html/template"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Return the HTTP handler of the server.
+// The API is,
+//
+//	GET    /                        the web form and the list of jobs
+//	GET    /jobs                    the jobs as JSON, newest first
+//	POST   /jobs                    submit a job
+//	GET    /jobs/ID                 job ID as JSON
+//	DELETE /jobs/ID                 remove job ID and its files
+//	GET    /jobs/ID/files/NAME      download file NAME of job ID
+//
+// A job is submitted with a JSON object like
+//
+//	{"url": "https://…", "epub_version": 3, "name_template": "{title}.epub", "format": "epub", "profile": "kobo"}
+//
+// or with the same fields as a form.  Errors are JSON objects with an
+// "error" field.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/", s.handleJob)
+	return mux
+}
+
+// Write V as JSON to W with status CODE.
+func writeJson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJson(w, code, map[string]string{"error": msg})
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		writeJson(w, http.StatusOK, s.List())
+	case "POST":
+		s.handleSubmit(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Url string `json:"url"`
+		Options
+	}
+	form := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if form {
+		req.Url = r.FormValue("url")
+		req.NameTemplate = r.FormValue("name_template")
+		req.Format = r.FormValue("format")
+		req.Profile = r.FormValue("profile")
+		if v := r.FormValue("epub_version"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid epub_version "+v)
+				return
+			}
+			req.EpubVersion = n
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	j, err := s.Submit(req.Url, req.Options)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if form {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+j.Id)
+	writeJson(w, http.StatusCreated, j)
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	id, name, hasFile := strings.Cut(rest, "/files/")
+	if strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if hasFile {
+		s.handleFile(w, r, id, name)
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		j, ok := s.Job(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "no job "+id)
+			return
+		}
+		writeJson(w, http.StatusOK, j)
+	case "DELETE":
+		if !s.Remove(id) {
+			writeError(w, http.StatusNotFound, "no job "+id)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Serve file NAME of job ID.
+// Only the files created by the job are served.
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request, id, name string) {
+	j, ok := s.Job(id)
+	found := false
+	for _, f := range j.Files {
+		found = found || f == name
+	}
+	if !ok || !found {
+		writeError(w, http.StatusNotFound, "no file "+name)
+		return
+	}
+	w.Header().Set("Content-Type", fileType(name))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+
+		strings.ReplaceAll(path.Base(name), `"`, "'")+`"`)
+	http.ServeFile(w, r, filepath.Join(s.JobDir(id), filepath.FromSlash(name)))
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ln2epub</title>
+{{if .Refresh}}<meta http-equiv="refresh" content="5">{{end}}
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; padding: 1em; }
+input[type=url] { width: 30em; }
+table { border-collapse: collapse; width: 100%; margin-top: 1em; }
+td, th { text-align: left; padding: 0.3em; border-bottom: 1px solid #ccc; }
+.failed { color: #a00; }
+</style>
+</head>
+<body>
+<h1>ln2epub</h1>
+<form method="post" action="/jobs">
+<p><label>Series URL <input type="url" name="url" required></label>
+<label>Epub version <select name="epub_version"><option value="">default</option><option value="2">2</option><option value="3">3</option></select></label>
+<label>Format <select name="format">{{range .Formats}}<option>{{.}}</option>{{end}}</select></label>
+<label>Profile <select name="profile"><option value="">none</option>{{range .Profiles}}<option>{{.}}</option>{{end}}</select></label>
+<button type="submit">Build</button></p>
+</form>
+<table>
+<tr><th>Series</th><th>State</th><th>Files</th><th></th></tr>
+{{range .Jobs}}<tr>
+<td><a href="{{.Url}}">{{.Url}}</a></td>
+<td class="{{.State}}">{{.State}}{{if eq .State "running"}} {{.Progress.N}}/{{.Progress.Total}} {{.Progress.Book}}{{end}}{{if .Error}}<br>{{.Error}}{{end}}</td>
+<td>{{$id := .Id}}{{range .Files}}<a href="/jobs/{{$id}}/files/{{.}}">{{.}}</a><br>{{end}}</td>
+<td><a href="/jobs/{{.Id}}">JSON</a></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	jobs := s.List()
+	refresh := false
+	for _, j := range jobs {
+		refresh = refresh || j.State == Queued || j.State == Running
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexTemplate.Execute(w, struct {
+		Jobs     []Job
+		Refresh  bool
+		Formats  []string
+		Profiles []string
+	}{jobs, refresh, export.Formats, config.ProfileNames()})
+}
+
+// Return the content type of the file NAME.
+func fileType(name string) string {
+	if strings.HasSuffix(name, ".epub") {
+		return "application/epub+zip"
+	}
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
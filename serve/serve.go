@@ -0,0 +1,568 @@
+// Licensed under BSD 2-Clause License.
+
+// Package serve runs ln2epub as an HTTP service.
+// Books are built by jobs submitted through a small REST API or a web
+// form, see Server.Handler.  Each job runs ln2epub in a separate
+// process with -json, and its progress is read from the events it
+// writes.  This way jobs do not share the global state of the other
+// packages.
+package serve
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/export"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/9viz/ln2epub/sites"
+	"io"
+	nurl "net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job states.
+const (
+	Queued  = "queued"
+	Running = "running"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// Options are the build options of a job.
+type Options struct {
+	// EpubVersion is the epub version, 2 or 3.  Zero means the
+	// default.
+	EpubVersion int `json:"epub_version,omitempty"`
+
+	// NameTemplate is the template for the epub filenames, see
+	// sites.BookFileName.  Empty means "{title}.epub".
+	NameTemplate string `json:"name_template,omitempty"`
+
+	// Format is the output format, see export.Formats.  Empty means
+	// epub.
+	Format string `json:"format,omitempty"`
+
+	// Profile is the device profile, see config.ApplyProfile.
+	// Empty means none.
+	Profile string `json:"profile,omitempty"`
+}
+
+// Progress is the progress of a running job.
+type Progress struct {
+	// Book is the title of the book being built.
+	Book string `json:"book,omitempty"`
+
+	// N is the number of the chapter being fetched, out of Total.
+	N     int `json:"n"`
+	Total int `json:"total"`
+
+	// Bytes fetched so far for the book.
+	Bytes int64 `json:"bytes"`
+}
+
+// Job is a request to build the books of a series.
+type Job struct {
+	Id      string  `json:"id"`
+	Url     string  `json:"url"`
+	Options Options `json:"options"`
+
+	// State is one of Queued, Running, Done or Failed.
+	State    string   `json:"state"`
+	Progress Progress `json:"progress"`
+
+	// Files are the created epub files, slash-separated and
+	// relative to the directory of the job.
+	Files []string `json:"files,omitempty"`
+
+	// Error is why the job failed, or the last error reported by
+	// a job that is done.
+	Error string `json:"error,omitempty"`
+
+	Created  time.Time `json:"created"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+// Server runs the submitted jobs.
+// The jobs are kept in Dir, so that they survive restarts.
+type Server struct {
+	// Dir is where the jobs and their files are kept.
+	Dir string
+
+	// Jobs is the number of jobs run in parallel.
+	Jobs int
+
+	// MaxAge is how long finished jobs and their files are kept.
+	// Zero means forever.
+	MaxAge time.Duration
+
+	// Command is the ln2epub command to run for each job.  Nil means
+	// the running program.
+	Command []string
+
+	// Args are extra arguments for every job, e.g., -config FILE.
+	Args []string
+
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	procs map[string]*os.Process
+	wake  chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// Return a new Server keeping its jobs in DIR.
+// The jobs of a previous run are loaded from DIR.  Jobs that were
+// running when it stopped are queued again.
+func NewServer(dir string) (*Server, error) {
+	s := &Server{
+		Dir:   dir,
+		Jobs:  1,
+		jobs:  make(map[string]*Job),
+		procs: make(map[string]*os.Process),
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "jobs"), 0755); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(s.jobsFile())
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(b, &jobs); err != nil {
+		return nil, fmt.Errorf("%s: %v", s.jobsFile(), err)
+	}
+	for _, j := range jobs {
+		if j.State == Running {
+			j.State = Queued
+			j.Progress = Progress{}
+		}
+		s.jobs[j.Id] = j
+	}
+	return s, nil
+}
+
+func (s *Server) jobsFile() string {
+	return filepath.Join(s.Dir, "jobs.json")
+}
+
+// Return the directory of the files of job ID.
+func (s *Server) JobDir(id string) string {
+	return filepath.Join(s.Dir, "jobs", id)
+}
+
+// Write the jobs to the jobs file.
+// The caller should hold s.mu.
+func (s *Server) save() {
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Created.Before(jobs[k].Created)
+	})
+	b, _ := json.MarshalIndent(jobs, "", "  ")
+	tmp := s.jobsFile() + ".tmp"
+	err := os.WriteFile(tmp, append(b, '\n'), 0644)
+	if err == nil {
+		err = os.Rename(tmp, s.jobsFile())
+	}
+	if err != nil {
+		progress.Error(err)
+	}
+}
+
+// Return a copy of job J.
+func (j *Job) copy() Job {
+	c := *j
+	c.Files = append([]string(nil), j.Files...)
+	return c
+}
+
+// Start running the queued jobs, and removing old jobs if MaxAge is
+// set.
+func (s *Server) Start() {
+	n := s.Jobs
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	if s.MaxAge > 0 {
+		s.wg.Add(1)
+		go s.cleaner()
+	}
+	s.signal()
+}
+
+// Stop running jobs.
+// Running jobs are killed and will be run again by the next Server in
+// the same Dir.
+func (s *Server) Close() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	close(s.done)
+	s.mu.Lock()
+	for _, p := range s.procs {
+		p.Kill()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Wake up a worker.
+func (s *Server) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Server) worker() {
+	defer s.wg.Done()
+	for {
+		if j := s.next(); j != nil {
+			s.run(j)
+			continue
+		}
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Return the oldest queued job after marking it as running, or nil if
+// there are none.
+func (s *Server) next() *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	var next *Job
+	for _, j := range s.jobs {
+		if j.State == Queued && (next == nil || j.Created.Before(next.Created)) {
+			next = j
+		}
+	}
+	if next != nil {
+		next.State = Running
+		next.Started = time.Now()
+		next.Files = nil
+		next.Error = ""
+		s.save()
+		// Let another worker pick the next one.
+		s.signal()
+	}
+	return next
+}
+
+// Return the command line for job J.
+func (s *Server) command(j *Job) ([]string, error) {
+	cmd := s.Command
+	if cmd == nil {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		cmd = []string{exe}
+	}
+	args := append([]string(nil), cmd...)
+	args = append(args, s.Args...)
+	template := j.Options.NameTemplate
+	if template == "" {
+		template = "{title}.epub"
+	}
+	// Jobs running at the same time would overwrite each other's
+	// cookie file, so they only read it.
+	args = append(args, "-json", "-save-cookies=false", "-output-dir", s.JobDir(j.Id),
+		"-name-template", template, "-on-conflict", "overwrite")
+	if j.Options.EpubVersion != 0 {
+		args = append(args, "-epub-version", strconv.Itoa(j.Options.EpubVersion))
+	}
+	if j.Options.Format != "" {
+		args = append(args, "-format", j.Options.Format)
+	}
+	if j.Options.Profile != "" {
+		args = append(args, "-profile", j.Options.Profile)
+	}
+	return append(args, "--", j.Url), nil
+}
+
+// The most of the standard error of a job kept for its error message.
+const maxStderr = 16 << 10
+
+// A writer keeping only the last max bytes written to it.
+type tailWriter struct {
+	max int
+	b   []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	if len(w.b) > w.max {
+		w.b = append(w.b[:0], w.b[len(w.b)-w.max:]...)
+	}
+	return len(p), nil
+}
+
+// Run job J and update its state from the events it reports.
+func (s *Server) run(j *Job) {
+	s.mu.Lock()
+	id, dir := j.Id, s.JobDir(j.Id)
+	args, err := s.command(j)
+	s.mu.Unlock()
+
+	stderr := &tailWriter{max: maxStderr}
+	if err == nil {
+		progress.Logf("Running job %s for %s", id, j.Url)
+		err = s.execute(j, dir, args, stderr)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.procs, id)
+	if s.jobs[id] != j {
+		// Removed while running.
+		os.RemoveAll(dir)
+		return
+	}
+	select {
+	case <-s.done:
+		// Killed by Close, run it again next time.
+		return
+	default:
+	}
+	j.Finished = time.Now()
+	j.State = Done
+	if err != nil {
+		j.State = Failed
+		if j.Error == "" {
+			// The tail may start in the middle of a character.
+			j.Error = strings.TrimSpace(strings.ToValidUTF8(string(stderr.b), ""))
+		}
+		if j.Error == "" {
+			j.Error = err.Error()
+		}
+	} else if len(j.Files) == 0 {
+		j.State = Failed
+		if j.Error == "" {
+			j.Error = "no books were created"
+		}
+	}
+	progress.Logf("Job %s is %s", id, j.State)
+	s.save()
+}
+
+// Run ARGS for job J in a new directory DIR.
+// The standard error of the process is written to STDERR.
+func (s *Server) execute(j *Job, dir string, args []string, stderr io.Writer) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = stderr
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.procs[j.Id] = cmd.Process
+	s.mu.Unlock()
+
+	out := bufio.NewScanner(pipe)
+	out.Buffer(nil, 1<<20)
+	for out.Scan() {
+		s.event(j, dir, out.Bytes())
+	}
+	return cmd.Wait()
+}
+
+// Update job J with the JSON event LINE.
+// DIR is the directory of the job.
+func (s *Server) event(j *Job, dir string, line []byte) {
+	var ev progress.Event
+	if json.Unmarshal(line, &ev) != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch ev.Event {
+	case "book":
+		j.Progress = Progress{Book: ev.Book, Total: ev.Total}
+	case "chapter":
+		j.Progress = Progress{Book: ev.Book, N: ev.N, Total: ev.Total, Bytes: ev.Bytes}
+	case "created", "skipped":
+		if f, err := filepath.Rel(dir, ev.File); err == nil && !strings.HasPrefix(f, "..") {
+			j.Files = append(j.Files, filepath.ToSlash(f))
+		}
+		s.save()
+	case "error":
+		j.Error = ev.Message
+	}
+}
+
+// Return a new random job id.
+func newId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Queue a job to build series URL with OPTS.
+// An error is returned if URL is not an absolute http or https URL, no
+// site handles it or OPTS are invalid.
+func (s *Server) Submit(url string, opts Options) (Job, error) {
+	url = strings.TrimSpace(url)
+	if u, err := nurl.Parse(url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Job{}, fmt.Errorf("not an http or https URL: %s", url)
+	}
+	if _, ok := sites.For(url); !ok {
+		return Job{}, fmt.Errorf("no site handles %s", url)
+	}
+	if v := opts.EpubVersion; v != 0 && v != 2 && v != 3 {
+		return Job{}, fmt.Errorf("epub version should be 2 or 3")
+	}
+	if opts.Format != "" {
+		if err := export.Check(opts.Format); err != nil {
+			return Job{}, err
+		}
+	}
+	if opts.Profile != "" {
+		if _, err := config.ProfileFor(opts.Profile); err != nil {
+			return Job{}, err
+		}
+	}
+	if opts.NameTemplate != "" {
+		if _, err := sites.BookFileName(opts.NameTemplate, sites.Book{Series: "x"}, time.Now()); err != nil {
+			return Job{}, err
+		}
+	}
+
+	j := &Job{
+		Id:      newId(),
+		Url:     url,
+		Options: opts,
+		State:   Queued,
+		Created: time.Now(),
+	}
+	s.mu.Lock()
+	s.jobs[j.Id] = j
+	s.save()
+	c := j.copy()
+	s.mu.Unlock()
+	s.signal()
+	return c, nil
+}
+
+// Return job ID.
+// The second value is false if there is no such job.
+func (s *Server) Job(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.copy(), true
+}
+
+// Return all the jobs, newest first.
+func (s *Server) List() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j.copy())
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Created.After(jobs[k].Created)
+	})
+	return jobs
+}
+
+// Remove job ID and its files.
+// A running job is killed.  The return value is false if there is no
+// such job.
+func (s *Server) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return false
+	}
+	delete(s.jobs, id)
+	if p, ok := s.procs[id]; ok {
+		// run removes the files when the process exits.
+		p.Kill()
+	} else {
+		os.RemoveAll(s.JobDir(id))
+	}
+	s.save()
+	return true
+}
+
+// Remove the jobs that finished more than MaxAge before NOW.
+func (s *Server) Cleanup(now time.Time) {
+	if s.MaxAge <= 0 {
+		return
+	}
+	var old []string
+	s.mu.Lock()
+	for id, j := range s.jobs {
+		if (j.State == Done || j.State == Failed) && now.Sub(j.Finished) > s.MaxAge {
+			old = append(old, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range old {
+		progress.Verbosef("Removing old job %s", id)
+		s.Remove(id)
+	}
+}
+
+func (s *Server) cleaner() {
+	defer s.wg.Done()
+	every := s.MaxAge / 4
+	if every > time.Hour {
+		every = time.Hour
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		s.Cleanup(time.Now())
+		select {
+		case <-t.C:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary stands in for ln2epub when this is set, see
+// fakeLn2epub.
+const fakeEnv = "LN2EPUB_FAKE_SERVE"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeEnv) != "" {
+		fakeLn2epub(os.Args[1:])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// Pretend to be ln2epub -json building a book with two chapters.
+// A series URL with "fail" in it fails, one with "noisy" fails after
+// writing a lot to stderr, and one with "slow" takes a long time.
+func fakeLn2epub(args []string) {
+	dir, format := "", "epub"
+	for i, a := range args {
+		switch a {
+		case "-output-dir":
+			dir = args[i+1]
+		case "-format":
+			format = args[i+1]
+		}
+	}
+	url := args[len(args)-1]
+	ev := func(format string, a ...interface{}) {
+		fmt.Printf(format+"\n", a...)
+	}
+	ev(`{"event":"book","book":"Foo","total":2}`)
+	if strings.Contains(url, "slow") {
+		time.Sleep(time.Minute)
+	}
+	if strings.Contains(url, "noisy") {
+		for i := 0; i < 10000; i++ {
+			fmt.Fprintf(os.Stderr, "warning %d: something is off\n", i)
+		}
+		fmt.Fprintln(os.Stderr, "error: giving up")
+		os.Exit(1)
+	}
+	if strings.Contains(url, "fail") {
+		ev(`{"event":"error","message":"cannot fetch %s"}`, url)
+		os.Exit(1)
+	}
+	ev(`{"event":"chapter","book":"Foo","n":1,"total":2,"bytes":10}`)
+	ev(`{"event":"chapter","book":"Foo","n":2,"total":2,"bytes":20}`)
+	f := filepath.Join(dir, "Foo."+format)
+	os.WriteFile(f, []byte("epub "+strings.Join(args, " ")), 0644)
+	b, _ := json.Marshal(map[string]string{"event": "created", "book": "Foo", "file": f})
+	ev("%s", b)
+}
+
+// Return a started Server in DIR running fakeLn2epub.
+func testServer(t *testing.T, dir string) *Server {
+	t.Helper()
+	t.Setenv(fakeEnv, "1")
+	s, err := NewServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Command = []string{os.Args[0]}
+	s.Jobs = 2
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Wait for job ID to finish and return it.
+func testWait(t *testing.T, s *Server, id string) Job {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		j, ok := s.Job(id)
+		if !ok {
+			t.Fatalf("no job %s", id)
+		}
+		if j.State == Done || j.State == Failed {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestServer(t *testing.T) {
+	s := testServer(t, t.TempDir())
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/jobs", "application/json",
+		strings.NewReader(`{"url": "https://soafp.com/series/foo/", "epub_version": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j Job
+	json.NewDecoder(resp.Body).Decode(&j)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/jobs/"+j.Id {
+		t.Fatalf("got status %s, location %s", resp.Status, resp.Header.Get("Location"))
+	}
+
+	j = testWait(t, s, j.Id)
+	if j.State != Done || len(j.Files) != 1 || j.Files[0] != "Foo.epub" {
+		t.Fatalf("got job %+v", j)
+	}
+	if j.Progress != (Progress{Book: "Foo", N: 2, Total: 2, Bytes: 20}) {
+		t.Errorf("got progress %+v", j.Progress)
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs/" + j.Id + "/files/Foo.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/epub+zip" {
+		t.Errorf("got content type %s", resp.Header.Get("Content-Type"))
+	}
+	for _, arg := range []string{"-json", "-save-cookies=false", "-epub-version 3", "https://soafp.com/series/foo/"} {
+		if !strings.Contains(string(b), arg) {
+			t.Errorf("job was not run with %s: %s", arg, b)
+		}
+	}
+
+	// Only the files created by the job are served.
+	resp, _ = http.Get(ts.URL + "/jobs/" + j.Id + "/files/..%2F..%2Fjobs.json")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %s for a file outside the job", resp.Status)
+	}
+
+	req, _ := http.NewRequest("DELETE", ts.URL+"/jobs/"+j.Id, nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %s for DELETE", resp.Status)
+	}
+	if _, err := os.Stat(s.JobDir(j.Id)); !os.IsNotExist(err) {
+		t.Error("files of the removed job are still there")
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s := testServer(t, t.TempDir())
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, body := range []string{
+		`{"url": "https://example.com/"}`,
+		`{"url": "-record=/tmp/x?soafp.com"}`,
+		`{"url": "soafp.com/series/foo/"}`,
+		`{"url": "https://soafp.com/series/foo/", "epub_version": 4}`,
+		`{"url": "https://soafp.com/series/foo/", "name_template": "{foo}"}`,
+		`{"url": "https://soafp.com/series/foo/", "format": "pdf"}`,
+		`not json`,
+	} {
+		resp, err := http.Post(ts.URL+"/jobs", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var e struct{ Error string }
+		json.NewDecoder(resp.Body).Decode(&e)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || e.Error == "" {
+			t.Errorf("%s: got status %s, error %q", body, resp.Status, e.Error)
+		}
+	}
+
+	// A URL is never taken for a flag.
+	if _, err := s.Submit("-log=/tmp/x#soafp.com", Options{}); err == nil {
+		t.Error("a URL starting with - was accepted")
+	}
+	if args, _ := s.command(&Job{Url: "https://soafp.com/series/foo/"}); args[len(args)-2] != "--" {
+		t.Errorf("got arguments %q", args)
+	}
+
+	j, err := s.Submit("https://soafp.com/series/fail/", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j = testWait(t, s, j.Id)
+	if j.State != Failed || j.Error != "cannot fetch https://soafp.com/series/fail/" {
+		t.Errorf("got job %+v", j)
+	}
+
+	// Only the end of the standard error is kept.
+	j, err = s.Submit("https://soafp.com/series/noisy/", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j = testWait(t, s, j.Id)
+	if j.State != Failed || len(j.Error) > maxStderr || !strings.HasSuffix(j.Error, "warning 9999: something is off\nerror: giving up") {
+		t.Errorf("got state %s and an error of %d bytes", j.State, len(j.Error))
+	}
+}
+
+func TestServerForm(t *testing.T) {
+	s := testServer(t, t.TempDir())
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.PostForm(ts.URL+"/jobs", nurl.Values{
+		"url":          {"https://soafp.com/series/foo/"},
+		"epub_version": {"2"},
+		"format":       {"html"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("got status %s", resp.Status)
+	}
+	jobs := s.List()
+	if len(jobs) != 1 {
+		t.Fatalf("got %d jobs", len(jobs))
+	}
+	testWait(t, s, jobs[0].Id)
+
+	resp, err = http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(b), `href="/jobs/`+jobs[0].Id+`/files/Foo.html"`) {
+		t.Errorf("index has no link to the file:\n%s", b)
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs/" + jobs[0].Id + "/files/Foo.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") ||
+		!strings.Contains(string(b), "-format html") {
+		t.Errorf("got %s of type %s", b, ct)
+	}
+}
+
+// Jobs are kept across restarts, and running jobs are run again.
+func TestServerRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := testServer(t, dir)
+	done, _ := s.Submit("https://soafp.com/series/foo/", Options{})
+	done = testWait(t, s, done.Id)
+	slow, _ := s.Submit("https://soafp.com/series/slow/", Options{})
+	for i := 0; i < 500; i++ {
+		if j, _ := s.Job(slow.Id); j.State == Running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+
+	s, err := NewServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := s.Job(done.Id); j.State != Done || len(j.Files) != 1 {
+		t.Errorf("got finished job %+v", j)
+	}
+	if j, _ := s.Job(slow.Id); j.State != Queued {
+		t.Errorf("got running job %+v", j)
+	}
+}
+
+func TestServerCleanup(t *testing.T) {
+	s := testServer(t, t.TempDir())
+	s.MaxAge = time.Hour
+	j, _ := s.Submit("https://soafp.com/series/foo/", Options{})
+	j = testWait(t, s, j.Id)
+
+	s.Cleanup(j.Finished.Add(time.Minute))
+	if _, ok := s.Job(j.Id); !ok {
+		t.Fatal("new job was removed")
+	}
+	s.Cleanup(j.Finished.Add(2 * time.Hour))
+	if _, ok := s.Job(j.Id); ok {
+		t.Error("old job was kept")
+	}
+	if _, err := os.Stat(s.JobDir(j.Id)); !os.IsNotExist(err) {
+		t.Error("files of the old job are still there")
+	}
+}
@@ -0,0 +1,116 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"strconv"
+	"strings"
+)
+
+// Return the series title for the series soup SUP.
+func AmericanFauxSeriesTitle(sup soup.Root) string {
+	return strings.TrimSpace(
+		sup.Find("h1", "class", "entry-title").Text())
+}
+
+// Return chapter list [ TITLE, URL ] for the series soup SUP.
+func AmericanFauxChapters(sup soup.Root) [][]string {
+	var ret [][]string
+
+	for _, a := range sup.FindAll("a", "data-type", "post") {
+		ret = append(ret, []string{a.Attrs()["href"], a.Text()})
+	}
+
+	return ret
+}
+
+// AmericanFauxRules are the cleanup rules for the chapters: the ads.
+var AmericanFauxRules = []config.Rule{{Drop: "div[id^=waldo-tag]"}}
+
+// Return content for chapter URL with TITLE and chapter no. N.
+func AmericanFauxChapter(url, title string, n int) ([]byte, []epub.File) {
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	ret.WriteString(epub.ContentPreamble(title))
+
+	s := soup.HTMLParse(h)
+	div := s.Find("div", "class", "entry-content")
+	imgCounter := 1
+	for _, c := range div.Children() {
+		if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs, imgCounter, n, extra)
+			ret.WriteString(html)
+		} else if SoupTag(c) == "hr" &&
+			HtmlValueContains("wp-block-separator",
+				c.Attrs()["class"]) {
+			break
+		} else {
+			ret.WriteString(c.HTML())
+		}
+	}
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+// Return the books for the series url URL.
+func AmericanFauxEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	chapters := AmericanFauxChapters(sup)
+	seriesTitle := AmericanFauxSeriesTitle(sup)
+	var files []epub.File
+
+	n := 1
+	progressBook(seriesTitle, "", len(chapters))
+	for _, ch := range chapters {
+		progress.Chapter(n, ch[1], ch[0])
+		content, extra := AmericanFauxChapter(ch[0], ch[1], n)
+		cid := "Chapter" + strconv.Itoa(n+1)
+		files = append(files,
+			epub.File{
+				Title:    ch[1],
+				Id:       cid,
+				Filename: "OEBPS/Text/" + cid + ".xhtml",
+				Mimetype: "application/xhtml+xml",
+				Content:  content,
+			})
+		files = append(files, extra...)
+		n++
+	}
+	return []Book{{
+		Series: seriesTitle,
+		Author: "American Faux",
+		Files:  files,
+	}}
+}
+
+// Return the table of contents for the series url URL.
+func AmericanFauxToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	return Toc{
+		Series:  AmericanFauxSeriesTitle(sup),
+		Volumes: []TocVolume{TocVolumeFrom("", AmericanFauxChapters(sup), 0, 1)},
+	}
+}
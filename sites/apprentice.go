@@ -0,0 +1,128 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Return the series title for the soup SUP.
+func ApprenticeSeriesTitle(sup soup.Root) string {
+	return strings.TrimSpace(
+		sup.Find("h1", "class", "entry-title").Text())
+}
+
+var ApprenticeOldUrlRe = regexp.MustCompile(`https://apprenticetranslations.com/`)
+
+// Return [ URL, TITLE ] for the series soup SUP.
+func ApprenticeChapters(sup soup.Root) [][]string {
+	div := sup.Find("div", "class", "entry-content")
+
+	var ret [][]string
+	for _, a := range div.FindAll("a") {
+		u := a.Attrs()["href"]
+		if strings.Contains(u, "/?share=") || u == "" {
+			continue
+		}
+		u = ApprenticeOldUrlRe.ReplaceAllString(u, "https://apprenticetranslations.wordpress.com/")
+		ret = append(ret, []string{u, strings.TrimSpace(a.Text())})
+	}
+
+	return ret
+}
+
+var ApprenticeChButtonRe = regexp.MustCompile(`(Previous Chapter)?.*(Next Chapter)?`)
+
+// ApprenticeRules are the cleanup rules for the chapters: the chapter
+// ends at the first paragraph with a link to another post, the
+// previous and next chapter links.
+var ApprenticeRules = []config.Rule{
+	{Truncate: `body > p:has(a[href*="//apprenticetranslations.wordpress.com/"]), body > p:has(a[href*="//apprenticetranslations.com/"])`},
+}
+
+// Return contents for chapter url URL with TITLE and chapter no. N.
+func ApprenticeChapter(url, title string, n int) ([]byte, []epub.File) {
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	ret.WriteString(epub.ContentPreamble(title))
+
+	// The links to the other chapters are left to ApprenticeRules.
+	s := soup.HTMLParse(h)
+	div := s.Find("div", "class", "entry-content")
+	imgCounter := 1
+	for _, c := range div.Children() {
+		if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs, imgCounter, n, extra)
+			ret.WriteString(html)
+		} else {
+			ret.WriteString(c.HTML())
+		}
+	}
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+// Return the books for the series url URL.
+func ApprenticeEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	chapters := ApprenticeChapters(sup)
+	seriesTitle := ApprenticeSeriesTitle(sup)
+	var files []epub.File
+
+	n := 1
+	progressBook(seriesTitle, "", len(chapters))
+	for _, ch := range chapters {
+		progress.Chapter(n, ch[1], ch[0])
+		content, extra := ApprenticeChapter(ch[0], ch[1], n)
+		cid := "Chapter" + strconv.Itoa(n)
+		files = append(files,
+			epub.File{
+				Title:    ch[1],
+				Id:       cid,
+				Filename: "OEBPS/Text/" + cid + ".xhtml",
+				Mimetype: "application/xhtml+xml",
+				Content:  content,
+			})
+		files = append(files, extra...)
+		n++
+	}
+	return []Book{{
+		Series: seriesTitle,
+		Author: "Apprentice Translations",
+		Files:  files,
+	}}
+}
+
+// Return the table of contents for the series url URL.
+func ApprenticeToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	return Toc{
+		Series:  ApprenticeSeriesTitle(sup),
+		Volumes: []TocVolume{TocVolumeFrom("", ApprenticeChapters(sup), 0, 1)},
+	}
+}
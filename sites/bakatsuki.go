@@ -0,0 +1,137 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	nurl "net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Return link to all the volumes in URL URL.
+// Returned is a list of [ TITLE, LINK ] where TITLE is the title of
+// the volume, and LINK is the link to the volume full text.
+func BakatsukiVolumes(url string) [][]string {
+	var ret [][]string
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	soup := soup.HTMLParse(h)
+
+	for _, i := range soup.FindAll("span", "class", "mw-headline") {
+		if a := i.Find("a"); a.Pointer != nil && a.Text() == "Full Text" {
+			ret = append(ret,
+				[]string{
+					// -2 to remove " (" from the end.
+					i.Text()[:len(i.Text())-2],
+					"https://www.baka-tsuki.org" + i.Find("a").Attrs()["href"],
+				})
+		}
+	}
+	return ret
+}
+
+// Return the EpubFiles for volume with URL URL.
+// TODO: It would be nice to have working TL note links.
+func BakatsukiPrepVol(url string) []epub.File {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	soup := soup.HTMLParse(h)
+
+	var files []epub.File
+
+	spans := soup.FindAll("h2")
+	chi := 1
+	for sn, h2 := range spans {
+		var chapter bytes.Buffer
+
+		i := h2.Find("span", "class", "mw-headline")
+		if i.Pointer == nil {
+			continue
+		}
+		chid := "Chapter" + strconv.Itoa(chi)
+		imgCounter := 1
+
+		chapter.WriteString(epub.ContentPreamble(i.Text()))
+		chapter.WriteString("<h1>")
+		chapter.WriteString(i.Text())
+		chapter.WriteString("</h1>\n")
+
+		for s := h2.FindNextSibling(); s.Pointer != nil &&
+			s.Pointer.Data != "h2"; s = s.FindNextSibling() {
+			if sn == len(spans)-1 && s.Pointer.Data == "table" {
+				break
+			}
+			str := s.HTML()
+			if edit := s.Find("span", "class", "mw-editsection"); edit.Pointer != nil {
+				str = strings.ReplaceAll(str, edit.HTML(), "")
+			}
+			str, imgCounter, files = ReplaceImgTags(str, s.FindAll("img"),
+				imgCounter, chi, files)
+			chapter.WriteString(str)
+		}
+
+		chapter.WriteString(epub.ContentEnd())
+		files = append(files,
+			epub.File{
+				Title:    i.Text(),
+				Content:  chapter.Bytes(),
+				Filename: "OEBPS/Text/" + chid + ".xhtml",
+				Mimetype: "application/xhtml+xml",
+				Id:       chid,
+			})
+		chi += 1
+		chapter.Reset()
+	}
+
+	return files
+}
+
+// Return the books for each volume in series URL URL.
+func BakatsukiEpubFiles(url string) []Book {
+	var ret []Book
+	vols := BakatsukiVolumes(url)
+	series := BakatsukiSeriesTitle(url)
+
+	for _, vol := range vols {
+		progressBook(series, vol[0], 1)
+		progress.Chapter(1, vol[0], vol[1])
+		ret = append(ret, Book{
+			Series: series,
+			Volume: vol[0],
+			Author: "Baka-Tsuki TL",
+			Files:  BakatsukiPrepVol(vol[1]),
+		})
+	}
+
+	return ret
+}
+
+// Return the table of contents for series URL URL.
+// The chapters of a volume are all in the same page, so each volume
+// is listed with a single entry for its full text.
+func BakatsukiToc(url string) Toc {
+	toc := Toc{Series: BakatsukiSeriesTitle(url)}
+	for _, vol := range BakatsukiVolumes(url) {
+		toc.Volumes = append(toc.Volumes,
+			TocVolumeFrom(vol[0], [][]string{{vol[1], "Full Text"}}, 0, 1))
+	}
+	return toc
+}
+
+// Return the series title for series URL URL.
+// This is the page title in the URL, e.g., Hyouka in
+// https://www.baka-tsuki.org/project/index.php?title=Hyouka
+func BakatsukiSeriesTitle(url string) string {
+	if u, err := nurl.Parse(url); err == nil && u.Query().Get("title") != "" {
+		return strings.ReplaceAll(u.Query().Get("title"), "_", " ")
+	}
+	return path.Base(strings.TrimSuffix(url, "/"))
+}
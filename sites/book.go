@@ -0,0 +1,303 @@
+package sites
+
+import (
+	"fmt"
+	"github.com/9viz/ln2epub/cleanup"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/progress"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Book is a single epub file made from a series.
+type Book struct {
+	// Site is the name of the site the series is from.
+	Site string
+
+	// Series is the title of the series.
+	Series string
+
+	// Volume is the title of the volume, or "" if the series is not
+	// split into volumes.
+	Volume string
+
+	// Author of the book.
+	Author string
+
+	// Language is the language code of the book, "en" if empty.
+	Language string
+
+	// Url of the series.
+	Url string
+
+	// Offset is the number of chapters in the books of the series
+	// before this one.
+	Offset int
+
+	// Files are the content files of the book.  The mandatory epub
+	// files are added by BookEpubFiles.
+	Files []epub.File
+}
+
+// Return the title of book B.
+func (b Book) Title() string {
+	if b.Volume == "" {
+		return b.Series
+	}
+	return b.Series + " - " + b.Volume
+}
+
+// Return the number of chapters in book B.
+// The cover page is not counted as a chapter.
+func (b Book) Chapters() int {
+	n := 0
+	for _, f := range b.Files {
+		if f.Mimetype == "application/xhtml+xml" && f.Id != "cover" {
+			n++
+		}
+	}
+	return n
+}
+
+// Return the unique identifier of book B.
+// This is derived from the series URL and the volume, so rebuilding
+// the book gives the same identifier.
+func (b Book) Identifier() string {
+	if b.Volume == "" {
+		return epub.Uuid(b.Url)
+	}
+	return epub.Uuid(b.Url + "#" + b.Volume)
+}
+
+// Return the metadata of book B built on DATE.
+func BookMetadata(b Book, date time.Time) epub.Metadata {
+	return epub.Metadata{
+		Author:     b.Author,
+		Identifier: b.Identifier(),
+		Title:      b.Title(),
+		Date:       date,
+		Language:   b.Language,
+		Version:    config.Config.EpubVersion,
+		Series:     b.Series,
+		Source:     b.Url,
+	}
+}
+
+// Return the files of the epub file for book B built on DATE.
+func BookEpubFiles(b Book, date time.Time) []epub.File {
+	return epub.AddExtra(BookMetadata(b, date), b.Files)
+}
+
+// Return the date of the build.
+// This is DATE, a date like 2006-01-02 or a time like
+// 2006-01-02T15:04:05Z07:00, if not empty, then SOURCE_DATE_EPOCH if
+// set, so that the same series can be built into byte-identical epub
+// files.  Otherwise, it is the current time.
+func BuildDate(date string) (time.Time, error) {
+	if date != "" {
+		for _, layout := range []string{"2006-01-02", time.RFC3339} {
+			if t, err := time.Parse(layout, date); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid date %q, should be like 2006-01-02 or 2006-01-02T15:04:05Z", date)
+	}
+	if e := os.Getenv("SOURCE_DATE_EPOCH"); e != "" {
+		sec, err := strconv.ParseInt(e, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q, should be seconds since 1970", e)
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Now().UTC().Truncate(time.Second), nil
+}
+
+var bookNameFieldRe = regexp.MustCompile(`\{[a-z]+\}`)
+
+// Characters that are not allowed, or are troublesome, in filenames.
+// A slash is replaced by a division slash like the Baka-Tsuki
+// volume names used to be.
+var bookNameReplacer = strings.NewReplacer(
+	"/", "∕", "\\", "_", ":", "_", "*", "_", "?", "_",
+	"\"", "_", "<", "_", ">", "_", "|", "_")
+
+// Return S made safe for use as a path component.
+func bookSanitiseName(s string) string {
+	s = bookNameReplacer.Replace(s)
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimRight(strings.TrimSpace(s), ". ")
+	// Leave some room for the collision suffix.
+	for len(s) > 240 {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s
+}
+
+// Return the fields of book B for use in a filename template.
+// DATE is the date of the build.  {first} and {last} number the
+// chapters of B in the whole series.
+func BookNameFields(b Book, date time.Time) map[string]string {
+	first, last := "0", "0"
+	n := b.Chapters()
+	if n > 0 {
+		first, last = strconv.Itoa(b.Offset+1), strconv.Itoa(b.Offset+n)
+	}
+	return map[string]string{
+		"site":     b.Site,
+		"series":   b.Series,
+		"volume":   b.Volume,
+		"title":    b.Title(),
+		"author":   b.Author,
+		"first":    first,
+		"last":     last,
+		"chapters": strconv.Itoa(n),
+		"date":     date.Format("2006-01-02"),
+	}
+}
+
+// Return the filename for book B according to TEMPLATE.
+// TEMPLATE is a slash-separated path where each {FIELD} is replaced
+// by the value of FIELD.  The available fields are given by
+// BookNameFields.  Each field value is sanitised so that it always
+// ends up in a single path component.  An error is returned if
+// TEMPLATE has an unknown field.
+func BookFileName(template string, b Book, date time.Time) (string, error) {
+	fields := BookNameFields(b, date)
+	var err error
+	name := bookNameFieldRe.ReplaceAllStringFunc(template, func(f string) string {
+		v, ok := fields[f[1:len(f)-1]]
+		if !ok {
+			err = fmt.Errorf("unknown field %s in name template", f)
+		}
+		return bookSanitiseName(v)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		if p = bookSanitiseName(p); p != "" && p != ".." {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("name template %q gives an empty filename", template)
+	}
+	return filepath.Join(parts...), nil
+}
+
+// Policies for when the output file already exists.
+const (
+	BookOverwrite = "overwrite"
+	BookSkip      = "skip"
+	BookRename    = "rename"
+)
+
+// Return the filename to use for FILENAME according to the collision
+// policy POLICY.
+// An empty string is returned if the file should not be written.
+// With BookRename, a number is added before the extension,
+// e.g., "foo (2).epub".
+func BookResolveCollision(filename, policy string) (string, error) {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return filename, nil
+	}
+	switch policy {
+	case BookOverwrite:
+		return filename, nil
+	case BookSkip:
+		return "", nil
+	case BookRename:
+		ext := path.Ext(filename)
+		base := strings.TrimSuffix(filename, ext)
+		for n := 2; ; n++ {
+			f := fmt.Sprintf("%s (%d)%s", base, n, ext)
+			if _, err := os.Stat(f); os.IsNotExist(err) {
+				return f, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown collision policy %q", policy)
+}
+
+// Set the author and language of book B from the configuration.
+// The series settings take precedence over the site settings.
+func applyConfig(b *Book) {
+	site := config.Config.Sites[b.Site]
+	series := config.Config.Series[b.Url]
+	for _, a := range []string{site.Author, series.Author} {
+		if a != "" {
+			b.Author = a
+		}
+	}
+	for _, l := range []string{site.Language, series.Language} {
+		if l != "" {
+			b.Language = l
+		}
+	}
+}
+
+// Return the filenames of the images the content FILES refer to.
+func bookImages(files []epub.File) map[string]bool {
+	images := make(map[string]bool)
+	for _, f := range files {
+		if f.Mimetype != "application/xhtml+xml" {
+			continue
+		}
+		for _, name := range epub.ImageRefs(f) {
+			images[name] = true
+		}
+	}
+	return images
+}
+
+// Apply the cleanup RULES to the chapters of book B.  The images only
+// the removed elements referred to are removed too.
+func cleanBook(b *Book, rules []cleanup.Rule) {
+	if len(rules) == 0 {
+		return
+	}
+	before := bookImages(b.Files)
+	for i, f := range b.Files {
+		if f.Mimetype == "application/xhtml+xml" {
+			b.Files[i].Content = cleanup.Clean(f.Content, rules)
+		}
+	}
+	after := bookImages(b.Files)
+	files := b.Files[:0]
+	for _, f := range b.Files {
+		if !before[f.Filename] || after[f.Filename] {
+			files = append(files, f)
+		}
+	}
+	b.Files = files
+}
+
+// Apply cleanup.Typography to the chapters of book B.
+func typesetBook(b *Book) {
+	for i, f := range b.Files {
+		if f.Mimetype == "application/xhtml+xml" {
+			b.Files[i].Content = cleanup.Typography(f.Content, b.Language)
+		}
+	}
+}
+
+// Start reporting the progress of book VOLUME of SERIES with TOTAL
+// chapters.
+func progressBook(series, volume string, total int) {
+	progress.Book(Book{Series: series, Volume: volume}.Title(), total)
+}
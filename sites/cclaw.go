@@ -0,0 +1,188 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var CClawTitleRe = regexp.MustCompile(` ToC - CClaw Translations`)
+
+// Return the title for the series soup SUP.
+func CClawSeriesTitle(sup soup.Root) string {
+	if h1 := sup.Find("h1", "class", "entry-title"); h1.Pointer != nil {
+		return strings.TrimSuffix(strings.TrimSpace(h1.Text()), " ToC")
+	} else {
+		return CClawTitleRe.ReplaceAllString(
+			strings.TrimSpace(sup.Find("title").Text()),
+			"")
+	}
+}
+
+// Return the cover URL for <img> with attrs A.
+func CClawcoverurl(a map[string]string) string {
+	if u, ok := a["data-large-file"]; ok {
+		return u
+	} else {
+		return a["src"]
+	}
+}
+
+// Return [ URL, TITLE ] for single volume TOC soup SUP.
+func CClawsingleVol(sup soup.Root) [][]string {
+	var ret [][]string
+	div := sup.Find("div", "class", "entry-content")
+
+	if img := div.Find("img"); img.Pointer != nil {
+		ret = append(ret, []string{CClawcoverurl(img.Attrs()), "cover"})
+	}
+
+	for _, a := range div.FindAll("a") {
+		if t := strings.TrimSpace(a.Text()); t != "" {
+			ret = append(ret, []string{a.Attrs()["href"], t})
+		}
+	}
+
+	return ret
+}
+
+// Return volumes with links [ URL, TITLE ] for series TOC soup SUP.
+// If the series is not split into volumes, the only volume has an
+// empty title.
+func CClawVolumes(sup soup.Root) []Volume {
+	var ret []Volume
+
+	div := sup.Find("div", "class", "entry-content")
+	if div.Find("h2").Pointer == nil {
+		return append(ret, Volume{"", CClawsingleVol(sup)})
+	}
+
+	imgs := div.FindAll("img")
+	for i, h2 := range div.FindAll("h2") {
+		chs := [][]string{[]string{CClawcoverurl(imgs[i].Attrs()), "cover"}}
+		var vol string
+		vol = strings.TrimSuffix(strings.TrimSpace(h2.Text()), " (Final)")
+		for c := h2.FindNextSibling(); c.Pointer != nil && SoupTag(c) != "h2"; c = c.FindNextSibling() {
+			if a := c.Find("a"); a.Pointer != nil && a.Text() != "" {
+				chs = append(chs, []string{a.Attrs()["href"], a.Text()})
+			}
+		}
+		ret = append(ret, Volume{vol, chs})
+	}
+	return ret
+}
+
+// CClawRules are the cleanup rules for the chapters: the chapter ends
+// at the ads.
+var CClawRules = []config.Rule{
+	{Truncate: "body > span[id~=wordads-inline-marker], body > div[id^=atatags-]"},
+}
+
+// Return content for chapter URL with TITLE and chapter no. N.
+func CClawChapter(url, title string, n int) ([]byte, []epub.File) {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	h2 := sup.Find("h2", "class", "wp-block-heading")
+	if h2.Pointer != nil && strings.TrimSpace(h2.Text()) != title {
+		title = title + ": " + strings.TrimSpace(h2.Text())
+	}
+
+	ret.WriteString(epub.ContentPreamble(title))
+	imgCounter := 1
+	do := func(c soup.Root) {
+		if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs, imgCounter, n, extra)
+			ret.WriteString(html)
+		} else {
+			ret.WriteString(c.HTML())
+		}
+	}
+	// The ads at the end are left to CClawRules.
+	if h2.Pointer != nil {
+		for c := h2; c.Pointer != nil; c = c.FindNextSibling() {
+			do(c)
+		}
+	} else {
+		for _, c := range sup.Find("div", "class", "entry-content").Children() {
+			do(c)
+		}
+	}
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+// Return the books for the series TOC page URL URL.
+func CClawEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+	seriesTitle := CClawSeriesTitle(sup)
+
+	var ret []Book
+	vols := CClawVolumes(sup)
+	for _, vol := range vols {
+		v, c := vol.Title, vol.Links
+		var files []epub.File
+		n := 1
+		progressBook(seriesTitle, v, len(c))
+		for i, ch := range c {
+			progress.Chapter(i+1, ch[1], ch[0])
+			if ch[1] == "cover" {
+				files = AddCoverImage(ch[0], files)
+				continue
+			}
+			content, extra := CClawChapter(ch[0], ch[1], n)
+			cid := "Chapter" + strconv.Itoa(n)
+			files = append(files,
+				epub.File{
+					Title:    ch[1],
+					Id:       cid,
+					Filename: "OEBPS/Text/" + cid + ".xhtml",
+					Mimetype: "application/xhtml+xml",
+					Content:  content,
+				})
+			files = append(files, extra...)
+			n++
+		}
+		ret = append(ret, Book{
+			Series: seriesTitle,
+			Volume: v,
+			Author: "CClaw Translations",
+			Files:  files,
+		})
+	}
+	return ret
+}
+
+// Return the table of contents for the series TOC page URL URL.
+func CClawToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	toc := Toc{Series: CClawSeriesTitle(sup)}
+	for _, v := range CClawVolumes(sup) {
+		toc.Volumes = append(toc.Volumes, TocVolumeFrom(v.Title, v.Links, 0, 1))
+	}
+	return toc
+}
@@ -0,0 +1,113 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/anaskhan96/soup"
+	"strings"
+)
+
+// From https://github.com/anaskhan96/soup/issues/63.
+func SoupFindParent(r soup.Root, tagName string) soup.Root {
+	parent := r.Pointer.Parent
+	if parent == nil {
+		return soup.Root{Pointer: parent}
+	}
+	rParent := soup.Root{Pointer: parent, NodeValue: parent.Data}
+	if strings.ToLower(parent.Data) == strings.ToLower(tagName) {
+		return rParent
+	}
+	return SoupFindParent(rParent, tagName)
+}
+
+// Fetch images in IMGS and replace HTML with local `src' value.
+// IMGCOUNTER is the number of image in this chapter, N is the chapter
+// number, and ADDTO is the list to add epub.File struct of the fetched
+// image to.
+// New value of HTML, IMGCOUNTER, ADDTO are returned.
+func ReplaceImgTags(html string, imgs []soup.Root, imgCounter, n int, addto []epub.File) (string, int, []epub.File) {
+	if len(imgs) == 0 {
+		return html, imgCounter, addto
+	}
+	var imgBuf strings.Builder
+
+	for _, img := range imgs {
+		ifile, ic := fetch.ImageCached(img.Attrs()["src"], n, imgCounter)
+		// New image.
+		if ic != imgCounter {
+			addto = append(addto, ifile)
+			imgCounter = ic
+		}
+		imgBuf.WriteString("<img src='../")
+		imgBuf.WriteString(epub.StripOebpsPrefix(ifile.Filename))
+		imgBuf.WriteString("' ")
+		for _, a := range []string{"width", "alt", "height"} {
+			if at, ok := img.Attrs()[a]; ok {
+				imgBuf.WriteString(a)
+				imgBuf.WriteString("='")
+				imgBuf.WriteString(at)
+				imgBuf.WriteString("' ")
+			}
+		}
+		imgBuf.WriteString("/>")
+
+		html = strings.ReplaceAll(html,
+			img.HTML(),
+			imgBuf.String())
+		imgBuf.Reset()
+	}
+
+	return html, imgCounter, addto
+}
+
+// Fetch and add cover with URL URL to FILES.
+func AddCoverImage(url string, files []epub.File) []epub.File {
+	cover, mimetype := fetch.Cover(url)
+	c := epub.File{
+		Id:       "cover-image",
+		Filename: "OEBPS/Images/cover",
+		Mimetype: mimetype,
+		Content:  cover}
+	files = append(files, c)
+	fetch.ImageCache[url] = c
+
+	var cfile bytes.Buffer
+	cfile.WriteString(epub.ContentPreamble("cover"))
+	cfile.WriteString("<img src='../Images/cover' />")
+	cfile.WriteString(epub.ContentEnd())
+
+	files = append(files,
+		epub.File{
+			Title:    "Cover",
+			Id:       "cover",
+			Filename: "OEBPS/Text/Cover.xhtml",
+			Mimetype: "application/xhtml+xml",
+			Content:  cfile.Bytes(),
+		})
+	return files
+}
+
+// Return the tag name of S or "" if nil.
+func SoupTag(s soup.Root) string {
+	if s.Pointer != nil {
+		return s.Pointer.Data
+	} else {
+		return ""
+	}
+}
+
+// Return true if attribute VALUE contains STR.
+func HtmlValueContains(str, value string) bool {
+	if strings.Contains(value, " ") {
+		vs := strings.Split(value, " ")
+		for _, v := range vs {
+			if v == str {
+				return true
+			}
+		}
+	} else {
+		return value == str
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"regexp"
+	"strconv"
+)
+
+// Site: http://hermitranslation.blogspot.com/p/index.html
+var FianceChapterRe = regexp.MustCompile(`chapter-?[0-9]+(_[0-9]+)?\.html$`)
+
+// Default series title, the "title" site option overrides it.
+var FianceSeriesTitle = "My fiancé is in love with my little sister"
+
+func FianceChapters(url string) [][]string {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	var ret [][]string
+	n := 1
+	for _, a := range sup.Find("div", "class", "post").FindAll("a") {
+		u := a.Attrs()["href"]
+		if FianceChapterRe.MatchString(u) {
+			ret = append(ret,
+				[]string{u, "Chapter " + strconv.Itoa(n)})
+			n++
+		}
+	}
+
+	return ret
+}
+
+// Return contents for chapter url URL with TITLE and chapter no. N.
+func FianceChapter(url, title string, n int) ([]byte, []epub.File) {
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	ret.WriteString(epub.ContentPreamble(title))
+
+	s := soup.HTMLParse(h)
+	div := s.Find("div", "class", "post-body")
+	imgCounter := 1
+	for _, c := range div.Children() {
+		if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs, imgCounter, n, extra)
+			ret.WriteString(html)
+		} else {
+			ret.WriteString(c.HTML())
+		}
+	}
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+// Return the books for the series url URL.
+func FianceEpubFiles(url string) []Book {
+	chapters := FianceChapters(url)
+	seriesTitle := config.SiteOption("fiance", "title", FianceSeriesTitle)
+	var files []epub.File
+
+	n := 1
+	progressBook(seriesTitle, "", len(chapters))
+	for _, ch := range chapters {
+		progress.Chapter(n, ch[1], ch[0])
+		content, extra := FianceChapter(ch[0], ch[1], n)
+		cid := "Chapter" + strconv.Itoa(n+1)
+		files = append(files,
+			epub.File{
+				Title:    ch[1],
+				Id:       cid,
+				Filename: "OEBPS/Text/" + cid + ".xhtml",
+				Mimetype: "application/xhtml+xml",
+				Content:  content,
+			})
+		files = append(files, extra...)
+		n++
+	}
+	return []Book{{
+		Series: seriesTitle,
+		Author: "Nocta's Hermit Den",
+		Files:  files,
+	}}
+}
+
+// Return the table of contents for the series url URL.
+func FianceToc(url string) Toc {
+	return Toc{
+		Series:  config.SiteOption("fiance", "title", FianceSeriesTitle),
+		Volumes: []TocVolume{TocVolumeFrom("", FianceChapters(url), 0, 1)},
+	}
+}
@@ -0,0 +1,148 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"strconv"
+	"strings"
+)
+
+// Return list of chapter names in volume soup SUP.
+// A list of [ NAME, CURL ] where NAME is chapter name with URL CURL.
+// The cover link is returned with NAME being "cover"
+func KequeenChapters(sup soup.Root) [][]string {
+	var chs [][]string
+
+	for _, img := range sup.Find("main", "id", "main").FindAll("img") {
+		if href := img.Attrs()["src"]; strings.Contains(href, "cover") ||
+			strings.Contains(href, "Cover") {
+			chs = append(chs, []string{"cover", href})
+			break
+		}
+	}
+
+	for _, a := range sup.Find("main", "id", "main").FindAll("a") {
+		chs = append(chs, []string{a.FullText(), a.Attrs()["href"]})
+	}
+
+	return chs
+}
+
+// Return chapter content, and extra files for chapter URL URL.
+// Chapter name is given by CHAPTERNAME, and chapter no. by N.
+func KequeenChapter(url, chaptername string, n int) ([]byte, []epub.File) {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	sup := soup.HTMLParse(h)
+	div := sup.Find("div", "class", "entry-content").FindAll("div", "class", "elementor-widget-container")
+
+	var content bytes.Buffer
+	var extra []epub.File
+	// var imgBuf strings.Builder
+
+	content.WriteString(epub.ContentPreamble(chaptername))
+	content.WriteString("<h1>")
+	content.WriteString(chaptername)
+	content.WriteString("</h1>\n")
+
+	firsth2skipped := false
+	imgCounter := 1
+
+	for _, i := range div {
+		if h2 := i.Find("h2", "class", "elementor-heading-title"); h2.Pointer != nil &&
+			!firsth2skipped {
+			firsth2skipped = true
+			continue
+		}
+		if spacer := i.Find("div", "class", "elementor-spacer-inner"); spacer.Pointer != nil &&
+			len(spacer.Children()) == 0 {
+			continue
+		}
+		for _, c := range i.Children() {
+			if c.Pointer.Data == "style" {
+				continue
+			}
+			html := c.HTML()
+			if c.Pointer.Data == "img" {
+				html, imgCounter, extra = ReplaceImgTags(
+					html, []soup.Root{c},
+					imgCounter, n, extra)
+			}
+			content.WriteString(html)
+			content.WriteString("\n")
+		}
+	}
+	content.WriteString(epub.ContentEnd())
+
+	return content.Bytes(), extra
+}
+
+// Return the page title for volume/series with soup SUP.
+func KequeenSeriesTitle(sup soup.Root) string {
+	title := sup.Find("head").Find("title")
+	if title.Pointer == nil {
+		return "***UNKNOWN***"
+	}
+	s := title.FullText()
+	return strings.TrimSuffix(s, " – KequeenTLS")
+}
+
+// Return the books for the series with URL URL.
+func KequeenEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	chapters := KequeenChapters(sup)
+	seriesTitle := KequeenSeriesTitle(sup)
+
+	var files []epub.File
+	n := 1
+	progressBook(seriesTitle, "", len(chapters))
+	for i, ch := range chapters {
+		progress.Chapter(i+1, ch[0], ch[1])
+		if ch[0] == "cover" {
+			files = AddCoverImage(ch[1], files)
+			continue
+		}
+		content, extra := KequeenChapter(ch[1], ch[0], n+1)
+		cid := "Chapter" + strconv.Itoa(n+1)
+		files = append(files,
+			epub.File{
+				Title:    ch[0],
+				Id:       cid,
+				Filename: "OEBPS/Text/" + cid + ".xhtml",
+				Mimetype: "application/xhtml+xml",
+				Content:  content,
+			})
+		files = append(files, extra...)
+		n++
+	}
+	return []Book{{
+		Series: seriesTitle,
+		Author: "KequeenTLS",
+		Files:  files,
+	}}
+}
+
+// Return the table of contents for the series with URL URL.
+func KequeenToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	return Toc{
+		Series:  KequeenSeriesTitle(sup),
+		Volumes: []TocVolume{TocVolumeFrom("", KequeenChapters(sup), 1, 0)},
+	}
+}
@@ -0,0 +1,154 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	nurl "net/url"
+	"strconv"
+	"strings"
+)
+
+var NeoSekaiAjaxUrl string = "https://www.neosekaitranslations.com/wp-admin/admin-ajax.php"
+
+// Return the series title for the series soup SUP.
+func NeoSekaiSeriesTitle(sup soup.Root) string {
+	if div := sup.Find("div", "class", "post-title"); div.Pointer != nil {
+		return strings.TrimSpace(div.Find("h1").Text())
+	}
+
+	return strings.TrimSuffix(
+		strings.TrimSpace(sup.Find("title").Text()),
+		"- NeoSekai Translations")
+
+}
+
+// Return a list of [ URL, CHAPTERNAME ] for the series soup SUP.
+// The chapters are fetched from the "ajax_url" site option, which is
+// NeoSekaiAjaxUrl by default.
+func NeoSekaiChapters(sup soup.Root) [][]string {
+	id := sup.Find("div", "id", "manga-chapters-holder").Attrs()["data-id"]
+
+	pdata := nurl.Values{}
+	pdata.Set("action", "manga_get_chapters")
+	pdata.Add("manga", id)
+
+	req, err := fetch.PostForm(config.SiteOption("neosekai", "ajax_url", NeoSekaiAjaxUrl), pdata)
+	if err != nil {
+		return [][]string{}
+	}
+
+	sup = soup.HTMLParse(req)
+	var ret [][]string
+	for _, li := range sup.FindAll("li", "class", "wp-manga-chapter") {
+		a := li.Find("a")
+		ret = append([][]string{
+			[]string{
+				a.Attrs()["href"],
+				strings.TrimSpace(a.Text()),
+			}}, ret...)
+	}
+
+	return ret
+}
+
+// Return contents for chapter URL, title CHAPTERTITLE, and chapter no. N.
+func NeoSekaiChapter(url, chapterTitle string, n int) ([]byte, []epub.File) {
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	ret.WriteString(epub.ContentPreamble(chapterTitle))
+
+	s := soup.HTMLParse(h)
+	div := s.Find("div", "class", "reading-content")
+	imgCounter := 1
+	for _, c := range div.Children() {
+		if SoupTag(c) == "input" {
+			continue
+		} else if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs, imgCounter, n, extra)
+			ret.WriteString(html)
+		} else {
+			ret.WriteString(c.HTML())
+		}
+	}
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+// Return the cover image url for the series soup SUP.
+func NeoSekaiCoverUrl(sup soup.Root) string {
+	if div := sup.Find("div", "class", "summary_image"); SoupTag(div) != "" {
+		return div.Find("img").Attrs()["data-src"]
+	}
+	return ""
+}
+
+// Return the books for the series url URL.
+func NeoSekaiEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	chapters := NeoSekaiChapters(sup)
+	seriesTitle := NeoSekaiSeriesTitle(sup)
+	var files []epub.File
+
+	cover := NeoSekaiCoverUrl(sup)
+	progressBook(seriesTitle, "", len(chapters))
+	if cover != "" {
+		progress.Verbosef("Fetching cover image %s", cover)
+		files = AddCoverImage(cover, files)
+	}
+
+	n := 1
+	for _, ch := range chapters {
+		progress.Chapter(n, ch[1], ch[0])
+		content, extra := NeoSekaiChapter(ch[0], ch[1], n)
+		cid := "Chapter" + strconv.Itoa(n+1)
+		files = append(files,
+			epub.File{
+				Title:    ch[1],
+				Id:       cid,
+				Filename: "OEBPS/Text/" + cid + ".xhtml",
+				Mimetype: "application/xhtml+xml",
+				Content:  content,
+			})
+		files = append(files, extra...)
+		n++
+	}
+	return []Book{{
+		Series: seriesTitle,
+		Author: "NeoSekai Translations",
+		Files:  files,
+	}}
+}
+
+// Return the table of contents for the series url URL.
+func NeoSekaiToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	vol := TocVolumeFrom("", NeoSekaiChapters(sup), 0, 1)
+	vol.Cover = NeoSekaiCoverUrl(sup)
+	return Toc{
+		Series:  NeoSekaiSeriesTitle(sup),
+		Volumes: []TocVolume{vol},
+	}
+}
@@ -0,0 +1,241 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Get the author of the series with TOC page soup SP.
+func ShalvationAuthor(sp soup.Root) string {
+	// The first <string> tag is for the author.
+	strong := sp.Find("div", "class", "entry-content").Find("strong")
+	// Needs to be HTML().  Text() and FullText() both return an
+	// empty string.
+	return strong.FindNextSibling().HTML()
+}
+
+// Return the cover image URL of the series with TOC page soup SP.
+func ShalvationCoverImg(sp soup.Root) string {
+	return sp.Find("div", "class", "entry-content").Find("img").Attrs()["src"]
+}
+
+// Return the synposis HTML for the series with TOC page soup SP.
+// An empty string is returned if there is none.
+func ShalvationSynopsis(sp soup.Root) string {
+	var h strings.Builder
+	synp := sp.Find("div", "class", "entry-content").Find("h4")
+	// First check if it is a synposis heading.
+	if strings.ToLower(strings.TrimSpace(synp.Text())) == "synposis" {
+		return ""
+	}
+
+	h.WriteString(synp.HTML())
+	// The synposis lasts till a <hr> tag.
+	for s := synp.FindNextSibling(); s.Pointer != nil &&
+		s.Pointer.Data != "hr"; s = s.FindNextSibling() {
+		h.WriteString(s.HTML())
+	}
+
+	return h.String()
+}
+
+func ShalvationendOfVol(s soup.Root) bool {
+	return s.Pointer.Data == "div" &&
+		strings.HasPrefix(s.Attrs()["id"], "atatags-")
+}
+
+func ShalvationvolLinks(sp soup.Root) [][]string {
+	var links [][]string
+
+	for s := sp.FindNextSibling(); s.Pointer != nil &&
+		s.Pointer.Data != "hr" && !ShalvationendOfVol(s); s = s.FindNextSibling() {
+		if a := s.Find("a"); a.Pointer != nil {
+			if strings.Contains(a.Attrs()["href"], "drive.google.com") {
+				continue
+			}
+			links = append(links, []string{a.FullText(), a.Attrs()["href"]})
+		} else if img := s.Find("img"); img.Pointer != nil {
+			links = append(links, []string{"cover", img.Attrs()["src"]})
+		}
+	}
+	if len(links) == 1 {
+		return nil
+	}
+	return links
+}
+
+// Return links for each chapter in every volume for TOC page soup SP.
+// The links of each volume are a list of [ CHAPTERNAME, CHAPTERURL ].
+func ShalvationVols(sp soup.Root) []Volume {
+	var vols []Volume
+	div := sp.Find("div", "class", "entry-content")
+
+	for _, h4 := range div.FindAll("h4") {
+		if strings.ToLower(h4.Text()) == "synposis" {
+			continue
+		}
+		vol := ShalvationvolLinks(h4)
+		if vol == nil {
+			continue
+		}
+		vols = append(vols, Volume{h4.Text(), vol})
+	}
+
+	return vols
+}
+
+var ShalvationChapterNoRe = regexp.MustCompile(`Chapter [0-9]+ – `)
+
+func ShalvationstripChapterNo(chaptername string) string {
+	return ShalvationChapterNoRe.ReplaceAllString(chaptername, "")
+}
+
+// ShalvationRules are the cleanup rules for the chapters: the read more
+// anchor and the translator credits.
+var ShalvationRules = []config.Rule{
+	{Drop: `p:has(span[id^=more-]), p:has(span[style^="color:#4c4c48;"])`},
+}
+
+// Return content for chapter URL with CHAPTERNAME, chapter no. N.
+// If the chapter has images, then it is returned as the second
+// argument.
+func ShalvationChapter(url, chaptername string, n int) ([]byte, []epub.File) {
+	var content bytes.Buffer
+	var extra []epub.File
+
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	chaptername = ShalvationstripChapterNo(chaptername)
+	content.WriteString(epub.ContentPreamble(chaptername))
+
+	sp := soup.HTMLParse(h)
+	div := sp.Find("div", "class", "entry-content")
+	firstHrSkipped := false
+	imgCounter := 1
+	for _, c := range div.Children() {
+		if c.Pointer.Data == "hr" && !firstHrSkipped {
+			firstHrSkipped = true
+		} else if c.Pointer.Data == "h4" &&
+			strings.Contains(c.Text(), chaptername) {
+			content.WriteString("<h1>")
+			content.WriteString(chaptername)
+			content.WriteString("</h1>\n")
+		} else if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs,
+				imgCounter, n,
+				extra)
+			content.WriteString(html)
+		} else if a := c.Find("a"); a.Pointer != nil &&
+			(strings.Contains(a.Text(), " CHAPTER") ||
+				strings.Contains(a.Text(), "VOLUME")) {
+			// TODO: Condition to break the chapters is
+			// extremely adhoc, need to fix it.
+			break
+		} else {
+			content.WriteString(c.HTML())
+		}
+	}
+
+	content.WriteString(epub.ContentEnd())
+
+	return content.Bytes(), extra
+}
+
+func ShalvationprepVol(links [][]string) []epub.File {
+	var files []epub.File
+	n := 1
+	for i, l := range links {
+		progress.Chapter(i+1, l[0], l[1])
+		switch l[0] {
+		case "cover":
+			files = AddCoverImage(l[1], files)
+		case "Illustrations":
+			f, e := ShalvationChapter(l[1], "Illustrations", -1)
+			files = append(files, e...)
+			files = append(files,
+				epub.File{
+					Title:    "Illustrations",
+					Id:       "illustrations",
+					Filename: "OEBPS/Text/Illustrations.xhtml",
+					Mimetype: "application/xhtml+xml",
+					Content:  f,
+				})
+		default:
+			cid := "Chapter" + strconv.Itoa(n)
+			f, e := ShalvationChapter(l[1], l[0], n)
+			files = append(files, e...)
+			files = append(files,
+				epub.File{
+					Title:    l[0],
+					Id:       cid,
+					Filename: "OEBPS/Text/" + cid + ".xhtml",
+					Mimetype: "application/xhtml+xml",
+					Content:  f,
+				})
+			n += 1
+		}
+	}
+	return files
+}
+
+var ShalvationtitleRe = regexp.MustCompile(` Table[\s\p{Zs}][oO]f[\s\p{Zs}]Contents$`)
+
+// Return the title for the series TOC soup SP.
+func ShalvationTitle(sp soup.Root) string {
+	title := sp.Find("h1", "class", "entry-title")
+	return ShalvationtitleRe.ReplaceAllString(title.Text(), "")
+}
+
+// Return the books for series TOC URL.
+func ShalvationEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	var ret []Book
+
+	sp := soup.HTMLParse(h)
+	vols := ShalvationVols(sp)
+	author := ShalvationAuthor(sp)
+	title := ShalvationTitle(sp)
+
+	for _, vol := range vols {
+		progressBook(title, vol.Title, len(vol.Links))
+		ret = append(ret, Book{
+			Series: title,
+			Volume: vol.Title,
+			Author: author,
+			Files:  ShalvationprepVol(vol.Links),
+		})
+	}
+	return ret
+}
+
+// Return the table of contents for series TOC URL.
+func ShalvationToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	sp := soup.HTMLParse(h)
+	toc := Toc{Series: ShalvationTitle(sp)}
+	for _, vol := range ShalvationVols(sp) {
+		toc.Volumes = append(toc.Volumes,
+			TocVolumeFrom(vol.Title, vol.Links, 1, 0))
+	}
+	return toc
+}
@@ -0,0 +1,138 @@
+// Licensed under BSD 2-Clause License.
+
+// Package sites has the adapters for the supported TL sites, which
+// scrape a series into books.
+package sites
+
+import (
+	"fmt"
+	"github.com/9viz/ln2epub/cleanup"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"strings"
+)
+
+// Site is a supported TL site.
+type Site struct {
+	// Name of the site.
+	Name string
+
+	// Match is a substring of the series URLs handled by the site.
+	Match string
+
+	// Books returns the books for the series URL.
+	Books func(url string) []Book
+
+	// Toc returns the table of contents for the series URL.
+	// This should not fetch any chapter page or image.
+	Toc func(url string) Toc
+}
+
+// All is the supported sites.
+var All = []Site{
+	{"soafp", "soafp.com", SoafpEpubFiles, SoafpToc},
+	{"shalvation", "shalvationtranslations.wordpress.com", ShalvationEpubFiles, ShalvationToc},
+	{"baka-tsuki", "baka-tsuki.org", BakatsukiEpubFiles, BakatsukiToc},
+	{"travis", "travistranslations.com/novel/", TravisEpubFiles, TravisToc},
+	{"kequeen", "kequeentls.com", KequeenEpubFiles, KequeenToc},
+	{"neosekai", "neosekaitranslations.com", NeoSekaiEpubFiles, NeoSekaiToc},
+	{"americanfaux", "americanfaux.com", AmericanFauxEpubFiles, AmericanFauxToc},
+	{"fiance", "hermitranslation.blogspot.com", FianceEpubFiles, FianceToc},
+	{"apprentice", "apprenticetranslations.wordpress.com", ApprenticeEpubFiles, ApprenticeToc},
+	{"violet-evergarden", "violet-evergarden-novel-index", VioletEvergardenEpubFiles, VioletEvergardenToc},
+	{"cclaw", "cclawtranslations.home.blog/", CClawEpubFiles, CClawToc},
+	{"storyseedling", "storyseedling.com", StorySeedlingEpubFiles, StorySeedlingToc},
+	{"skythewood", "skythewood.blogspot.com", SkythewoodEpubFiles, SkythewoodToc},
+}
+
+// Rules are the cleanup rules for the chapters from each site, keyed
+// by Site.Name.  They are applied before the configured ones, see
+// config.RulesFor.
+var Rules = map[string][]config.Rule{
+	"soafp":        SoafpRules,
+	"shalvation":   ShalvationRules,
+	"americanfaux": AmericanFauxRules,
+	"cclaw":        CClawRules,
+	"apprentice":   ApprenticeRules,
+}
+
+// Return the site handling series URL.
+// The second value is false if no site handles URL.
+func For(url string) (Site, bool) {
+	for _, s := range All {
+		if strings.Contains(url, s.Match) {
+			return s, true
+		}
+	}
+	return Site{}, false
+}
+
+// Turn a panic in the adapter for SITE into an error stored in ERR.
+// Adapters panic when a page is not what they expect.
+func recoverAdapter(site string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%s: %v", site, r)
+	}
+}
+
+// Return the books for the series URL.
+// If config.Config.Concurrency is more than one, the chapters listed
+// in the table of contents are fetched in parallel beforehand.
+func Books(url string) (books []Book, err error) {
+	site, ok := For(url)
+	if !ok {
+		return nil, fmt.Errorf("no site handles %s", url)
+	}
+	configRules, err := config.RulesFor(url)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := cleanup.CompileAll(append(append([]config.Rule(nil), Rules[site.Name]...), configRules...))
+	if err != nil {
+		return nil, fmt.Errorf("cleanup: %v", err)
+	}
+	defer recoverAdapter(site.Name, &err)
+	defer fetch.WpUsePassword(config.Config.Series[url].Password)()
+	if config.Config.Concurrency > 1 {
+		fetch.PageCacheEnable(true)
+		defer fetch.PageCacheEnable(false)
+		var urls []string
+		for _, vol := range site.Toc(url).Volumes {
+			for _, ch := range vol.Chapters {
+				urls = append(urls, ch.Url)
+			}
+		}
+		progress.Verbosef("Prefetching %d chapters", len(urls))
+		fetch.Prefetch(urls, config.Config.Concurrency)
+	}
+
+	books = site.Books(url)
+	offset := 0
+	for i := range books {
+		books[i].Site = site.Name
+		books[i].Url = url
+		books[i].Offset = offset
+		offset += books[i].Chapters()
+		applyConfig(&books[i])
+		cleanBook(&books[i], rules)
+		if config.Config.Typography {
+			typesetBook(&books[i])
+		}
+	}
+	return books, nil
+}
+
+// Return the table of contents for the series URL.
+func TableOfContents(url string) (toc Toc, err error) {
+	site, ok := For(url)
+	if !ok {
+		return Toc{}, fmt.Errorf("no site handles %s", url)
+	}
+	defer recoverAdapter(site.Name, &err)
+	defer fetch.WpUsePassword(config.Config.Series[url].Password)()
+	toc = site.Toc(url)
+	toc.Site = site.Name
+	toc.Url = url
+	return toc, nil
+}
@@ -0,0 +1,361 @@
+package sites
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"net/http"
+	"net/http/httptest"
+	nurl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Run `go test -update' to regenerate the golden files after changing
+// a site adapter, and review the changes with `git diff testdata'.
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// Series URL of the recorded fixtures for each site.
+// The pages are in testdata/SITE/pages, see fixtureFile.
+var fixtureSeries = map[string]string{
+	"soafp":             "https://soafp.com/series/the-villainess-reverses-the-hourglass/",
+	"shalvation":        "https://shalvationtranslations.wordpress.com/the-vampire-princess-table-of-contents/",
+	"baka-tsuki":        "https://www.baka-tsuki.org/project/index.php?title=Hyouka",
+	"travis":            "https://travistranslations.com/novel/the-saints-reluctant-journey/",
+	"kequeen":           "https://kequeentls.com/the-dukes-contract-bride-volume-1/",
+	"neosekai":          "https://www.neosekaitranslations.com/novel/the-maid-of-the-tower/",
+	"americanfaux":      "https://americanfaux.com/the-tutorial-floor/",
+	"fiance":            "http://hermitranslation.blogspot.com/p/index.html",
+	"apprentice":        "https://apprenticetranslations.wordpress.com/the-archmages-apprentice/",
+	"violet-evergarden": "https://dennou-translations.tumblr.com/post/159331691639/violet-evergarden-novel-index",
+	"cclaw":             "https://cclawtranslations.home.blog/the-wandering-sage-toc/",
+	"storyseedling":     "https://storyseedling.com/series/48213/",
+	"skythewood":        "https://skythewood.blogspot.com/p/the-knight-of-the-ashen-rose.html",
+}
+
+// Build date used for the golden files.
+var fixtureDate = time.Date(2023, time.January, 18, 0, 0, 0, 0, time.UTC)
+
+// Return the fixture file in DIR for the request path and query of U.
+// The path is HOST/PATH, with "index.html" for a trailing slash and
+// the query escaped after "@".
+func fixtureFile(dir string, u *nurl.URL) string {
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if u.RawQuery != "" {
+		name += "@" + nurl.QueryEscape(u.RawQuery)
+	}
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+// Return true if the path of U is an image.
+func fixtureIsImage(u *nurl.URL) bool {
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// Serve the fixture pages in DIR.
+// Images are not recorded, testdata/image.png is served for all of
+// them.
+func fixtureServer(t *testing.T, dir string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := fixtureFile(dir, r.URL)
+		if fixtureIsImage(r.URL) {
+			name = filepath.Join("testdata", "image.png")
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Errorf("no fixture for %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}))
+}
+
+// fixtureTransport sends every request to the fixture server, with
+// the original host as the first path element.
+type fixtureTransport struct {
+	server *httptest.Server
+}
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := nurl.Parse(f.server.URL)
+	r := req.Clone(req.Context())
+	r.URL.Scheme = u.Scheme
+	r.URL.Host = u.Host
+	r.URL.Path = "/" + req.URL.Host + req.URL.Path
+	r.URL.RawPath = ""
+	r.Host = u.Host
+	return f.server.Client().Transport.RoundTrip(r)
+}
+
+// Set up the global state to fetch from the fixtures in DIR.
+// The returned function restores it.
+func fixtureSetup(t *testing.T, dir string) func() {
+	server := fixtureServer(t, dir)
+	conf, transport, level := config.Config, fetch.Client.Transport, progress.Default.Level
+
+	config.Config.IgnoreRobots = true
+	config.Config.Rate = 0
+	config.Config.Delay = 0
+	config.Config.Concurrency = 1
+	fetch.Client.Transport = fixtureTransport{server}
+	progress.Default.Level = progress.Quiet
+	fetch.ImageCache = make(map[string]epub.File)
+
+	return func() {
+		config.Config, fetch.Client.Transport, progress.Default.Level = conf, transport, level
+		server.Close()
+	}
+}
+
+// Compare GOT with the golden file NAME, or update it with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(name)
+	if err != nil {
+		t.Errorf("%v, run with -update to create it", err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file, run with -update and review the diff\n%s",
+			name, goldenDiff(got, want))
+	}
+}
+
+// Return the first line that differs between GOT and WANT.
+func goldenDiff(got, want []byte) string {
+	g := strings.Split(string(got), "\n")
+	w := strings.Split(string(want), "\n")
+	for i := 0; i < len(g) || i < len(w); i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl {
+			return fmt.Sprintf("line %d:\n got: %q\nwant: %q", i+1, gl, wl)
+		}
+	}
+	return ""
+}
+
+// Return the golden files for book B in the golden directory DIR.
+// These are a manifest of all the files, and the contents of the files
+// that are not images.
+func goldenBook(dir string, b Book) map[string][]byte {
+	ret := make(map[string][]byte)
+	var manifest bytes.Buffer
+	fmt.Fprintf(&manifest, "site: %s\nseries: %s\nvolume: %s\nauthor: %s\nidentifier: %s\n\n",
+		b.Site, b.Series, b.Volume, b.Author, b.Identifier())
+	for _, f := range BookEpubFiles(b, fixtureDate) {
+		fmt.Fprintf(&manifest, "%s\t%s\t%s\t%q\n", f.Filename, f.Id, f.Mimetype, f.Title)
+		if !strings.HasPrefix(f.Mimetype, "image/") {
+			ret[filepath.Join(dir, filepath.FromSlash(f.Filename))] = f.Content
+		}
+	}
+	ret[filepath.Join(dir, "files.txt")] = manifest.Bytes()
+	return ret
+}
+
+func TestSitesHaveFixtures(t *testing.T) {
+	for _, s := range All {
+		u, ok := fixtureSeries[s.Name]
+		if !ok {
+			t.Errorf("site %s has no fixtures", s.Name)
+			continue
+		}
+		if site, _ := For(u); site.Name != s.Name {
+			t.Errorf("fixture series %s for %s is handled by %q", u, s.Name, site.Name)
+		}
+	}
+}
+
+func TestSites(t *testing.T) {
+	for _, s := range All {
+		s := s
+		u, ok := fixtureSeries[s.Name]
+		if !ok {
+			continue
+		}
+		t.Run(s.Name, func(t *testing.T) {
+			dir := filepath.Join("testdata", s.Name)
+			defer fixtureSetup(t, filepath.Join(dir, "pages"))()
+
+			toc, err := TableOfContents(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			j, err := json.MarshalIndent(toc, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, filepath.Join(dir, "golden", "toc.json"), append(j, '\n'))
+
+			books, err := Books(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(books) == 0 {
+				t.Fatal("no books")
+			}
+			for i, b := range books {
+				bdir := filepath.Join(dir, "golden", fmt.Sprintf("book%d", i+1))
+				for name, content := range goldenBook(bdir, b) {
+					golden(t, name, content)
+				}
+			}
+		})
+	}
+}
+
+// Record a build from the fixtures, and check that replaying the
+// archive gives the same book.
+func TestRecordReplay(t *testing.T) {
+	// NeoSekai also makes a POST request for the chapters.
+	u := fixtureSeries["neosekai"]
+	defer fixtureSetup(t, filepath.Join("testdata", "neosekai", "pages"))()
+	defer func() { fetch.Recorder = nil }()
+
+	fetch.RecordStart(true)
+	recorded, err := Books(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "neosekai.har")
+	if err := fetch.Recorder.Save(archive); err != nil {
+		t.Fatal(err)
+	}
+
+	fetch.ImageCache = make(map[string]epub.File)
+	if err := fetch.ReplayStart(archive); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := Books(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorded) != len(replayed) {
+		t.Fatalf("got %d books, want %d", len(replayed), len(recorded))
+	}
+	for i := range recorded {
+		want := BookEpubFiles(recorded[i], fixtureDate)
+		got := BookEpubFiles(replayed[i], fixtureDate)
+		if len(got) != len(want) {
+			t.Fatalf("got %d files, want %d", len(got), len(want))
+		}
+		for j := range want {
+			if got[j].Filename != want[j].Filename {
+				t.Errorf("got file %s, want %s", got[j].Filename, want[j].Filename)
+			} else if strings.HasPrefix(want[j].Mimetype, "image/") {
+				if !bytes.Equal(got[j].Content, fetch.RecordPlaceholder) {
+					t.Errorf("%s is not a placeholder", got[j].Filename)
+				}
+			} else if !bytes.Equal(got[j].Content, want[j].Content) {
+				t.Errorf("%s differs when replayed\n%s", got[j].Filename,
+					goldenDiff(got[j].Content, want[j].Content))
+			}
+		}
+	}
+}
+
+// Check that the configured cleanup rules are applied, and that the
+// images only the removed elements referred to are left out.
+func TestCleanup(t *testing.T) {
+	u := fixtureSeries["americanfaux"]
+	defer fixtureSetup(t, filepath.Join("testdata", "americanfaux", "pages"))()
+	config.Config.Series = map[string]config.Series{
+		u: {Rules: []config.Rule{{Drop: "figure"}, {DropText: "goblin"}}},
+	}
+
+	books, err := Books(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range books[0].Files {
+		if strings.HasPrefix(f.Mimetype, "image/") {
+			t.Errorf("image %s was not removed", f.Filename)
+		}
+		if bytes.Contains(f.Content, []byte("goblin")) || bytes.Contains(f.Content, []byte("waldo-tag")) {
+			t.Errorf("%s was not cleaned\n%s", f.Filename, f.Content)
+		}
+	}
+
+	config.Config.Series[u] = config.Series{Rules: []config.Rule{{Drop: "div p"}}}
+	if _, err := Books(u); err == nil || !strings.Contains(err.Error(), "cleanup") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestBuildDate(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	for _, c := range []struct {
+		date string
+		want time.Time
+	}{
+		{"", time.Unix(1700000000, 0).UTC()},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-05-01T12:00:00+02:00", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+	} {
+		if got, err := BuildDate(c.date); err != nil || !got.Equal(c.want) {
+			t.Errorf("%q: got %v, %v", c.date, got, err)
+		}
+	}
+	if _, err := BuildDate("May 1"); err == nil {
+		t.Error("no error for an invalid date")
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := BuildDate(""); err == nil {
+		t.Error("no error for an invalid SOURCE_DATE_EPOCH")
+	}
+}
+
+// Check that {first} and {last} number the chapters in the series.
+func TestBookFileName(t *testing.T) {
+	u := fixtureSeries["cclaw"]
+	defer fixtureSetup(t, filepath.Join("testdata", "cclaw", "pages"))()
+	books, err := Books(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 {
+		t.Fatalf("got %d books", len(books))
+	}
+	n1, n2 := books[0].Chapters(), books[1].Chapters()
+	for i, want := range []string{
+		fmt.Sprintf("%s [1-%d] %d", books[0].Volume, n1, n1),
+		fmt.Sprintf("%s [%d-%d] %d", books[1].Volume, n1+1, n1+n2, n2),
+	} {
+		got, err := BookFileName("{volume} [{first}-{last}] {chapters}", books[i], fixtureDate)
+		if err != nil || got != want {
+			t.Errorf("got %q, %v, want %q", got, err, want)
+		}
+	}
+}
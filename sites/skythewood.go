@@ -0,0 +1,150 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"strconv"
+	"strings"
+)
+
+// Return list of [ URL, CHNAME ] for each vol in TOC soup SUP.
+func SkythewoodVolumes(sup soup.Root) []Volume {
+	div := sup.Find("div", "class", "columns-inner")
+
+	var ret []Volume
+	for _, i := range div.FindAll("b") {
+		if !strings.HasPrefix(i.FullText(), "Volume") {
+			continue
+		}
+		par := SoupFindParent(i, "div")
+		ret = append(ret, Volume{
+			strings.TrimSpace(i.FullText()),
+			Skythewoodvolume(par)})
+	}
+	return ret
+}
+
+func Skythewoodvolume(parent soup.Root) [][]string {
+	var ret [][]string
+	for c := parent.FindNextSibling(); c.Pointer != nil &&
+		(strings.TrimSpace(c.FullText()) == "" ||
+			c.Find("a").Pointer != nil) &&
+		c.Find("img").Pointer == nil; c = c.FindNextSibling() {
+		for _, a := range c.FindAll("a") {
+			ret = append(ret, []string{a.Attrs()["href"], strings.TrimSpace(a.FullText())})
+		}
+	}
+
+	var img string
+	for c := parent.FindPrevSibling(); c.Pointer != nil &&
+		(strings.TrimSpace(c.FullText()) == "" ||
+			c.Find("img").Pointer != nil); c = c.FindPrevSibling() {
+		if c.Find("img").Pointer == nil {
+			continue
+		}
+		img = c.Find("a").Attrs()["href"]
+	}
+	if img == "" {
+		return ret
+	}
+
+	return append([][]string{{img, "cover"}}, ret...)
+}
+
+// Return contents for chapter url URL with TITLE and chapter no. N.
+func SkythewoodChapter(url, title string, n int) ([]byte, []epub.File) {
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	ret.WriteString(epub.ContentPreamble(title))
+
+	s := soup.HTMLParse(h)
+	div := s.Find("div", "class", "post-body")
+	imgCounter := 1
+	for _, c := range div.Children() {
+		if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs, imgCounter, n, extra)
+			ret.WriteString(html)
+		} else {
+			ret.WriteString(c.HTML())
+		}
+	}
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+func SkythewoodSeriesTitle(sup soup.Root) string {
+	return strings.TrimSpace(
+		sup.Find("h3", "class", "post-title").FullText())
+}
+
+// Return the books for the series TOC page URL URL.
+func SkythewoodEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+	seriesTitle := SkythewoodSeriesTitle(sup)
+
+	var ret []Book
+	vols := SkythewoodVolumes(sup)
+	for _, vol := range vols {
+		v, c := vol.Title, vol.Links
+		var files []epub.File
+		n := 1
+		progressBook(seriesTitle, v, len(c))
+		for i, ch := range c {
+			progress.Chapter(i+1, ch[1], ch[0])
+			if ch[1] == "cover" {
+				files = AddCoverImage(ch[0], files)
+				continue
+			}
+			content, extra := SkythewoodChapter(ch[0], ch[1], n)
+			cid := "Chapter" + strconv.Itoa(n)
+			files = append(files,
+				epub.File{
+					Title:    ch[1],
+					Id:       cid,
+					Filename: "OEBPS/Text/" + cid + ".xhtml",
+					Mimetype: "application/xhtml+xml",
+					Content:  content,
+				})
+			files = append(files, extra...)
+			n++
+		}
+		ret = append(ret, Book{
+			Series: seriesTitle,
+			Volume: v,
+			Author: "Skythewood Translations",
+			Files:  files,
+		})
+	}
+	return ret
+}
+
+// Return the table of contents for the series TOC page URL URL.
+func SkythewoodToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	toc := Toc{Series: SkythewoodSeriesTitle(sup)}
+	for _, v := range SkythewoodVolumes(sup) {
+		toc.Volumes = append(toc.Volumes, TocVolumeFrom(v.Title, v.Links, 0, 1))
+	}
+	return toc
+}
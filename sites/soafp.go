@@ -0,0 +1,182 @@
+package sites
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/9viz/ln2epub/config"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"regexp"
+	"strconv"
+)
+
+// TODO: Get description of the series and cover image.
+
+var SoapcleanChNameRe = regexp.MustCompile(`([[:space:]]+:[[:space:]]+)`)
+
+// Return the series title with URL URL.
+func SoafpSeriesTitle(url string) string {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	s := soup.HTMLParse(h)
+	return s.Find("h1", "class", "entry-title").Text()
+}
+
+// Normalise CHAPTERNAME to not contain punctuation mistakes.
+func SoafpcleanChapterName(chaptername string) string {
+	return SoapcleanChNameRe.ReplaceAllString(chaptername, ": ")
+}
+
+// Return a list of [ URL, CHAPTERNAME ] for the series in URL.
+func SoafpChapters(url string) [][]string {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	var chapters [][]string
+
+	s := soup.HTMLParse(h)
+	as := s.Find("ul", "class", "lcp_catlist").FindAll("a")
+
+	for _, a := range as {
+		chapters = append(chapters, []string{
+			a.Attrs()["href"],
+			SoafpcleanChapterName(a.Text()),
+		})
+	}
+
+	return chapters
+}
+
+func SoafpisEnd(value string) bool {
+	return HtmlValueContains("wp-block-buttons", value) ||
+		HtmlValueContains("sd-like", value) ||
+		HtmlValueContains("daddy", value)
+}
+
+func SoafpisImg(value string) bool {
+	return HtmlValueContains("wp-block-image", value)
+}
+
+// SoafpRules are the cleanup rules for the chapters: the ads and the
+// font size buttons.
+var SoafpRules = []config.Rule{{Drop: "div.code-block, div.pre-bar"}}
+
+var SoafpchapterNoPrefix = regexp.MustCompile(`[Cc]hapter [0-9]+: `)
+
+// Return CHAPTERNAME without the initial chapter numbering.
+func SoafpstripChapterNo(chaptername string) string {
+	return SoafpchapterNoPrefix.ReplaceAllString(chaptername, "")
+}
+
+// Return content for chapter URL with CHAPTERNAME, chapter no. N.
+// If the chapter has extra files, then it is returned as the second
+// argument.
+// TODO: Replace all images like in the rest.
+func SoafpChapter(url, chaptername string, n int) ([]byte, []epub.File) {
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	// Write the preamble.
+	ret.WriteString(epub.ContentPreamble(SoafpstripChapterNo(chaptername)))
+	ret.WriteString("\n<h1>")
+	ret.WriteString(chaptername)
+	ret.WriteString("</h1>")
+
+	s := soup.HTMLParse(h)
+	divChildren := s.Find("div", "class", "entry-content").Children()
+
+	// We want to end when we encounter a <div> tag with approriate
+	// class, the ads are left to SoafpRules.
+	ret.WriteString("<div class='entry-content'>\n")
+	imgCounter := 0
+	for _, c := range divChildren {
+		if c.Pointer.Data == "div" && SoafpisEnd(c.Attrs()["class"]) {
+			break
+		}
+
+		if c.Pointer.Data == "div" && SoafpisImg(c.Attrs()["class"]) {
+			imgAttrs := c.Find("img").Attrs()
+			ifile, ic := fetch.ImageCached(imgAttrs["href"], n, imgCounter)
+			// New image.
+			if ic != imgCounter {
+				imgCounter = ic
+				extra = append(extra, ifile)
+			}
+			imgFileName := epub.StripOebpsPrefix(ifile.Filename)
+
+			ret.WriteString("<img src='../")
+			ret.WriteString(imgFileName)
+			ret.WriteString("' ")
+			for _, a := range []string{"width", "height", "alt"} {
+				if w, ok := imgAttrs[a]; ok {
+					ret.WriteString(fmt.Sprintf("%s='%s' ", a, w))
+				}
+			}
+			ret.WriteString("/>\n")
+
+			continue
+		}
+
+		ht := c.HTML()
+
+		// if sps := c.FindAll("span", "class", "has-inline-color"); sps != nil {
+		// 	for _, sp := range sps {
+		// 		ht = strings.ReplaceAll(ht, sp.HTML(), "")
+		// 	}
+		// }
+
+		ret.WriteString(ht)
+	}
+	ret.WriteString("</div>")
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+// Return the books for the series in URL.
+func SoafpEpubFiles(url string) []Book {
+	var files []epub.File
+	chs := SoafpChapters(url)
+	title := SoafpSeriesTitle(url)
+
+	progressBook(title, "", len(chs))
+	for n, ch := range chs {
+		progress.Chapter(n+1, ch[1], ch[0])
+		content, extra := SoafpChapter(ch[0], ch[1], n)
+		files = append(
+			files,
+			epub.File{
+				Title:    ch[1],
+				Id:       "Chapter" + strconv.Itoa(n+1),
+				Content:  content,
+				Filename: "OEBPS/Text/Chapter" + strconv.Itoa(n+1) + ".xhtml",
+				Mimetype: "application/xhtml+xml",
+			})
+		files = append(files, extra...)
+	}
+
+	return []Book{{
+		Series: title,
+		Files:  files,
+	}}
+}
+
+// Return the table of contents for the series in URL.
+func SoafpToc(url string) Toc {
+	return Toc{
+		Series:  SoafpSeriesTitle(url),
+		Volumes: []TocVolume{TocVolumeFrom("", SoafpChapters(url), 0, 1)},
+	}
+}
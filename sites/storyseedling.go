@@ -0,0 +1,163 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var StorySeedlingVolNoRe = regexp.MustCompile(`Vol\. ([0-9]+) `)
+
+func StorySeedlingVolNo(title string) string {
+	m := StorySeedlingVolNoRe.FindStringSubmatch(title)
+	if m == nil {
+		return "unknown"
+	}
+	return "Volume " + m[1]
+}
+
+var StorySeedlingChNameRe = regexp.MustCompile(`(?:Vol\. [0-9]+ )?Chapter [0-9.]+ - (.*)`)
+
+func StorySeedlingChName(title string) string {
+	m := StorySeedlingChNameRe.FindStringSubmatch(title)
+	if m == nil {
+		return "unknown"
+	}
+	return m[1]
+}
+
+func StorySeedlingSeriesTitle(sup soup.Root) string {
+	return strings.TrimSpace(sup.Find("h1").Text())
+}
+
+// Return volumes with links [ URL, CHAPTERNAME ] for TOC soup SUP
+// with URL.
+// The TOC lists the latest chapter first, so both the volumes and the
+// chapters are reversed.
+func StorySeedlingVolumes(url string, sup soup.Root) []Volume {
+	var ret []Volume
+	idx := make(map[string]int)
+
+	vol := ""
+
+	for _, a := range sup.FindAll("a") {
+		href := a.Attrs()["href"]
+		if !strings.HasPrefix(href, url) {
+			continue
+		}
+		text := a.Find("div", "class", "truncate")
+		if text.Pointer == nil {
+			continue
+		}
+		t := strings.TrimSpace(text.Text())
+		if strings.HasPrefix(t, "Vol.") {
+			vol = StorySeedlingVolNo(t)
+		}
+		ch := StorySeedlingChName(t)
+		i, ok := idx[vol]
+		if !ok {
+			i = len(ret)
+			idx[vol] = i
+			ret = append(ret, Volume{Title: vol})
+		}
+		ret[i].Links = append([][]string{{href, ch}}, ret[i].Links...)
+	}
+
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
+
+// Return content for chapter URL with TITLE and chapter no. N.
+func StorySeedlingChapter(url, title string, n int) ([]byte, []epub.File) {
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	ret.WriteString(epub.ContentPreamble(title))
+
+	s := soup.HTMLParse(h)
+	div := SoupFindParent(s.Find("h1"), "div")
+	imgCounter := 1
+	for _, c := range div.Children() {
+		if SoupTag(c) == "h1" {
+			continue
+		} else if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs, imgCounter, n, extra)
+			ret.WriteString(html)
+		} else {
+			ret.WriteString(c.HTML())
+		}
+	}
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+// Return the books for the series TOC page URL URL.
+func StorySeedlingEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+	seriesTitle := StorySeedlingSeriesTitle(sup)
+
+	var ret []Book
+	vols := StorySeedlingVolumes(url, sup)
+	for _, vol := range vols {
+		v, c := vol.Title, vol.Links
+		var files []epub.File
+		n := 1
+		progressBook(seriesTitle, v, len(c))
+		for i, ch := range c {
+			progress.Chapter(i+1, ch[1], ch[0])
+			content, extra := StorySeedlingChapter(ch[0], ch[1], n)
+			cid := "Chapter" + strconv.Itoa(n)
+			files = append(files,
+				epub.File{
+					Title:    ch[1],
+					Id:       cid,
+					Filename: "OEBPS/Text/" + cid + ".xhtml",
+					Mimetype: "application/xhtml+xml",
+					Content:  content,
+				})
+			files = append(files, extra...)
+			n++
+		}
+		ret = append(ret, Book{
+			Series: seriesTitle,
+			Volume: v,
+			Author: "Story Seedling",
+			Files:  files,
+		})
+	}
+	return ret
+}
+
+// Return the table of contents for the series TOC page URL URL.
+func StorySeedlingToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	toc := Toc{Series: StorySeedlingSeriesTitle(sup)}
+	for _, v := range StorySeedlingVolumes(url, sup) {
+		toc.Volumes = append(toc.Volumes, TocVolumeFrom(v.Title, v.Links, 0, 1))
+	}
+	return toc
+}
@@ -0,0 +1,16 @@
+<div class="page-content-listing single-page">
+<div class="listing-chapters_wrap cols-1 show-more">
+<ul class="main version-chap no-volumn">
+<li class="wp-manga-chapter    ">
+<a href="https://www.neosekaitranslations.com/novel/the-maid-of-the-tower/volume-1-chapter-2/">
+Volume 1 Chapter 2 - The Lady Upstairs </a>
+<span class="chapter-release-date"><i>September 20, 2021</i></span>
+</li>
+<li class="wp-manga-chapter    ">
+<a href="https://www.neosekaitranslations.com/novel/the-maid-of-the-tower/volume-1-chapter-1/">
+Volume 1 Chapter 1 - Hired </a>
+<span class="chapter-release-date"><i>September 12, 2021</i></span>
+</li>
+</ul>
+</div>
+</div>
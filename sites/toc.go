@@ -0,0 +1,49 @@
+package sites
+
+// TocChapter is a chapter listed in the table of contents of a series.
+type TocChapter struct {
+	Title string `json:"title"`
+	Url   string `json:"url"`
+}
+
+// TocVolume is a volume listed in the table of contents of a series.
+// Series that are not split into volumes have a single volume with an
+// empty Title.
+type TocVolume struct {
+	Title    string       `json:"title,omitempty"`
+	Cover    string       `json:"cover,omitempty"`
+	Chapters []TocChapter `json:"chapters"`
+}
+
+// Toc is the table of contents of a series as found by the site
+// adapter without fetching any of the chapters.
+type Toc struct {
+	Site    string      `json:"site"`
+	Series  string      `json:"series"`
+	Url     string      `json:"url"`
+	Volumes []TocVolume `json:"volumes"`
+}
+
+// Return a TocVolume with TITLE for LINKS.
+// U and T are the index of the URL and the title in each link
+// respectively.  A link whose title is "cover" is taken as the URL of
+// the cover image.
+func TocVolumeFrom(title string, links [][]string, u, t int) TocVolume {
+	vol := TocVolume{Title: title, Chapters: []TocChapter{}}
+	for _, l := range links {
+		if l[t] == "cover" {
+			vol.Cover = l[u]
+			continue
+		}
+		vol.Chapters = append(vol.Chapters,
+			TocChapter{Title: l[t], Url: l[u]})
+	}
+	return vol
+}
+
+// Volume is a volume of a series in the order found in the TOC page.
+// Links are in whatever format the site uses.
+type Volume struct {
+	Title string
+	Links [][]string
+}
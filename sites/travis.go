@@ -0,0 +1,146 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"strconv"
+	"strings"
+)
+
+// Fetch chapter links from series soup SUP.
+// A list of [ CHAPTER-NAME, URL ] is returned.
+func TravisChapters(sup soup.Root) [][]string {
+	var div soup.Root
+	// For some reason sup.Find() does not work!
+	for _, div = range sup.FindAll("div") {
+		if div.Attrs()["x-show"] == "tab === 'toc'" {
+			break
+		}
+	}
+
+	var chapter [][]string
+	for _, li := range div.Find("ul").Children() {
+		if li.Pointer.Data != "li" {
+			continue
+		}
+		a := li.Find("a")
+		if a.Pointer == nil {
+			continue
+		}
+		chapter = append(chapter,
+			[]string{
+				a.Find("span").FullText(),
+				a.Attrs()["href"]})
+	}
+
+	return chapter
+}
+
+// Return content for URL with name CHAPTERNAME, chapter no. N.
+// If any extra files are to be attached, then it is returned as the
+// second item.
+func TravisChapter(url, chaptername string, n int) ([]byte, []epub.File) {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+
+	var content bytes.Buffer
+	var extra []epub.File
+	content.WriteString(epub.ContentPreamble(chaptername))
+
+	sup := soup.HTMLParse(h)
+	div := sup.Find("div", "class", "reader-content").Find("p")
+	start := false
+	imgCounter := 1
+	for p := div; p.Pointer != nil; p = p.FindNextSibling() {
+		if p.Pointer.Data == "p" &&
+			strings.HasPrefix(p.FullText(), "Edited by") {
+			start = true
+			p = p.FindNextSibling() // Skip <hr/>
+		}
+		if p.Pointer.Data == "p" &&
+			p.Attrs()["style"] == "text-align: center;" &&
+			strings.HasPrefix(p.FullText(), "Chapter ") {
+			content.WriteString("<h1>")
+			content.WriteString(p.FullText())
+			content.WriteString("</h1>\n")
+		}
+		if p.Pointer.Data == "hr" {
+			next := p.FindNextSibling().FindNextSibling()
+			if next.Pointer.Data == "p" &&
+				strings.HasPrefix(next.FullText(), "Read ") {
+				break
+			}
+		}
+		if !start {
+			continue
+		}
+		var html string
+		html, imgCounter, extra = ReplaceImgTags(p.HTML(), p.FindAll("img"),
+			imgCounter, n, extra)
+		content.WriteString(html)
+	}
+
+	return content.Bytes(), extra
+}
+
+// Return the series title for series soup SUP.
+func TravisSeriesTitle(sup soup.Root) string {
+	div := sup.Find("div", "id", "series-header")
+	if div.Pointer == nil {
+		return "***UNKNOWN***"
+	}
+	return div.Find("h1", "id", "heading").FullText()
+}
+
+// Return the books for the series with URL URL.
+func TravisEpubFiles(url string) []Book {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	chapters := TravisChapters(sup)
+	seriesTitle := TravisSeriesTitle(sup)
+
+	var files []epub.File
+	progressBook(seriesTitle, "", len(chapters))
+	for n, ch := range chapters {
+		progress.Chapter(n+1, ch[0], ch[1])
+		content, extra := TravisChapter(ch[1], ch[0], n+1)
+		cid := "Chapter" + strconv.Itoa(n+1)
+		files = append(files,
+			epub.File{
+				Title:    ch[0],
+				Id:       cid,
+				Filename: "OEBPS/Text/" + cid + ".xhtml",
+				Mimetype: "application/xhtml+xml",
+				Content:  content,
+			})
+		files = append(files, extra...)
+	}
+	return []Book{{
+		Series: seriesTitle,
+		Author: "Travis Translations",
+		Files:  files,
+	}}
+}
+
+// Return the table of contents for the series with URL URL.
+func TravisToc(url string) Toc {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	return Toc{
+		Series:  TravisSeriesTitle(sup),
+		Volumes: []TocVolume{TocVolumeFrom("", TravisChapters(sup), 1, 0)},
+	}
+}
@@ -0,0 +1,119 @@
+package sites
+
+import (
+	"bytes"
+	"github.com/9viz/ln2epub/epub"
+	"github.com/9viz/ln2epub/fetch"
+	"github.com/9viz/ln2epub/progress"
+	"github.com/anaskhan96/soup"
+	"strconv"
+	"strings"
+)
+
+// Index: https://dennou-translations.tumblr.com/post/159331691639/violet-evergarden-novel-index
+
+// Return the volumes with links [ URL, TITLE ] for each chapter.
+// URL is the index url.
+func VioletEvergardenVolumes(url string) []Volume {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	var ret []Volume
+	for _, h2 := range sup.Find("article", "class", "post").FindAll("h2") {
+		title := strings.TrimSpace(h2.Text())
+		var chps [][]string
+		for _, a := range h2.FindNextSibling().FindAll("a") {
+			chps = append(chps, []string{
+				a.Attrs()["href"],
+				strings.TrimSpace(a.Text())})
+		}
+		ret = append(ret, Volume{title, chps})
+	}
+
+	return ret
+}
+
+// Return content for chapter URL with TITLE and chapter no. N.
+func VioletEvergardenChapter(url, title string, n int) ([]byte, []epub.File) {
+	h, err := fetch.Request(url)
+	if err != nil {
+		panic(err)
+	}
+	sup := soup.HTMLParse(h)
+
+	var ret bytes.Buffer
+	var extra []epub.File
+
+	ret.WriteString(epub.ContentPreamble(title))
+
+	var div soup.Root
+	if strings.Contains(url, "x0401x.tumblr.com") {
+		div = sup.Find("div", "class", "container")
+		if div.Pointer == nil {
+			div = sup.Find("div", "class", "posts")
+		}
+	} else {
+		div = sup.Find("article", "class", "post")
+	}
+
+	imgCounter := 1
+	for _, c := range div.Children() {
+		if imgs := c.FindAll("img"); len(imgs) != 0 {
+			var html string
+			html, imgCounter, extra = ReplaceImgTags(
+				c.HTML(), imgs, imgCounter, n, extra)
+			ret.WriteString(html)
+		} else if SoupTag(c) == "div" && c.Attrs()["class"] == "tagged_post" {
+			break
+		} else {
+			ret.WriteString(c.HTML())
+		}
+	}
+	ret.WriteString(epub.ContentEnd())
+
+	return ret.Bytes(), extra
+}
+
+// Return the books for the index url URL.
+func VioletEvergardenEpubFiles(url string) []Book {
+	var ret []Book
+	vols := VioletEvergardenVolumes(url)
+	for _, vol := range vols {
+		v, c := vol.Title, vol.Links
+		var files []epub.File
+		progressBook("Violet Evergarden", v, len(c))
+		for n, ch := range c {
+			progress.Chapter(n+1, ch[1], ch[0])
+			content, extra := VioletEvergardenChapter(ch[0], ch[1], n+1)
+			cid := "Chapter" + strconv.Itoa(n+1)
+			files = append(files,
+				epub.File{
+					Title:    ch[1],
+					Id:       cid,
+					Filename: "OEBPS/Text/" + cid + ".xhtml",
+					Mimetype: "application/xhtml+xml",
+					Content:  content,
+				})
+			files = append(files, extra...)
+		}
+		ret = append(ret, Book{
+			Series: "Violet Evergarden",
+			Volume: v,
+			Author: "Dennou Translations",
+			Files:  files,
+		})
+	}
+	return ret
+}
+
+// Return the table of contents for the index url URL.
+func VioletEvergardenToc(url string) Toc {
+	toc := Toc{Series: "Violet Evergarden"}
+	for _, v := range VioletEvergardenVolumes(url) {
+		toc.Volumes = append(toc.Volumes, TocVolumeFrom(v.Title, v.Links, 0, 1))
+	}
+	return toc
+}